@@ -0,0 +1,62 @@
+// integrity-check 检查数据库中的孤立记录（所属投票、选项、父评论或 Webhook 已不存在的记录）。
+// 只读取数据库，不做修改；发现孤立记录时以状态码 1 退出。
+//
+//	go run ./cmd/integrity-check -db vote.db
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"vote-demo/database"
+)
+
+func main() {
+	path := flag.String("db", database.Path, "数据库文件路径")
+	asJSON := flag.Bool("json", false, "以 JSON 格式输出检查结果")
+	flag.Parse()
+
+	if _, err := os.Stat(*path); err != nil {
+		log.Fatalf("无法打开数据库 %s: %v", *path, err)
+	}
+	db, err := database.Open(*path)
+	if err != nil {
+		log.Fatalf("无法连接到数据库: %v", err)
+	}
+	defer db.Close()
+
+	issues, err := database.CheckIntegrity(db)
+	if err != nil {
+		log.Fatalf("检查失败: %v", err)
+	}
+
+	orphans := 0
+	for _, issue := range issues {
+		orphans += issue.Count
+	}
+
+	if *asJSON {
+		data, _ := json.MarshalIndent(map[string]interface{}{"orphans": orphans, "checks": issues}, "", "  ")
+		fmt.Println(string(data))
+	} else {
+		for _, issue := range issues {
+			status := "OK"
+			if issue.Count > 0 {
+				status = fmt.Sprintf("%d 条", issue.Count)
+			}
+			fmt.Printf("%-32s %-8s %s\n", issue.Check, status, issue.Description)
+			if len(issue.SampleIDs) > 0 {
+				fmt.Printf("    %s\n", strings.Join(issue.SampleIDs, ", "))
+			}
+		}
+		fmt.Printf("共发现 %d 条孤立记录\n", orphans)
+	}
+
+	if orphans > 0 {
+		db.Close()
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,61 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+)
+
+// actor 发起写操作的用户和请求。投票和评论等写操作由 HTTP 接口和实时房间共用，
+// 不依赖 gin.Context，审计记录通过 actor 取得操作者和请求ID
+type actor struct {
+	UserID    string
+	RequestID string
+}
+
+// actorOf 返回 HTTP 请求的操作者，用户ID来自 User-ID 请求头
+func actorOf(c *gin.Context) actor {
+	return actor{UserID: c.GetHeader("User-ID"), RequestID: requestID(c)}
+}
+
+// requestError 写操作拒绝的请求，Status 和 Body 为返回给客户端的状态码和错误信息
+type requestError struct {
+	Status int
+	Body   gin.H
+}
+
+func (e *requestError) Error() string {
+	message, _ := e.Body["error"].(string)
+	return message
+}
+
+// badRequest 返回状态码为 400 的 requestError
+func badRequest(message string) *requestError {
+	return &requestError{Status: http.StatusBadRequest, Body: gin.H{"error": message}}
+}
+
+// failure 将写操作返回的错误转换为状态码和响应体，不是 requestError 的错误按服务器错误处理
+func failure(err error) (int, gin.H) {
+	if e, ok := err.(*requestError); ok {
+		return e.Status, e.Body
+	}
+	return http.StatusInternalServerError, gin.H{"error": err.Error()}
+}
+
+// writeError 将写操作返回的错误写入 HTTP 响应
+func writeError(c *gin.Context, err error) {
+	c.JSON(failure(err))
+}
+
+// decodeInput 解析实时房间请求中的 JSON 请求体，并按 binding 标签验证，与 HTTP 接口的 ShouldBindJSON 一致
+func decodeInput(payload []byte, input interface{}) error {
+	if err := json.Unmarshal(payload, input); err != nil {
+		return badRequest(err.Error())
+	}
+	if err := binding.Validator.ValidateStruct(input); err != nil {
+		return badRequest(err.Error())
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package controllers
+
+import (
+	"errors"
+	"sort"
+	"time"
+	"vote-demo/database"
+	"vote-demo/events"
+	"vote-demo/models"
+)
+
+// errInvalidAllocation 分配中包含不存在或不属于该投票的选项
+var errInvalidAllocation = errors.New("选项不存在或不属于该投票")
+
+// allocationOptionIDs 返回分配中的选项ID（已排序），并验证它们都属于该投票
+func allocationOptionIDs(pollID string, allocations map[string]int) ([]string, error) {
+	// 按选项ID排序，保证投票记录的创建顺序稳定
+	optionIDs := make([]string, 0, len(allocations))
+	for optionID := range allocations {
+		optionIDs = append(optionIDs, optionID)
+	}
+	sort.Strings(optionIDs)
+
+	for _, optionID := range optionIDs {
+		var option models.Option
+		if err := database.DB.Where("id = ? AND poll_id = ?", optionID, pollID).First(&option).Error; err != nil {
+			return nil, errInvalidAllocation
+		}
+	}
+
+	return optionIDs, nil
+}
+
+// replaceAllocation 在事务中删除用户之前的分配并写入新的分配，票数为 0 的选项不会被记录。
+// VoteCast 事件和审计记录与分配在同一事务中写入
+func replaceAllocation(by actor, pollID, userID string, optionIDs []string, allocations map[string]int) ([]models.Vote, error) {
+	tx := database.DB.Begin()
+	previous, err := deleteUserVotes(tx, pollID, userID)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	var votes []models.Vote
+	for _, optionID := range optionIDs {
+		n := allocations[optionID]
+		if n == 0 {
+			continue
+		}
+		vote := models.Vote{
+			PollID:    pollID,
+			OptionID:  optionID,
+			UserID:    userID,
+			Weight:    n,
+			CreatedAt: time.Now(),
+		}
+		if err := tx.Create(&vote).Error; err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+		votes = append(votes, vote)
+	}
+
+	if err := recordVoteCast(tx, by, pollID, userID, previous, votes); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if err := tx.Commit().Error; err != nil {
+		return nil, err
+	}
+	events.Notify()
+	return votes, nil
+}
+
+// optionWeightSum 统计选项获得的总票数（各投票记录 weight 之和）
+func optionWeightSum(optionID string) int {
+	var total int
+	database.DB.Model(&models.Vote{}).
+		Where("option_id = ?", optionID).
+		Select("COALESCE(SUM(weight), 0)").
+		Row().
+		Scan(&total)
+	return total
+}
@@ -0,0 +1,145 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+	"vote-demo/database"
+	"vote-demo/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jinzhu/gorm"
+)
+
+// RequestIDHeader 请求ID的请求头和响应头，客户端未提供时由服务端生成
+const RequestIDHeader = "X-Request-ID"
+
+const requestIDKey = "request_id"
+
+// RequestID 为每个请求分配请求ID，写入上下文和响应头，审计记录会带上该ID
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(RequestIDHeader)
+		if id == "" || len(id) > 64 {
+			id = uuid.New().String()
+		}
+		c.Set(requestIDKey, id)
+		c.Writer.Header().Set(RequestIDHeader, id)
+		c.Next()
+	}
+}
+
+// requestID 返回当前请求的请求ID
+func requestID(c *gin.Context) string {
+	if id := c.GetString(requestIDKey); id != "" {
+		return id
+	}
+	// 没有经过中间件的请求，使用请求头中的ID或生成新的ID
+	id := c.GetHeader(RequestIDHeader)
+	if id == "" {
+		id = uuid.New().String()
+	}
+	c.Set(requestIDKey, id)
+	return id
+}
+
+// recordAudit 在事务中写入审计记录。entry 未指定操作者时使用请求头中的用户ID，before/after 为 nil 时不记录
+func recordAudit(tx *gorm.DB, c *gin.Context, entry models.AuditEntry, before, after interface{}) error {
+	return recordAuditAs(tx, actorOf(c), entry, before, after)
+}
+
+// recordAuditAs 以 by 的身份在事务中写入审计记录，用于不依赖 gin.Context 的写操作
+func recordAuditAs(tx *gorm.DB, by actor, entry models.AuditEntry, before, after interface{}) error {
+	if entry.ActorID == "" {
+		entry.ActorID = by.UserID
+	}
+	if before != nil {
+		data, err := json.Marshal(before)
+		if err != nil {
+			return err
+		}
+		entry.Before = string(data)
+	}
+	if after != nil {
+		data, err := json.Marshal(after)
+		if err != nil {
+			return err
+		}
+		entry.After = string(data)
+	}
+	entry.RequestID = by.RequestID
+	entry.CreatedAt = time.Now()
+	return tx.Create(&entry).Error
+}
+
+// auditEntryView 审计记录的接口表示，修改前后的值按 JSON 原样输出
+type auditEntryView struct {
+	models.AuditEntry
+	Before json.RawMessage `json:"before,omitempty"`
+	After  json.RawMessage `json:"after,omitempty"`
+}
+
+// ListAuditEntries 按投票、用户和时间范围查询审计记录，仅管理员可用
+func ListAuditEntries(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未提供有效的用户ID"})
+		return
+	}
+	if user.Role != models.RoleAdmin {
+		c.JSON(http.StatusForbidden, gin.H{"error": "只有管理员可以查看审计记录"})
+		return
+	}
+
+	query := database.DB.Model(&models.AuditEntry{})
+	if pollID := c.Query("poll_id"); pollID != "" {
+		query = query.Where("poll_id = ?", pollID)
+	}
+	if userID := c.Query("user_id"); userID != "" {
+		query = query.Where("actor_id = ?", userID)
+	}
+	if action := c.Query("action"); action != "" {
+		query = query.Where("action = ?", action)
+	}
+	if value := c.Query("from"); value != "" {
+		from, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "from 必须是 RFC3339 格式的时间"})
+			return
+		}
+		// 数据库中的时间按服务器本地时区保存为字符串，比较前转换为相同的时区
+		query = query.Where("created_at >= ?", from.Local())
+	}
+	if value := c.Query("to"); value != "" {
+		to, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "to 必须是 RFC3339 格式的时间"})
+			return
+		}
+		query = query.Where("created_at < ?", to.Local())
+	}
+
+	limit := 100
+	if value, err := strconv.Atoi(c.Query("limit")); err == nil && value > 0 && value <= 1000 {
+		limit = value
+	}
+
+	var entries []models.AuditEntry
+	query.Order("created_at DESC").Limit(limit).Find(&entries)
+
+	views := make([]auditEntryView, 0, len(entries))
+	for _, entry := range entries {
+		view := auditEntryView{AuditEntry: entry}
+		if entry.Before != "" {
+			view.Before = json.RawMessage(entry.Before)
+		}
+		if entry.After != "" {
+			view.After = json.RawMessage(entry.After)
+		}
+		views = append(views, view)
+	}
+
+	c.JSON(http.StatusOK, views)
+}
@@ -0,0 +1,96 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+	"vote-demo/database"
+	"vote-demo/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// useLocalZone 把服务器的本地时区设为 UTC+8，使请求中的时区与数据库中保存的时区不同
+func useLocalZone(t *testing.T) {
+	t.Helper()
+	previous := time.Local
+	time.Local = time.FixedZone("UTC+8", 8*60*60)
+	t.Cleanup(func() { time.Local = previous })
+}
+
+// serveJSON 以 userID 的身份请求 handler，并解析 JSON 响应
+func serveJSON(t *testing.T, handler gin.HandlerFunc, target, userID string, response interface{}) int {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/*path", handler)
+
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	req.Header.Set("User-ID", userID)
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	if recorder.Code == http.StatusOK {
+		if err := json.Unmarshal(recorder.Body.Bytes(), response); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return recorder.Code
+}
+
+func TestListAuditEntriesTimeRange(t *testing.T) {
+	useLocalZone(t)
+	setupDB(t)
+
+	admin := models.User{Username: "root", Role: models.RoleAdmin}
+	database.DB.Create(&admin)
+
+	// 数据库中的时间按本地时区（UTC+8）保存
+	base := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	for hour := 1; hour <= 5; hour++ {
+		entry := models.AuditEntry{
+			Action:     models.AuditPollUpdate,
+			TargetType: models.AuditTargetPoll,
+			TargetID:   "poll",
+			CreatedAt:  base.Add(time.Duration(hour) * time.Hour).Local(),
+		}
+		if err := database.DB.Create(&entry).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	newYork := time.FixedZone("UTC-5", -5*60*60)
+	tests := []struct {
+		name     string
+		from, to time.Time
+		want     []int // 按时间倒序，UTC 的小时
+	}{
+		{"request offset west of server", base.Add(2 * time.Hour).In(newYork), base.Add(4 * time.Hour).In(newYork), []int{3, 2}},
+		{"request in UTC", base.Add(3 * time.Hour), base.Add(6 * time.Hour), []int{5, 4, 3}},
+		{"request in server zone", base.Add(time.Hour).Local(), base.Add(2 * time.Hour).Local(), []int{1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query := url.Values{"from": {tt.from.Format(time.RFC3339)}, "to": {tt.to.Format(time.RFC3339)}}
+			var entries []models.AuditEntry
+			if code := serveJSON(t, ListAuditEntries, "/api/audit?"+query.Encode(), admin.ID, &entries); code != http.StatusOK {
+				t.Fatalf("status = %d", code)
+			}
+
+			var hours []int
+			for _, entry := range entries {
+				hours = append(hours, entry.CreatedAt.UTC().Hour())
+			}
+			if len(hours) != len(tt.want) {
+				t.Fatalf("hours = %v, want %v", hours, tt.want)
+			}
+			for i := range hours {
+				if hours[i] != tt.want[i] {
+					t.Fatalf("hours = %v, want %v", hours, tt.want)
+				}
+			}
+		})
+	}
+}
@@ -1,86 +1,145 @@
 package controllers
 
 import (
+	"errors"
 	"net/http"
 	"time"
 	"vote-demo/database"
+	"vote-demo/events"
+	"vote-demo/markdown"
 	"vote-demo/models"
+	"vote-demo/trash"
 
 	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
 )
 
 // AddComment 添加评论
 func AddComment(c *gin.Context) {
-	pollID := c.Param("id")
+	var input commentInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	comment, err := addComment(actorOf(c), c.Param("id"), input)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, comment)
+}
+
+// commentInput 评论请求体，HTTP 接口和实时房间相同
+type commentInput struct {
+	Content  string `json:"content" binding:"required"`
+	ParentID string `json:"parent_id"`
+}
 
+// errCommentFailed 写入评论失败
+var errCommentFailed = errors.New("创建评论失败")
+
+// addComment 验证并创建评论，返回创建的评论。被拒绝的请求返回 *requestError
+func addComment(by actor, pollID string, input commentInput) (models.Comment, error) {
 	// 检查投票是否存在
 	var poll models.Poll
 	if err := database.DB.First(&poll, "id = ?", pollID).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "投票不存在"})
-		return
+		return models.Comment{}, &requestError{Status: http.StatusNotFound, Body: gin.H{"error": "投票不存在"}}
 	}
 
 	// 获取用户ID
-	userID := c.GetHeader("User-ID")
+	userID := by.UserID
 	if userID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "未提供用户ID"})
-		return
+		return models.Comment{}, badRequest("未提供用户ID")
 	}
 
 	// 检查用户是否存在
 	var user models.User
 	if err := database.DB.First(&user, "id = ?", userID).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "用户不存在"})
-		return
-	}
-
-	var input struct {
-		Content  string `json:"content" binding:"required"`
-		ParentID string `json:"parent_id"`
-	}
-
-	if err := c.ShouldBindJSON(&input); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-		return
+		return models.Comment{}, &requestError{Status: http.StatusNotFound, Body: gin.H{"error": "用户不存在"}}
 	}
 
 	// 如果提供了父评论ID，检查父评论是否存在
 	if input.ParentID != "" {
 		var parentComment models.Comment
-		if err := database.DB.First(&parentComment, "id = ?", input.ParentID).Error; err != nil {
-			c.JSON(http.StatusNotFound, gin.H{"error": "父评论不存在"})
-			return
+		if err := database.DB.First(&parentComment, "id = ? AND status = ?", input.ParentID, models.CommentVisible).Error; err != nil {
+			return models.Comment{}, &requestError{Status: http.StatusNotFound, Body: gin.H{"error": "父评论不存在"}}
+		}
+		if parentComment.IsDeleted {
+			return models.Comment{}, badRequest("不能回复已删除的评论")
 		}
 
 		// 确保父评论属于同一个投票
 		if parentComment.PollID != pollID {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "父评论不属于该投票"})
-			return
+			return models.Comment{}, badRequest("父评论不属于该投票")
 		}
 	}
 
+	// 内容过滤：命中屏蔽规则的词语会被替换，命中审核规则的评论需要审核
+	moderate, err := checkContent(&input.Content)
+	if err != nil {
+		return models.Comment{}, err
+	}
+
+	// 按 Markdown 渲染内容，并解析 @ 提及的用户
+	contentHTML, mentioned := renderComment(database.DB, input.Content)
+
+	// 开启审核的投票中，除投票创建者和审核员外的新评论需要审核通过后才显示
+	status := models.CommentVisible
+	if (poll.PreModerate || moderate) && !canModerate(user, poll) {
+		status = models.CommentPending
+	}
+
 	// 创建评论
 	comment := models.Comment{
-		PollID:    pollID,
-		UserID:    userID,
-		Content:   input.Content,
-		ParentID:  input.ParentID,
-		CreatedAt: time.Now(),
-		UpdatedAt: time.Now(),
+		PollID:      pollID,
+		UserID:      userID,
+		Content:     input.Content,
+		ContentHTML: contentHTML,
+		ParentID:    models.NullableID(input.ParentID),
+		Status:      status,
+		CreatedAt:   time.Now(),
+		UpdatedAt:   time.Now(),
 	}
 
-	if err := database.DB.Create(&comment).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建评论失败"})
-		return
+	tx := database.DB.Begin()
+	if err := tx.Create(&comment).Error; err != nil {
+		tx.Rollback()
+		return models.Comment{}, errCommentFailed
+	}
+	if err := saveMentions(tx, &comment, mentioned); err != nil {
+		tx.Rollback()
+		return models.Comment{}, errCommentFailed
+	}
+	// 评论者自动关注投票
+	if err := watchPoll(tx, comment.UserID, pollID); err != nil {
+		tx.Rollback()
+		return models.Comment{}, errCommentFailed
 	}
 
-	// 返回创建的评论，包括用户信息
-	database.DB.Preload("User").First(&comment, "id = ?", comment.ID)
+	// 返回创建的评论，包括用户信息和提及的用户
+	tx.Preload("User").Preload("Mentions").First(&comment, "id = ?", comment.ID)
+	comment.IsPollCreator = comment.UserID == poll.CreatorID
+	if err := recordAuditAs(tx, by, models.AuditEntry{Action: models.AuditCommentCreate, TargetType: models.AuditTargetComment, TargetID: comment.ID, PollID: pollID}, nil, comment); err != nil {
+		tx.Rollback()
+		return models.Comment{}, errCommentFailed
+	}
+	// 等待审核的评论在审核通过时才发布事件
+	if status == models.CommentVisible {
+		if err := events.Record(tx, events.CommentAdded{Comment: comment}); err != nil {
+			tx.Rollback()
+			return models.Comment{}, errCommentFailed
+		}
+	}
+	if err := tx.Commit().Error; err != nil {
+		return models.Comment{}, errCommentFailed
+	}
+	events.Notify()
 
-	c.JSON(http.StatusCreated, comment)
+	return comment, nil
 }
 
-// GetPollComments 获取投票的评论
+// GetPollComments 分页获取投票的根评论，每条根评论下按层级展开部分回复
 func GetPollComments(c *gin.Context) {
 	pollID := c.Param("id")
 
@@ -91,38 +150,51 @@ func GetPollComments(c *gin.Context) {
 		return
 	}
 
-	// 获取所有评论
-	var comments []models.Comment
-	database.DB.Where("poll_id = ?", pollID).
-		Preload("User").
-		Order("created_at DESC").
-		Find(&comments)
+	params, ok := parseCommentPageParams(c, "")
+	if !ok {
+		return
+	}
+	touchPollWatch(c, pollID)
+
+	thread := loadCommentThread(pollID, params.sortBy)
+	roots, next := thread.page("", params.cursor, params.limit)
 
-	// 构建评论树
-	var rootComments []models.Comment
-	commentMap := make(map[string]*models.Comment)
+	c.JSON(http.StatusOK, gin.H{
+		"comments":    renderCommentPage(thread.expand(roots, params), c.GetHeader("User-ID"), poll.CreatorID),
+		"total":       thread.total(),
+		"next_cursor": next,
+	})
+}
 
-	// 首先将所有评论放入map中
-	for i := range comments {
-		commentMap[comments[i].ID] = &comments[i]
+// GetCommentReplies 分页获取评论的回复，用于逐步加载评论树中未展开的回复
+func GetCommentReplies(c *gin.Context) {
+	pollID := c.Param("id")
+	commentID := c.Param("comment_id")
+
+	var poll models.Poll
+	if err := database.DB.First(&poll, "id = ?", pollID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "投票不存在"})
+		return
 	}
 
-	// 然后构建评论树
-	for i := range comments {
-		comment := &comments[i]
-		if comment.ParentID == "" {
-			// 这是一个根评论
-			rootComments = append(rootComments, *comment)
-		} else {
-			// 这是一个回复
-			if parent, exists := commentMap[comment.ParentID]; exists {
-				parent.Replies = append(parent.Replies, *comment)
-			}
-		}
+	var comment models.Comment
+	if err := database.DB.First(&comment, "id = ? AND poll_id = ? AND status = ?", commentID, pollID, models.CommentVisible).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "评论不存在"})
+		return
 	}
 
+	params, ok := parseCommentPageParams(c, commentID)
+	if !ok {
+		return
+	}
+
+	thread := loadCommentThread(pollID, params.sortBy)
+	replies, next := thread.page(commentID, params.cursor, params.limit)
+
 	c.JSON(http.StatusOK, gin.H{
-		"comments": rootComments,
+		"replies":     renderCommentPage(thread.expand(replies, params), c.GetHeader("User-ID"), poll.CreatorID),
+		"reply_count": thread.replyCounts([]string{commentID})[commentID],
+		"next_cursor": next,
 	})
 }
 
@@ -143,6 +215,14 @@ func UpdateComment(c *gin.Context) {
 		c.JSON(http.StatusForbidden, gin.H{"error": "无权更新此评论"})
 		return
 	}
+	if comment.Status == models.CommentRemoved {
+		c.JSON(http.StatusForbidden, gin.H{"error": "评论已被移除，不能修改"})
+		return
+	}
+	if comment.IsDeleted {
+		c.JSON(http.StatusForbidden, gin.H{"error": "评论已删除，不能修改"})
+		return
+	}
 
 	var input struct {
 		Content string `json:"content" binding:"required"`
@@ -153,19 +233,83 @@ func UpdateComment(c *gin.Context) {
 		return
 	}
 
-	// 更新评论
+	// 内容过滤：命中屏蔽规则的词语会被替换，命中审核规则的评论重新进入审核
+	moderate, ok := filterContent(c, &input.Content)
+	if !ok {
+		return
+	}
+
+	// 内容没有变化时不算修改
+	if input.Content == comment.Content {
+		database.DB.Preload("User").Preload("Mentions").First(&comment, "id = ?", commentID)
+		c.JSON(http.StatusOK, comment)
+		return
+	}
+
+	before := comment
+	contentHTML, mentioned := renderComment(database.DB, input.Content)
+
+	// 更新评论，修改次数加一
+	now := time.Now()
 	updates := map[string]interface{}{
-		"content":    input.Content,
-		"updated_at": time.Now(),
+		"content":      input.Content,
+		"content_html": contentHTML,
+		"edit_count":   comment.EditCount + 1,
+		"edited_at":    now,
+		"updated_at":   now,
+	}
+	var poll models.Poll
+	database.DB.First(&poll, "id = ?", comment.PollID)
+	if moderate && comment.Status == models.CommentVisible {
+		if user, _ := currentUser(c); !canModerate(user, poll) {
+			updates["status"] = models.CommentPending
+		}
 	}
 
-	if err := database.DB.Model(&comment).Updates(updates).Error; err != nil {
+	tx := database.DB.Begin()
+	// 保存修改前的内容
+	if err := recordCommentRevision(tx, before); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新评论失败"})
+		return
+	}
+	if err := tx.Model(&comment).Updates(updates).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新评论失败"})
+		return
+	}
+	if err := saveMentions(tx, &comment, mentioned); err != nil {
+		tx.Rollback()
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新评论失败"})
 		return
 	}
 
 	// 返回更新后的评论
-	database.DB.Preload("User").First(&comment, "id = ?", commentID)
+	tx.Preload("User").Preload("Mentions").First(&comment, "id = ?", commentID)
+	comment.IsPollCreator = comment.UserID == poll.CreatorID
+	if err := recordAudit(tx, c, models.AuditEntry{Action: models.AuditCommentUpdate, TargetType: models.AuditTargetComment, TargetID: comment.ID, PollID: comment.PollID}, before, comment); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新评论失败"})
+		return
+	}
+	if err := events.Record(tx, events.CommentUpdated{Before: before, Comment: comment}); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新评论失败"})
+		return
+	}
+	if comment.Status != before.Status {
+		if err := events.Record(tx, events.CommentModerated{Before: before, Comment: comment}); err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "更新评论失败"})
+			return
+		}
+	}
+	if err := tx.Commit().Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新评论失败"})
+		return
+	}
+	events.Notify()
+
 	c.JSON(http.StatusOK, comment)
 }
 
@@ -187,11 +331,83 @@ func DeleteComment(c *gin.Context) {
 		return
 	}
 
-	// 删除所有回复
-	database.DB.Where("parent_id = ?", commentID).Delete(&models.Comment{})
+	tx := database.DB.Begin()
+	replies, err := commentReplyIDs(tx, commentID)
+	if err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "删除评论失败"})
+		return
+	}
+
+	// 有回复的评论保留为 [deleted] 占位，回复仍然显示；回复都删除后才能删除占位
+	if len(replies) > 0 {
+		if comment.IsDeleted {
+			tx.Rollback()
+			c.JSON(http.StatusBadRequest, gin.H{"error": "评论已删除"})
+			return
+		}
+		if err := leaveDeletedPlaceholder(tx, c, comment); err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "删除评论失败"})
+			return
+		}
+		if err := tx.Commit().Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "删除评论失败"})
+			return
+		}
+		events.Notify()
 
-	// 删除评论
-	database.DB.Delete(&comment)
+		c.JSON(http.StatusOK, gin.H{"message": "评论已删除", "placeholder": true, "reply_count": len(replies)})
+		return
+	}
+
+	// 没有回复的评论移入回收站
+	if err := trashComment(tx, commentID, trash.Stamp()); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "删除评论失败"})
+		return
+	}
+	if err := recordAudit(tx, c, models.AuditEntry{Action: models.AuditCommentDelete, TargetType: models.AuditTargetComment, TargetID: comment.ID, PollID: comment.PollID}, comment, nil); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "删除评论失败"})
+		return
+	}
+	if err := events.Record(tx, events.CommentDeleted{Comment: comment}); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "删除评论失败"})
+		return
+	}
+	if err := tx.Commit().Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "删除评论失败"})
+		return
+	}
+	events.Notify()
 
 	c.JSON(http.StatusOK, gin.H{"message": "评论已删除"})
-} 
\ No newline at end of file
+}
+
+// leaveDeletedPlaceholder 在事务中将有回复的评论替换为占位：保存原内容到修改历史，清除提及，
+// 评论本身和回复仍然显示。占位是对评论的修改，发布评论更新事件，实时推送中评论不会被移除
+func leaveDeletedPlaceholder(tx *gorm.DB, c *gin.Context, comment models.Comment) error {
+	before := comment
+	if err := recordCommentRevision(tx, comment); err != nil {
+		return err
+	}
+	updates := map[string]interface{}{
+		"content":      models.DeletedCommentContent,
+		"content_html": markdown.Render(models.DeletedCommentContent, nil),
+		"is_deleted":   true,
+		"pinned_at":    nil, // 占位不再置顶
+		"updated_at":   time.Now(),
+	}
+	if err := tx.Model(&comment).Updates(updates).Error; err != nil {
+		return err
+	}
+	if err := saveMentions(tx, &comment, nil); err != nil {
+		return err
+	}
+	if err := recordAudit(tx, c, models.AuditEntry{Action: models.AuditCommentDelete, TargetType: models.AuditTargetComment, TargetID: comment.ID, PollID: comment.PollID}, before, comment); err != nil {
+		return err
+	}
+	return events.Record(tx, events.CommentUpdated{Before: before, Comment: comment})
+}
@@ -0,0 +1,52 @@
+package controllers
+
+import (
+	"time"
+	"vote-demo/markdown"
+	"vote-demo/models"
+
+	"github.com/jinzhu/gorm"
+)
+
+// 一条评论中最多解析的 @ 提及数，超出的按普通文本显示
+const maxCommentMentions = 20
+
+// renderComment 将评论内容渲染为 HTML，并查找其中 @ 提及的用户。不存在的用户名按普通文本显示
+func renderComment(db *gorm.DB, content string) (string, []models.User) {
+	names := markdown.Mentions(content)
+	if len(names) > maxCommentMentions {
+		names = names[:maxCommentMentions]
+	}
+
+	var users []models.User
+	if len(names) > 0 {
+		db.Where("username IN (?)", names).Find(&users)
+	}
+	ids := make(map[string]string, len(users))
+	for _, user := range users {
+		ids[user.Username] = user.ID
+	}
+	return markdown.Render(content, ids), users
+}
+
+// saveMentions 在事务中用 users 替换评论的提及记录，并更新 comment.Mentions
+func saveMentions(tx *gorm.DB, comment *models.Comment, users []models.User) error {
+	if err := tx.Where("comment_id = ?", comment.ID).Delete(&models.CommentMention{}).Error; err != nil {
+		return err
+	}
+	comment.Mentions = make([]models.CommentMention, 0, len(users))
+	for _, user := range users {
+		mention := models.CommentMention{
+			CommentID: comment.ID,
+			PollID:    comment.PollID,
+			UserID:    user.ID,
+			Username:  user.Username,
+			CreatedAt: time.Now(),
+		}
+		if err := tx.Create(&mention).Error; err != nil {
+			return err
+		}
+		comment.Mentions = append(comment.Mentions, mention)
+	}
+	return nil
+}
@@ -0,0 +1,414 @@
+package controllers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+	"vote-demo/database"
+	"vote-demo/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+)
+
+// 评论排序方式
+const (
+	commentSortNewest = "newest"
+	commentSortOldest = "oldest"
+	commentSortTop    = "top" // 按赞成和反对的 Wilson 置信下界排序
+)
+
+// 分页参数的默认值和上限
+const (
+	defaultCommentLimit = 20
+	maxCommentLimit     = 100
+	defaultReplyLimit   = 3
+	maxReplyLimit       = 50
+	defaultReplyDepth   = 2
+	maxReplyDepth       = 5
+	maxPageReplies      = 200 // 一页中展开的回复总数上限，超出的回复通过 replies_cursor 继续加载
+)
+
+var errInvalidCursor = errors.New("无效的分页游标")
+
+func commentSortOrder(value string) (string, bool) {
+	switch value {
+	case commentSortNewest, commentSortOldest, commentSortTop:
+		return value, true
+	}
+	return "", false
+}
+
+// commentCursor 分页游标，记录上一页最后一条评论的排序键，ID 为空表示从第一条开始。
+// 下一页从排序在它之后的评论开始，新发表的评论不会改变已返回内容的位置
+type commentCursor struct {
+	ParentID  string  `json:"p"`
+	Sort      string  `json:"s"`
+	PinnedAt  int64   `json:"n,omitempty"` // 置顶的根评论排在最前面，后置顶的在前
+	Score     float64 `json:"k,omitempty"`
+	CreatedAt int64   `json:"t"`
+	ID        string  `json:"i"`
+}
+
+func (cursor commentCursor) encode() string {
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCommentCursor(value string) (commentCursor, error) {
+	var cursor commentCursor
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return cursor, errInvalidCursor
+	}
+	if err := json.Unmarshal(data, &cursor); err != nil {
+		return cursor, errInvalidCursor
+	}
+	return cursor, nil
+}
+
+// commentPageParams 评论列表的查询参数
+type commentPageParams struct {
+	sortBy     string
+	limit      int
+	replyLimit int
+	maxDepth   int // 展开的回复层数
+	cursor     *commentCursor
+}
+
+// parseCommentPageParams 解析 sort、limit、cursor、reply_limit 和 max_depth 参数，失败时已写入错误响应
+func parseCommentPageParams(c *gin.Context, parentID string) (commentPageParams, bool) {
+	params := commentPageParams{limit: defaultCommentLimit, replyLimit: defaultReplyLimit, maxDepth: defaultReplyDepth}
+
+	sortBy, ok := commentSortOrder(c.DefaultQuery("sort", commentSortNewest))
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "sort 必须是 newest、oldest 或 top"})
+		return params, false
+	}
+	params.sortBy = sortBy
+
+	if value := c.Query("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit <= 0 || limit > maxCommentLimit {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit 必须是 1 到 100 之间的整数"})
+			return params, false
+		}
+		params.limit = limit
+	}
+	if value := c.Query("reply_limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 0 || limit > maxReplyLimit {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "reply_limit 必须是 0 到 50 之间的整数"})
+			return params, false
+		}
+		params.replyLimit = limit
+	}
+	if value := c.Query("max_depth"); value != "" {
+		depth, err := strconv.Atoi(value)
+		if err != nil || depth < 0 || depth > maxReplyDepth {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "max_depth 必须是 0 到 5 之间的整数"})
+			return params, false
+		}
+		params.maxDepth = depth
+	}
+
+	if value := c.Query("cursor"); value != "" {
+		cursor, err := decodeCommentCursor(value)
+		if err != nil || cursor.ParentID != parentID {
+			c.JSON(http.StatusBadRequest, gin.H{"error": errInvalidCursor.Error()})
+			return params, false
+		}
+		if cursor.Sort != params.sortBy {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "分页游标与排序方式不一致"})
+			return params, false
+		}
+		if cursor.ID != "" {
+			params.cursor = &cursor
+		}
+	}
+	return params, true
+}
+
+// commentThread 投票下显示中的评论，每页评论按排序键从数据库查询。
+// 被隐藏的评论的回复也不显示，没有显示中回复的 [deleted] 占位也不显示
+type commentThread struct {
+	pollID       string
+	sortBy       string
+	placeholders []string // 仍有显示中回复的 [deleted] 占位
+}
+
+// commentKeyColumns 排序和分页使用的列，评论内容只为返回的那一页加载
+const commentKeyColumns = "id, parent_id, is_deleted, pinned_at, score, created_at"
+
+func loadCommentThread(pollID, sortBy string) *commentThread {
+	thread := &commentThread{pollID: pollID, sortBy: sortBy}
+	thread.loadPlaceholders()
+	return thread
+}
+
+// loadPlaceholders 找出仍有显示中回复的 [deleted] 占位。只加载被删除的评论，
+// 逐层向上传递，回复也都是空占位的占位同样不显示
+func (thread *commentThread) loadPlaceholders() {
+	var deleted []models.Comment
+	database.DB.Select("id, parent_id").
+		Where("poll_id = ? AND status = ? AND is_deleted = ?", thread.pollID, models.CommentVisible, true).
+		Find(&deleted)
+	if len(deleted) == 0 {
+		return
+	}
+
+	parentOf := make(map[string]string, len(deleted))
+	ids := make([]string, 0, len(deleted))
+	for _, comment := range deleted {
+		parentOf[comment.ID] = string(comment.ParentID)
+		ids = append(ids, comment.ID)
+	}
+
+	// 有未删除回复的占位
+	var parents []string
+	database.DB.Model(&models.Comment{}).
+		Where("poll_id = ? AND status = ? AND is_deleted = ? AND parent_id IN (?)", thread.pollID, models.CommentVisible, false, ids).
+		Group("parent_id").
+		Pluck("parent_id", &parents)
+
+	live := make(map[string]bool, len(parents))
+	for _, id := range parents {
+		live[id] = true
+	}
+	for _, id := range parents {
+		for parentID := parentOf[id]; ; parentID = parentOf[parentID] {
+			if _, placeholder := parentOf[parentID]; !placeholder || live[parentID] {
+				break
+			}
+			live[parentID] = true
+		}
+	}
+	for id := range live {
+		thread.placeholders = append(thread.placeholders, id)
+	}
+}
+
+// visible 返回查询显示中评论的条件
+func (thread *commentThread) visible() *gorm.DB {
+	db := database.DB.Model(&models.Comment{}).Where("poll_id = ? AND status = ?", thread.pollID, models.CommentVisible)
+	if len(thread.placeholders) == 0 {
+		return db.Where("is_deleted = ?", false)
+	}
+	return db.Where("is_deleted = ? OR id IN (?)", false, thread.placeholders)
+}
+
+// total 统计显示中的评论总数
+func (thread *commentThread) total() int {
+	var total int
+	thread.visible().Count(&total)
+	return total
+}
+
+// replyCounts 统计评论的直接回复数
+func (thread *commentThread) replyCounts(ids []string) map[string]int {
+	counts := make(map[string]int)
+	if len(ids) == 0 {
+		return counts
+	}
+
+	var rows []struct {
+		ParentID string
+		Count    int
+	}
+	thread.visible().
+		Select("parent_id, COUNT(*) AS count").
+		Where("parent_id IN (?)", ids).
+		Group("parent_id").
+		Scan(&rows)
+	for _, row := range rows {
+		counts[row.ParentID] = row.Count
+	}
+	return counts
+}
+
+func (thread *commentThread) key(comment models.Comment) commentCursor {
+	key := commentCursor{ParentID: string(comment.ParentID), Sort: thread.sortBy, CreatedAt: comment.CreatedAt.UnixNano(), ID: comment.ID}
+	if thread.sortBy == commentSortTop {
+		key.Score = comment.Score
+	}
+	if comment.ParentID == "" && comment.PinnedAt != nil {
+		key.PinnedAt = comment.PinnedAt.UnixNano()
+	}
+	return key
+}
+
+// after 添加排在游标之后的条件和排序，ID 用于区分同一时间发表的评论，保证顺序唯一
+func (thread *commentThread) after(query *gorm.DB, after *commentCursor) *gorm.DB {
+	switch thread.sortBy {
+	case commentSortOldest:
+		if after != nil {
+			createdAt := time.Unix(0, after.CreatedAt)
+			query = query.Where("created_at > ? OR (created_at = ? AND id > ?)", createdAt, createdAt, after.ID)
+		}
+		return query.Order("created_at ASC, id ASC")
+	case commentSortTop:
+		if after != nil {
+			createdAt := time.Unix(0, after.CreatedAt)
+			query = query.Where("score < ? OR (score = ? AND (created_at < ? OR (created_at = ? AND id < ?)))", after.Score, after.Score, createdAt, createdAt, after.ID)
+		}
+		return query.Order("score DESC, created_at DESC, id DESC")
+	}
+	if after != nil {
+		createdAt := time.Unix(0, after.CreatedAt)
+		query = query.Where("created_at < ? OR (created_at = ? AND id < ?)", createdAt, createdAt, after.ID)
+	}
+	return query.Order("created_at DESC, id DESC")
+}
+
+// page 返回 parentID 下排在 after 之后的最多 limit 条评论，以及下一页的游标。
+// 置顶的根评论排在最前面，后置顶的在前，之后按排序方式排列未置顶的评论
+func (thread *commentThread) page(parentID string, after *commentCursor, limit int) ([]models.Comment, string) {
+	var comments []models.Comment
+	if parentID == "" && (after == nil || after.PinnedAt != 0) {
+		query := thread.visible().Select(commentKeyColumns).Where("parent_id IS NULL AND pinned_at IS NOT NULL")
+		if after != nil {
+			pinnedAt := time.Unix(0, after.PinnedAt)
+			query = query.Where("pinned_at < ? OR (pinned_at = ? AND id < ?)", pinnedAt, pinnedAt, after.ID)
+		}
+		query.Order("pinned_at DESC, id DESC").Limit(limit + 1).Find(&comments)
+		// 置顶评论之后从第一条未置顶的评论开始
+		after = nil
+	}
+
+	if len(comments) <= limit {
+		query := thread.visible().Select(commentKeyColumns)
+		if parentID == "" {
+			query = query.Where("parent_id IS NULL AND pinned_at IS NULL")
+		} else {
+			query = query.Where("parent_id = ?", parentID)
+		}
+		var rest []models.Comment
+		thread.after(query, after).Limit(limit + 1 - len(comments)).Find(&rest)
+		comments = append(comments, rest...)
+	}
+
+	// 多查询一条用于判断是否还有下一页
+	if len(comments) <= limit {
+		return comments, ""
+	}
+	comments = comments[:limit]
+	return comments, thread.key(comments[limit-1]).encode()
+}
+
+// expand 逐层展开一页评论下的回复，每条评论最多 replyLimit 条，最多 maxDepth 层，
+// 整页最多 maxPageReplies 条；更多的回复通过 replies_cursor 继续加载
+func (thread *commentThread) expand(comments []models.Comment, params commentPageParams) []*commentPageNode {
+	nodes := newCommentPageNodes(comments)
+	budget := maxPageReplies
+	level := nodes
+	for depth := 0; len(level) > 0; depth++ {
+		thread.countReplies(level)
+
+		var next []*commentPageNode
+		for _, node := range level {
+			if node.replyCount == 0 {
+				continue
+			}
+			limit := params.replyLimit
+			if limit > budget {
+				limit = budget
+			}
+			if depth >= params.maxDepth || limit == 0 {
+				// 回复未展开，游标指向第一条回复
+				node.repliesCursor = commentCursor{ParentID: node.id, Sort: thread.sortBy}.encode()
+				continue
+			}
+			replies, cursor := thread.page(node.id, nil, limit)
+			budget -= len(replies)
+			node.replies = newCommentPageNodes(replies)
+			node.repliesCursor = cursor
+			next = append(next, node.replies...)
+		}
+		level = next
+	}
+	return nodes
+}
+
+// countReplies 查询同一层评论的直接回复数
+func (thread *commentThread) countReplies(nodes []*commentPageNode) {
+	ids := make([]string, 0, len(nodes))
+	for _, node := range nodes {
+		ids = append(ids, node.id)
+	}
+	counts := thread.replyCounts(ids)
+	for _, node := range nodes {
+		node.replyCount = counts[node.id]
+	}
+}
+
+func newCommentPageNodes(comments []models.Comment) []*commentPageNode {
+	nodes := make([]*commentPageNode, 0, len(comments))
+	for _, comment := range comments {
+		nodes = append(nodes, &commentPageNode{id: comment.ID})
+	}
+	return nodes
+}
+
+// commentPageNode 一页评论中的一条，内容在最后统一加载
+type commentPageNode struct {
+	id            string
+	replyCount    int
+	repliesCursor string
+	replies       []*commentPageNode
+}
+
+// renderCommentPage 加载一页评论的内容、反应数量和 viewerID 添加的反应，并按结构组装；
+// creatorID 为投票创建者，用于标记创建者发表的评论
+func renderCommentPage(nodes []*commentPageNode, viewerID, creatorID string) []models.Comment {
+	var ids []string
+	var collect func(nodes []*commentPageNode)
+	collect = func(nodes []*commentPageNode) {
+		for _, node := range nodes {
+			ids = append(ids, node.id)
+			collect(node.replies)
+		}
+	}
+	collect(nodes)
+
+	counts := reactionCounts(database.DB, ids)
+	mine := userReactions(database.DB, viewerID, ids)
+	loaded := make(map[string]models.Comment, len(ids))
+	if len(ids) > 0 {
+		var comments []models.Comment
+		database.DB.Where("id IN (?)", ids).Preload("User").Preload("Mentions").Find(&comments)
+		for _, comment := range comments {
+			loaded[comment.ID] = comment
+		}
+	}
+
+	var build func(nodes []*commentPageNode) []models.Comment
+	build = func(nodes []*commentPageNode) []models.Comment {
+		result := make([]models.Comment, 0, len(nodes))
+		for _, node := range nodes {
+			comment, ok := loaded[node.id]
+			if !ok {
+				continue
+			}
+			comment.Reactions = counts[node.id]
+			if comment.Reactions == nil {
+				comment.Reactions = map[string]int{}
+			}
+			comment.MyReactions = mine[node.id]
+			comment.ReplyCount = node.replyCount
+			comment.RepliesCursor = node.repliesCursor
+			if comment.IsDeleted {
+				// 占位评论不显示作者
+				comment.UserID = ""
+				comment.User = models.User{}
+			}
+			comment.IsPollCreator = comment.UserID != "" && comment.UserID == creatorID
+			comment.Replies = build(node.replies)
+			result = append(result, comment)
+		}
+		return result
+	}
+	return build(nodes)
+}
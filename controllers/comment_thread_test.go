@@ -0,0 +1,262 @@
+package controllers
+
+import (
+	"encoding/base64"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+	"vote-demo/database"
+	"vote-demo/models"
+)
+
+// setupDB 使用临时目录中的数据库
+func setupDB(t *testing.T) {
+	t.Helper()
+	database.Path = filepath.Join(t.TempDir(), "test.db")
+	database.InitDB()
+	database.DB.LogMode(false)
+	t.Cleanup(database.CloseDB)
+}
+
+func TestCommentCursorRoundTrip(t *testing.T) {
+	tests := []commentCursor{
+		{ParentID: "", Sort: commentSortNewest, CreatedAt: 1700000000123456789, ID: "c1"},
+		{ParentID: "parent", Sort: commentSortOldest, CreatedAt: 1, ID: "c2"},
+		{ParentID: "", Sort: commentSortTop, PinnedAt: 1700000000000000001, Score: 0.20654931654, CreatedAt: 1700000000000000000, ID: "c3"},
+		{ParentID: "parent", Sort: commentSortTop},
+	}
+	for _, cursor := range tests {
+		got, err := decodeCommentCursor(cursor.encode())
+		if err != nil {
+			t.Fatalf("decode(%+v): %v", cursor, err)
+		}
+		if got != cursor {
+			t.Errorf("round trip = %+v, want %+v", got, cursor)
+		}
+	}
+}
+
+func TestDecodeCommentCursorInvalid(t *testing.T) {
+	for _, value := range []string{
+		"!!!",
+		base64.StdEncoding.EncodeToString([]byte(`{"i":"c1"}`)) + "==",
+		base64.RawURLEncoding.EncodeToString([]byte("not json")),
+		base64.RawURLEncoding.EncodeToString([]byte(`{"t":"yesterday"}`)),
+	} {
+		if _, err := decodeCommentCursor(value); err != errInvalidCursor {
+			t.Errorf("decodeCommentCursor(%q) = %v, want %v", value, err, errInvalidCursor)
+		}
+	}
+}
+
+// expectedCommentOrder 按 page 的规则在内存中排序：置顶的在前，之后按排序方式排列
+func expectedCommentOrder(comments []models.Comment, sortBy string) []string {
+	sorted := append([]models.Comment(nil), comments...)
+	sort.Slice(sorted, func(i, j int) bool {
+		a, b := sorted[i], sorted[j]
+		if (a.PinnedAt != nil) != (b.PinnedAt != nil) {
+			return a.PinnedAt != nil
+		}
+		if a.PinnedAt != nil {
+			if !a.PinnedAt.Equal(*b.PinnedAt) {
+				return a.PinnedAt.After(*b.PinnedAt)
+			}
+			return a.ID > b.ID
+		}
+		switch sortBy {
+		case commentSortOldest:
+			if !a.CreatedAt.Equal(b.CreatedAt) {
+				return a.CreatedAt.Before(b.CreatedAt)
+			}
+			return a.ID < b.ID
+		case commentSortTop:
+			if a.Score != b.Score {
+				return a.Score > b.Score
+			}
+		}
+		if !a.CreatedAt.Equal(b.CreatedAt) {
+			return a.CreatedAt.After(b.CreatedAt)
+		}
+		return a.ID > b.ID
+	})
+	ids := make([]string, len(sorted))
+	for i, comment := range sorted {
+		ids[i] = comment.ID
+	}
+	return ids
+}
+
+func TestCommentPageStableWhenNewCommentsArrive(t *testing.T) {
+	setupDB(t)
+
+	poll := models.Poll{Title: "午饭吃什么", Type: models.PollTypeSingle, IsActive: true}
+	database.DB.Create(&poll)
+
+	// 部分评论的发表时间和得分相同，用于检查 ID 的排序
+	base := time.Now().Add(-time.Hour).Truncate(time.Second)
+	scores := []float64{0.5, 0, 0.9, 0.5, 0, 0.2, 0.5, 0.9, 0, 0.1}
+	var comments []models.Comment
+	for i, score := range scores {
+		comment := models.Comment{
+			PollID:    poll.ID,
+			UserID:    "user",
+			Content:   fmt.Sprintf("评论 %d", i),
+			Status:    models.CommentVisible,
+			Score:     score,
+			CreatedAt: base.Add(time.Duration(i/2) * time.Minute),
+		}
+		if i == 3 || i == 6 {
+			pinnedAt := base.Add(time.Duration(i) * time.Hour)
+			comment.PinnedAt = &pinnedAt
+		}
+		if err := database.DB.Create(&comment).Error; err != nil {
+			t.Fatal(err)
+		}
+		comments = append(comments, comment)
+	}
+
+	for _, sortBy := range []string{commentSortNewest, commentSortOldest, commentSortTop} {
+		for _, limit := range []int{1, 2, 3, 4} {
+			t.Run(fmt.Sprintf("%s limit %d", sortBy, limit), func(t *testing.T) {
+				var seen []string
+				var added []string
+				var after *commentCursor
+				t.Cleanup(func() {
+					database.DB.Unscoped().Where("id IN (?)", added).Delete(&models.Comment{})
+				})
+				for pages := 0; ; pages++ {
+					if pages > len(scores)+5 {
+						t.Fatalf("too many pages: %v", seen)
+					}
+					thread := loadCommentThread(poll.ID, sortBy)
+					page, next := thread.page("", after, limit)
+					if len(page) > limit {
+						t.Fatalf("page has %d comments, limit %d", len(page), limit)
+					}
+					for _, comment := range page {
+						seen = append(seen, comment.ID)
+					}
+					if next == "" {
+						break
+					}
+					cursor, err := decodeCommentCursor(next)
+					if err != nil {
+						t.Fatal(err)
+					}
+					after = &cursor
+					if len(added) == 3 {
+						continue
+					}
+
+					// 前几次翻页之间各发表一条新评论，得分最高
+					comment := models.Comment{PollID: poll.ID, UserID: "user", Content: "新评论", Status: models.CommentVisible, Score: 1}
+					if err := database.DB.Create(&comment).Error; err != nil {
+						t.Fatal(err)
+					}
+					added = append(added, comment.ID)
+				}
+
+				isNew := make(map[string]bool, len(added))
+				for _, id := range added {
+					isNew[id] = true
+				}
+				counts := make(map[string]int)
+				var existing []string
+				for _, id := range seen {
+					if counts[id]++; counts[id] > 1 {
+						t.Errorf("comment %s returned twice: %v", id, seen)
+					}
+					if !isNew[id] {
+						existing = append(existing, id)
+					}
+				}
+				if want := expectedCommentOrder(comments, sortBy); !reflect.DeepEqual(existing, want) {
+					t.Errorf("existing comments = %v, want %v", existing, want)
+				}
+			})
+		}
+	}
+}
+
+// countPageReplies 统计展开的回复数和最深的层数
+func countPageReplies(nodes []*commentPageNode, depth int) (replies, maxDepth int) {
+	for _, node := range nodes {
+		if len(node.replies) > 0 && depth+1 > maxDepth {
+			maxDepth = depth + 1
+		}
+		n, d := countPageReplies(node.replies, depth+1)
+		replies += len(node.replies) + n
+		if d > maxDepth {
+			maxDepth = d
+		}
+	}
+	return replies, maxDepth
+}
+
+func TestCommentExpandBounded(t *testing.T) {
+	setupDB(t)
+
+	poll := models.Poll{Title: "午饭吃什么", Type: models.PollTypeSingle, IsActive: true}
+	database.DB.Create(&poll)
+
+	// 每条根评论下有一条 6 层的回复链，以及另外 3 条较晚发表的直接回复
+	const roots = 80
+	tx := database.DB.Begin()
+	for i := 0; i < roots; i++ {
+		parentID := ""
+		for depth := 0; depth <= 6; depth++ {
+			comment := models.Comment{PollID: poll.ID, UserID: "user", Content: "评论", Status: models.CommentVisible, ParentID: models.NullableID(parentID)}
+			if err := tx.Create(&comment).Error; err != nil {
+				t.Fatal(err)
+			}
+			if depth == 1 {
+				for j := 0; j < 3; j++ {
+					tx.Create(&models.Comment{PollID: poll.ID, UserID: "user", Content: "回复", Status: models.CommentVisible, ParentID: models.NullableID(parentID)})
+				}
+			}
+			parentID = comment.ID
+		}
+	}
+	tx.Commit()
+
+	tests := []struct {
+		name        string
+		params      commentPageParams
+		wantReplies int
+		wantDepth   int
+	}{
+		{"default depth", commentPageParams{replyLimit: 1, maxDepth: defaultReplyDepth}, roots * defaultReplyDepth, defaultReplyDepth},
+		{"no replies", commentPageParams{replyLimit: 3, maxDepth: 0}, 0, 0},
+		{"page reply cap", commentPageParams{replyLimit: maxReplyLimit, maxDepth: maxReplyDepth}, maxPageReplies, maxReplyDepth},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			thread := loadCommentThread(poll.ID, commentSortOldest)
+			comments, _ := thread.page("", nil, roots)
+			nodes := thread.expand(comments, tt.params)
+
+			replies, depth := countPageReplies(nodes, 0)
+			if replies != tt.wantReplies {
+				t.Errorf("expanded %d replies, want %d", replies, tt.wantReplies)
+			}
+			if depth > tt.wantDepth {
+				t.Errorf("expanded %d levels, want at most %d", depth, tt.wantDepth)
+			}
+
+			// 未展开的回复都有继续加载的游标
+			var check func(nodes []*commentPageNode)
+			check = func(nodes []*commentPageNode) {
+				for _, node := range nodes {
+					if len(node.replies) < node.replyCount && node.repliesCursor == "" {
+						t.Errorf("comment %s: %d of %d replies expanded without replies_cursor", node.id, len(node.replies), node.replyCount)
+					}
+					check(node.replies)
+				}
+			}
+			check(nodes)
+		})
+	}
+}
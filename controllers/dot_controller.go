@@ -0,0 +1,103 @@
+package controllers
+
+import (
+	"net/http"
+	"vote-demo/database"
+	"vote-demo/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// PointBucket 点投票中某个点数被多少位投票者分配给了选项
+type PointBucket struct {
+	Points int `json:"points"`
+	Voters int `json:"voters"`
+}
+
+// pointBudget 返回点投票中每位投票者可分配的总点数
+func pointBudget(poll models.Poll) int {
+	if poll.PointBudget > 0 {
+		return poll.PointBudget
+	}
+	return models.DefaultPointBudget
+}
+
+// dotTotal 计算分配的总点数，maxPerOption 为 0 表示单个选项不限。
+// 分配无效或超出预算时返回错误响应；累加前先检查单个点数，超过预算立即停止，不会溢出
+func dotTotal(allocations map[string]int, budget, maxPerOption int) (int, gin.H) {
+	total := 0
+	for _, points := range allocations {
+		if points < 0 {
+			return 0, gin.H{"error": "点数不能为负数"}
+		}
+		if maxPerOption > 0 && points > maxPerOption {
+			return 0, gin.H{
+				"error":          "单个选项分配的点数超过上限",
+				"max_per_option": maxPerOption,
+			}
+		}
+		if points > budget-total {
+			return 0, gin.H{
+				"error":  "分配的点数超过总点数",
+				"budget": budget,
+			}
+		}
+		total += points
+	}
+	if total == 0 {
+		return 0, gin.H{"error": "未分配任何点数"}
+	}
+	return total, nil
+}
+
+// castDotVote 处理点投票，新的分配会整体替换用户之前的分配
+func castDotVote(by actor, poll models.Poll, userID string, allocations map[string]int) (gin.H, error) {
+	if len(allocations) == 0 {
+		return nil, badRequest("未分配任何点数")
+	}
+
+	budget := pointBudget(poll)
+	total, problem := dotTotal(allocations, budget, poll.MaxPerOption)
+	if problem != nil {
+		return nil, &requestError{Status: http.StatusBadRequest, Body: problem}
+	}
+
+	optionIDs, err := allocationOptionIDs(poll.ID, allocations)
+	if err != nil {
+		return nil, badRequest(err.Error())
+	}
+
+	votes, err := replaceAllocation(by, poll.ID, userID, optionIDs, allocations)
+	if err != nil {
+		return nil, errVoteFailed
+	}
+
+	return gin.H{
+		"message":          "投票成功",
+		"votes":            votes,
+		"points_spent":     total,
+		"points_remaining": budget - total,
+	}, nil
+}
+
+// dotPointDistribution 统计选项上各点数被多少位投票者分配，按点数升序排列
+func dotPointDistribution(optionID string) []PointBucket {
+	distribution := []PointBucket{}
+	rows, err := database.DB.Model(&models.Vote{}).
+		Where("option_id = ?", optionID).
+		Select("weight, COUNT(DISTINCT user_id)").
+		Group("weight").
+		Order("weight ASC").
+		Rows()
+	if err != nil {
+		return distribution
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var bucket PointBucket
+		rows.Scan(&bucket.Points, &bucket.Voters)
+		distribution = append(distribution, bucket)
+	}
+	return distribution
+}
@@ -0,0 +1,46 @@
+package controllers
+
+import (
+	"math"
+	"testing"
+)
+
+func TestDotTotal(t *testing.T) {
+	tests := []struct {
+		name         string
+		allocations  map[string]int
+		budget       int
+		maxPerOption int
+		want         int
+		wantErr      string
+	}{
+		{"single option", map[string]int{"a": 3}, 10, 0, 3, ""},
+		{"spends whole budget", map[string]int{"a": 4, "b": 6}, 10, 0, 10, ""},
+		{"at the per option limit", map[string]int{"a": 5, "b": 5}, 10, 5, 10, ""},
+		{"over the per option limit", map[string]int{"a": 6}, 10, 5, 0, "单个选项分配的点数超过上限"},
+		{"single option over budget", map[string]int{"a": 11}, 10, 0, 0, "分配的点数超过总点数"},
+		{"sum over budget", map[string]int{"a": 6, "b": 5}, 10, 0, 0, "分配的点数超过总点数"},
+		{"huge value", map[string]int{"a": math.MaxInt64}, 10, 0, 0, "分配的点数超过总点数"},
+		{"running total would overflow", map[string]int{"a": math.MaxInt64, "b": math.MaxInt64}, math.MaxInt64, 0, 0, "分配的点数超过总点数"},
+		{"negative points", map[string]int{"a": -1, "b": 2}, 10, 0, 0, "点数不能为负数"},
+		{"negative cannot offset overflow", map[string]int{"a": math.MaxInt64, "b": -1}, math.MaxInt64, 0, 0, "点数不能为负数"},
+		{"nothing allocated", map[string]int{"a": 0}, 10, 0, 0, "未分配任何点数"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			total, errBody := dotTotal(tt.allocations, tt.budget, tt.maxPerOption)
+			if tt.wantErr != "" {
+				if errBody == nil || errBody["error"] != tt.wantErr {
+					t.Fatalf("error = %v, want %q", errBody, tt.wantErr)
+				}
+				return
+			}
+			if errBody != nil {
+				t.Fatalf("unexpected error %v", errBody)
+			}
+			if total != tt.want {
+				t.Errorf("total = %d, want %d", total, tt.want)
+			}
+		})
+	}
+}
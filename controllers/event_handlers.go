@@ -0,0 +1,62 @@
+package controllers
+
+import (
+	"vote-demo/events"
+	"vote-demo/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SubscribeEvents 注册实时推送（SSE 结果推送和 WebSocket 实时房间）的事件订阅者，应在服务启动时调用
+func SubscribeEvents() {
+	events.Subscribe("live", handleLiveEvent)
+}
+
+// handleLiveEvent 将领域事件转换为实时推送，与实时推送无关的事件直接忽略
+func handleLiveEvent(event events.Event) error {
+	switch e := event.(type) {
+	case events.PollUpdated:
+		publishLiveEvent(e.Poll.ID, LiveEventPollUpdated, e.Poll)
+		notifyResultsChanged(e.Poll.ID)
+	case events.PollDeleted:
+		notifyResultsChanged(e.Poll.ID)
+		publishLiveEvent(e.Poll.ID, LiveEventPollDeleted, gin.H{"id": e.Poll.ID})
+	case events.PollRestored:
+		publishLiveEvent(e.Poll.ID, LiveEventPollUpdated, e.Poll)
+		notifyResultsChanged(e.Poll.ID)
+	case events.VoteCast:
+		notifyResultsChanged(e.PollID)
+	case events.OptionAdded:
+		publishLiveEvent(e.Option.PollID, LiveEventOptionAdded, e.Option)
+		notifyResultsChanged(e.Option.PollID)
+	case events.OptionUpdated:
+		publishLiveEvent(e.Option.PollID, LiveEventOptionUpdated, e.Option)
+		notifyResultsChanged(e.Option.PollID)
+	case events.OptionDeleted:
+		publishLiveEvent(e.Option.PollID, LiveEventOptionDeleted, gin.H{"id": e.Option.ID})
+		notifyResultsChanged(e.Option.PollID)
+	case events.OptionRestored:
+		publishLiveEvent(e.Option.PollID, LiveEventOptionAdded, e.Option)
+		notifyResultsChanged(e.Option.PollID)
+	case events.CommentAdded:
+		publishLiveEvent(e.Comment.PollID, LiveEventCommentAdded, e.Comment)
+	case events.CommentUpdated:
+		// 等待审核或已隐藏的评论不推送
+		if e.Comment.Status == models.CommentVisible {
+			publishLiveEvent(e.Comment.PollID, LiveEventCommentUpdated, e.Comment)
+		}
+	case events.CommentModerated:
+		if e.Comment.Status == models.CommentVisible {
+			publishLiveEvent(e.Comment.PollID, LiveEventCommentAdded, e.Comment)
+		} else if e.Before.Status == models.CommentVisible {
+			publishLiveEvent(e.Comment.PollID, LiveEventCommentDeleted, gin.H{"id": e.Comment.ID})
+		}
+	case events.CommentDeleted:
+		publishLiveEvent(e.Comment.PollID, LiveEventCommentDeleted, gin.H{"id": e.Comment.ID})
+	case events.CommentRestored:
+		publishLiveEvent(e.Comment.PollID, LiveEventCommentAdded, e.Comment)
+	case events.CommentReacted:
+		publishLiveEvent(e.PollID, LiveEventCommentReacted, gin.H{"id": e.CommentID, "reactions": e.Reactions})
+	}
+	return nil
+}
@@ -0,0 +1,285 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+	"vote-demo/database"
+	"vote-demo/filter"
+	"vote-demo/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// filterContent 使用内容过滤规则检查文本，命中屏蔽规则的内容会被原地替换为 *。
+// 命中拒绝规则时已写入错误响应并返回 ok 为 false；moderate 表示有内容需要审核
+func filterContent(c *gin.Context, texts ...*string) (moderate bool, ok bool) {
+	moderate, err := checkContent(texts...)
+	if err != nil {
+		writeError(c, err)
+		return false, false
+	}
+	return moderate, true
+}
+
+// checkContent 与 filterContent 相同，命中拒绝规则时返回错误而不是写入响应
+func checkContent(texts ...*string) (moderate bool, err error) {
+	for _, text := range texts {
+		result := filter.Check(*text)
+		switch result.Action {
+		case models.FilterActionReject:
+			return false, badRequest("内容包含不允许发布的词语")
+		case models.FilterActionModerate:
+			moderate = true
+		}
+		*text = result.Text
+	}
+	return moderate, nil
+}
+
+// filterPollContent 检查投票标题、描述和选项内容。投票和选项没有审核流程，需要审核的内容按拒绝处理
+func filterPollContent(c *gin.Context, texts ...*string) bool {
+	moderate, ok := filterContent(c, texts...)
+	if !ok {
+		return false
+	}
+	if moderate {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "内容包含需要人工审核的词语，请修改后重试"})
+		return false
+	}
+	return true
+}
+
+// requireAdmin 检查当前用户是管理员，失败时已写入错误响应
+func requireAdmin(c *gin.Context, message string) (models.User, bool) {
+	user, ok := currentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未提供有效的用户ID"})
+		return user, false
+	}
+	if user.Role != models.RoleAdmin {
+		c.JSON(http.StatusForbidden, gin.H{"error": message})
+		return user, false
+	}
+	return user, true
+}
+
+// filterRuleInput 创建和修改过滤规则的请求体
+type filterRuleInput struct {
+	Pattern string `json:"pattern" binding:"required"`
+	IsRegex bool   `json:"is_regex"`
+	Action  string `json:"action" binding:"required"`
+	Enabled *bool  `json:"enabled"` // 默认启用
+	Note    string `json:"note"`
+}
+
+// validate 检查处理方式和规则内容，失败时已写入错误响应
+func (input filterRuleInput) validate(c *gin.Context) bool {
+	if input.Action != models.FilterActionReject && input.Action != models.FilterActionMask && input.Action != models.FilterActionModerate {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "action 必须是 reject、mask 或 moderate"})
+		return false
+	}
+	if err := filter.Compile(models.FilterRule{Pattern: input.Pattern, IsRegex: input.IsRegex}); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return false
+	}
+	return true
+}
+
+// reloadFilterRules 规则修改提交后立即重新加载，不需要重启服务
+func reloadFilterRules(c *gin.Context) bool {
+	if err := filter.Reload(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "规则已保存，但重新加载失败"})
+		return false
+	}
+	return true
+}
+
+// ListFilterRules 获取所有内容过滤规则，仅管理员可用
+func ListFilterRules(c *gin.Context) {
+	if _, ok := requireAdmin(c, "只有管理员可以管理过滤规则"); !ok {
+		return
+	}
+
+	var rules []models.FilterRule
+	database.DB.Order("id ASC").Find(&rules)
+	c.JSON(http.StatusOK, rules)
+}
+
+// CreateFilterRule 创建内容过滤规则，仅管理员可用
+func CreateFilterRule(c *gin.Context) {
+	user, ok := requireAdmin(c, "只有管理员可以管理过滤规则")
+	if !ok {
+		return
+	}
+
+	var input filterRuleInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !input.validate(c) {
+		return
+	}
+
+	rule := models.FilterRule{
+		Pattern:   input.Pattern,
+		IsRegex:   input.IsRegex,
+		Action:    input.Action,
+		Enabled:   input.Enabled == nil || *input.Enabled,
+		Note:      input.Note,
+		CreatedBy: user.ID,
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+
+	tx := database.DB.Begin()
+	// Enabled 为 false 时 gorm 会使用默认值，创建后再写入
+	if err := tx.Create(&rule).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建过滤规则失败"})
+		return
+	}
+	if !rule.Enabled {
+		if err := tx.Model(&rule).UpdateColumn("enabled", false).Error; err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "创建过滤规则失败"})
+			return
+		}
+	}
+	if err := recordAudit(tx, c, models.AuditEntry{Action: models.AuditFilterRuleCreate, TargetType: models.AuditTargetFilterRule, TargetID: strconv.Itoa(int(rule.ID))}, nil, rule); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建过滤规则失败"})
+		return
+	}
+	if err := tx.Commit().Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建过滤规则失败"})
+		return
+	}
+	if !reloadFilterRules(c) {
+		return
+	}
+
+	c.JSON(http.StatusCreated, rule)
+}
+
+// UpdateFilterRule 修改内容过滤规则，仅管理员可用
+func UpdateFilterRule(c *gin.Context) {
+	if _, ok := requireAdmin(c, "只有管理员可以管理过滤规则"); !ok {
+		return
+	}
+
+	var rule models.FilterRule
+	if err := database.DB.First(&rule, "id = ?", c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "过滤规则不存在"})
+		return
+	}
+
+	var input filterRuleInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !input.validate(c) {
+		return
+	}
+
+	before := rule
+	updates := map[string]interface{}{
+		"pattern":    input.Pattern,
+		"is_regex":   input.IsRegex,
+		"action":     input.Action,
+		"note":       input.Note,
+		"updated_at": time.Now(),
+	}
+	if input.Enabled != nil {
+		updates["enabled"] = *input.Enabled
+	}
+
+	tx := database.DB.Begin()
+	if err := tx.Model(&rule).Updates(updates).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "修改过滤规则失败"})
+		return
+	}
+	if err := recordAudit(tx, c, models.AuditEntry{Action: models.AuditFilterRuleUpdate, TargetType: models.AuditTargetFilterRule, TargetID: strconv.Itoa(int(rule.ID))}, before, rule); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "修改过滤规则失败"})
+		return
+	}
+	if err := tx.Commit().Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "修改过滤规则失败"})
+		return
+	}
+	if !reloadFilterRules(c) {
+		return
+	}
+
+	c.JSON(http.StatusOK, rule)
+}
+
+// DeleteFilterRule 删除内容过滤规则，仅管理员可用
+func DeleteFilterRule(c *gin.Context) {
+	if _, ok := requireAdmin(c, "只有管理员可以管理过滤规则"); !ok {
+		return
+	}
+
+	var rule models.FilterRule
+	if err := database.DB.First(&rule, "id = ?", c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "过滤规则不存在"})
+		return
+	}
+
+	tx := database.DB.Begin()
+	if err := tx.Delete(&rule).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "删除过滤规则失败"})
+		return
+	}
+	if err := recordAudit(tx, c, models.AuditEntry{Action: models.AuditFilterRuleDelete, TargetType: models.AuditTargetFilterRule, TargetID: strconv.Itoa(int(rule.ID))}, rule, nil); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "删除过滤规则失败"})
+		return
+	}
+	if err := tx.Commit().Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "删除过滤规则失败"})
+		return
+	}
+	if !reloadFilterRules(c) {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "过滤规则已删除"})
+}
+
+// TestFilter 检查文本会如何被过滤。提供 pattern 时只试用该规则，否则使用当前启用的所有规则，仅管理员可用
+func TestFilter(c *gin.Context) {
+	if _, ok := requireAdmin(c, "只有管理员可以管理过滤规则"); !ok {
+		return
+	}
+
+	var input struct {
+		Text    string `json:"text" binding:"required"`
+		Pattern string `json:"pattern"`
+		IsRegex bool   `json:"is_regex"`
+		Action  string `json:"action"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if input.Pattern == "" {
+		c.JSON(http.StatusOK, filter.Check(input.Text))
+		return
+	}
+	if input.Action == "" {
+		input.Action = models.FilterActionMask
+	}
+	rule := filterRuleInput{Pattern: input.Pattern, IsRegex: input.IsRegex, Action: input.Action}
+	if !rule.validate(c) {
+		return
+	}
+	result, _ := filter.Test(models.FilterRule{Pattern: input.Pattern, IsRegex: input.IsRegex, Action: input.Action}, input.Text)
+	c.JSON(http.StatusOK, result)
+}
@@ -0,0 +1,316 @@
+package controllers
+
+import (
+	"math"
+	"net/http"
+	"time"
+	"vote-demo/database"
+	"vote-demo/events"
+	"vote-demo/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// probabilityTolerance 概率之和允许的误差
+const probabilityTolerance = 1e-6
+
+// minLogProbability 计算对数分数时概率的下限，避免 ln(0)
+const minLogProbability = 1e-4
+
+// CalibrationBucket 校准分组：预测概率落在 [Lower, Upper) 区间的选项实际发生的频率
+type CalibrationBucket struct {
+	Lower           float64 `json:"lower"`
+	Upper           float64 `json:"upper"`
+	Count           int     `json:"count"`
+	MeanProbability float64 `json:"mean_probability"`
+	ObservedRate    float64 `json:"observed_rate"`
+}
+
+// castForecastVote 处理预测投票，新的预测会整体替换用户之前的预测。
+// 概率为 0 的选项不记录投票，未给出或未记录的选项概率视为 0
+func castForecastVote(by actor, poll models.Poll, userID string, probabilities map[string]float64) (gin.H, error) {
+	if len(probabilities) == 0 {
+		return nil, badRequest("未给出任何概率")
+	}
+
+	sum := 0.0
+	for _, p := range probabilities {
+		if p < 0 || p > 1 {
+			return nil, badRequest("概率必须在 0 到 1 之间")
+		}
+		sum += p
+	}
+	if math.Abs(sum-1) > probabilityTolerance {
+		return nil, &requestError{Status: http.StatusBadRequest, Body: gin.H{"error": "各选项的概率之和必须为 1", "sum": sum}}
+	}
+
+	var options []models.Option
+	database.DB.Where("poll_id = ?", poll.ID).Find(&options)
+
+	known := make(map[string]bool)
+	for _, option := range options {
+		known[option.ID] = true
+	}
+	for optionID := range probabilities {
+		if !known[optionID] {
+			return nil, badRequest("选项不存在或不属于该投票")
+		}
+	}
+
+	// 删除之前的预测并写入新的预测
+	tx := database.DB.Begin()
+	previous, err := deleteUserVotes(tx, poll.ID, userID)
+	if err != nil {
+		tx.Rollback()
+		return nil, errVoteFailed
+	}
+
+	var votes []models.Vote
+	for _, option := range options {
+		if probabilities[option.ID] == 0 {
+			continue
+		}
+		vote := models.Vote{
+			PollID:      poll.ID,
+			OptionID:    option.ID,
+			UserID:      userID,
+			Probability: probabilities[option.ID],
+			CreatedAt:   time.Now(),
+		}
+		if err := tx.Create(&vote).Error; err != nil {
+			tx.Rollback()
+			return nil, errVoteFailed
+		}
+		votes = append(votes, vote)
+	}
+
+	if err := recordVoteCast(tx, by, poll.ID, userID, previous, votes); err != nil {
+		tx.Rollback()
+		return nil, errVoteFailed
+	}
+	if err := tx.Commit().Error; err != nil {
+		return nil, errVoteFailed
+	}
+	events.Notify()
+
+	return gin.H{
+		"message": "投票成功",
+		"votes":   votes,
+	}, nil
+}
+
+// forecasterCount 统计投票的预测者人数
+func forecasterCount(pollID string) int {
+	var count int
+	database.DB.Model(&models.Vote{}).
+		Where("poll_id = ?", pollID).
+		Select("COUNT(DISTINCT user_id)").
+		Row().
+		Scan(&count)
+	return count
+}
+
+// meanProbability 统计 forecasters 位预测者为选项给出的平均概率，没有记录的预测者概率按 0 计算
+func meanProbability(optionID string, forecasters int) float64 {
+	if forecasters == 0 {
+		return 0
+	}
+	var sum float64
+	database.DB.Model(&models.Vote{}).
+		Where("option_id = ?", optionID).
+		Select("COALESCE(SUM(probability), 0)").
+		Row().
+		Scan(&sum)
+	return sum / float64(forecasters)
+}
+
+// forecastScore 计算一位预测者的 Brier 分数和对数分数，forecast 中没有的选项概率视为 0
+func forecastScore(options []models.Option, forecast map[string]float64, outcomeID string) (brier, logScore float64) {
+	for _, option := range options {
+		outcome := 0.0
+		if option.ID == outcomeID {
+			outcome = 1
+		}
+		diff := forecast[option.ID] - outcome
+		brier += diff * diff
+	}
+	return brier, math.Log(math.Max(forecast[outcomeID], minLogProbability))
+}
+
+// ResolvePoll 结算预测投票，记录实际结果并计算每位预测者的 Brier 分数和对数分数
+func ResolvePoll(c *gin.Context) {
+	pollID := c.Param("id")
+
+	var poll models.Poll
+	if err := database.DB.Preload("Options").First(&poll, "id = ?", pollID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "投票不存在"})
+		return
+	}
+
+	if poll.Type != models.PollTypeForecast {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "该投票不是预测投票"})
+		return
+	}
+
+	// 只有投票创建者或管理员可以结算
+	user, ok := currentUser(c)
+	if !ok || !canManagePoll(user, poll) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "只有投票创建者或管理员可以结算投票"})
+		return
+	}
+
+	if poll.ResolvedAt != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "投票已结算"})
+		return
+	}
+
+	var input struct {
+		OptionID string `json:"option_id" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	outcomeValid := false
+	for _, option := range poll.Options {
+		if option.ID == input.OptionID {
+			outcomeValid = true
+		}
+	}
+	if !outcomeValid {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "选项不存在或不属于该投票"})
+		return
+	}
+
+	// 按预测者汇总各选项的概率，没有记录的选项概率为 0
+	var votes []models.Vote
+	database.DB.Where("poll_id = ?", pollID).Find(&votes)
+
+	forecasts := make(map[string]map[string]float64)
+	var forecasters []string
+	for _, vote := range votes {
+		if forecasts[vote.UserID] == nil {
+			forecasts[vote.UserID] = make(map[string]float64)
+			forecasters = append(forecasters, vote.UserID)
+		}
+		forecasts[vote.UserID][vote.OptionID] = vote.Probability
+	}
+
+	// 结算投票并写入得分，结算后投票关闭。只有 resolved_at 仍为空时才结算，并发的结算请求只有一个成功
+	now := time.Now()
+	before := poll
+	tx := database.DB.Begin()
+	updates := map[string]interface{}{
+		"resolved_option_id": input.OptionID,
+		"resolved_at":        now,
+		"is_active":          false,
+		"updated_at":         now,
+	}
+	if poll.ClosedAt == nil {
+		updates["closed_at"] = now
+	}
+	result := tx.Model(&models.Poll{}).Where("id = ? AND resolved_at IS NULL", pollID).Updates(updates)
+	if result.Error != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "结算投票失败"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		tx.Rollback()
+		c.JSON(http.StatusBadRequest, gin.H{"error": "投票已结算"})
+		return
+	}
+
+	var scores []models.ForecastScore
+	for _, forecasterID := range forecasters {
+		brier, logScore := forecastScore(poll.Options, forecasts[forecasterID], input.OptionID)
+		score := models.ForecastScore{
+			PollID:      pollID,
+			UserID:      forecasterID,
+			Probability: forecasts[forecasterID][input.OptionID],
+			Brier:       brier,
+			LogScore:    logScore,
+			CreatedAt:   now,
+		}
+		if err := tx.Create(&score).Error; err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "结算投票失败"})
+			return
+		}
+		scores = append(scores, score)
+	}
+
+	tx.Preload("Options").First(&poll, "id = ?", pollID)
+	if err := recordAudit(tx, c, models.AuditEntry{Action: models.AuditPollResolve, TargetType: models.AuditTargetPoll, TargetID: pollID, PollID: pollID}, before, gin.H{"poll": poll, "scores": scores}); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "结算投票失败"})
+		return
+	}
+	if err := events.Record(tx, events.PollUpdated{Before: before, Poll: poll}, events.PollClosed{Poll: poll}); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "结算投票失败"})
+		return
+	}
+	if err := tx.Commit().Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "结算投票失败"})
+		return
+	}
+	events.Notify()
+
+	c.JSON(http.StatusOK, gin.H{
+		"poll":   poll,
+		"scores": scores,
+	})
+}
+
+// userCalibration 根据用户在已结算预测投票中给出的所有概率计算校准分组
+func userCalibration(userID string) []CalibrationBucket {
+	const bucketCount = 10
+
+	buckets := make([]CalibrationBucket, bucketCount)
+	sums := make([]float64, bucketCount)
+	hits := make([]int, bucketCount)
+	for i := range buckets {
+		buckets[i].Lower = float64(i) / bucketCount
+		buckets[i].Upper = float64(i+1) / bucketCount
+	}
+
+	// 用户参与预测的已结算投票，没有记录投票的选项概率为 0，同样计入校准分组
+	var polls []models.Poll
+	database.DB.Preload("Options").
+		Where("type = ? AND resolved_at IS NOT NULL", models.PollTypeForecast).
+		Where("id IN (?)", database.DB.Model(&models.Vote{}).Where("user_id = ?", userID).Select("poll_id").QueryExpr()).
+		Find(&polls)
+
+	for _, poll := range polls {
+		var votes []models.Vote
+		database.DB.Where("poll_id = ? AND user_id = ?", poll.ID, userID).Find(&votes)
+		forecast := make(map[string]float64)
+		for _, vote := range votes {
+			forecast[vote.OptionID] = vote.Probability
+		}
+
+		for _, option := range poll.Options {
+			probability := forecast[option.ID]
+			i := int(probability * bucketCount)
+			if i >= bucketCount {
+				i = bucketCount - 1
+			}
+			buckets[i].Count++
+			sums[i] += probability
+			if poll.ResolvedOptionID == option.ID {
+				hits[i]++
+			}
+		}
+	}
+
+	for i := range buckets {
+		if buckets[i].Count > 0 {
+			buckets[i].MeanProbability = sums[i] / float64(buckets[i].Count)
+			buckets[i].ObservedRate = float64(hits[i]) / float64(buckets[i].Count)
+		}
+	}
+	return buckets
+}
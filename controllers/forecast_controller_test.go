@@ -0,0 +1,41 @@
+package controllers
+
+import (
+	"math"
+	"testing"
+	"vote-demo/models"
+)
+
+func TestForecastScore(t *testing.T) {
+	options := []models.Option{{ID: "yes"}, {ID: "no"}, {ID: "maybe"}}
+
+	tests := []struct {
+		name      string
+		forecast  map[string]float64
+		outcome   string
+		wantBrier float64
+		wantLog   float64
+	}{
+		{"certain and correct", map[string]float64{"yes": 1}, "yes", 0, 0},
+		{"certain and wrong", map[string]float64{"no": 1}, "yes", 2, math.Log(minLogProbability)},
+		{"uniform", map[string]float64{"yes": 1.0 / 3, "no": 1.0 / 3, "maybe": 1.0 / 3}, "maybe", 2.0 / 3, math.Log(1.0 / 3)},
+		{"split between two", map[string]float64{"yes": 0.5, "no": 0.5}, "no", 0.5, math.Log(0.5)},
+		{"mostly correct", map[string]float64{"yes": 0.8, "no": 0.2}, "yes", 0.08, math.Log(0.8)},
+		{"probability below the floor", map[string]float64{"yes": minLogProbability / 10, "no": 1 - minLogProbability/10}, "yes", 2 * math.Pow(1-minLogProbability/10, 2), math.Log(minLogProbability)},
+		{"no forecast", map[string]float64{}, "yes", 1, math.Log(minLogProbability)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			brier, logScore := forecastScore(options, tt.forecast, tt.outcome)
+			if math.Abs(brier-tt.wantBrier) > 1e-9 {
+				t.Errorf("brier = %v, want %v", brier, tt.wantBrier)
+			}
+			if math.Abs(logScore-tt.wantLog) > 1e-9 {
+				t.Errorf("log score = %v, want %v", logScore, tt.wantLog)
+			}
+			if math.IsInf(logScore, 0) || math.IsNaN(logScore) {
+				t.Errorf("log score = %v, want a finite value", logScore)
+			}
+		})
+	}
+}
@@ -0,0 +1,155 @@
+package controllers
+
+import (
+	"net/http"
+	"time"
+	"vote-demo/database"
+	"vote-demo/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+)
+
+// recordPollRevision 在事务中将投票当前的标题和描述保存为一个版本
+func recordPollRevision(tx *gorm.DB, poll models.Poll, editorID string) error {
+	revision := models.PollRevision{
+		PollID:      poll.ID,
+		Version:     poll.Version,
+		Title:       poll.Title,
+		Description: poll.Description,
+		EditorID:    editorID,
+		CreatedAt:   time.Now(),
+	}
+	return tx.Create(&revision).Error
+}
+
+// recordOptionRevision 在事务中将选项当前的内容保存为一个版本
+func recordOptionRevision(tx *gorm.DB, option models.Option, editorID string) error {
+	var voteCount int
+	tx.Model(&models.Vote{}).Where("option_id = ?", option.ID).Count(&voteCount)
+
+	revision := models.OptionRevision{
+		OptionID:  option.ID,
+		PollID:    option.PollID,
+		Version:   option.Version,
+		Text:      option.Text,
+		VoteCount: voteCount,
+		EditorID:  editorID,
+		CreatedAt: time.Now(),
+	}
+	return tx.Create(&revision).Error
+}
+
+// ensurePollRevision 旧数据没有版本记录时，先将修改前的内容补记为一个版本
+func ensurePollRevision(tx *gorm.DB, poll models.Poll) error {
+	var count int
+	tx.Model(&models.PollRevision{}).Where("poll_id = ?", poll.ID).Count(&count)
+	if count > 0 {
+		return nil
+	}
+	return recordPollRevision(tx, poll, poll.CreatorID)
+}
+
+// ensureOptionRevision 旧数据没有版本记录时，先将修改前的内容补记为一个版本
+func ensureOptionRevision(tx *gorm.DB, option models.Option) error {
+	var count int
+	tx.Model(&models.OptionRevision{}).Where("option_id = ?", option.ID).Count(&count)
+	if count > 0 {
+		return nil
+	}
+	return recordOptionRevision(tx, option, "")
+}
+
+// optionsLocked 投票创建者锁定了选项且已经有人投票
+func optionsLocked(poll models.Poll) bool {
+	if !poll.LockOptions {
+		return false
+	}
+	var count int
+	database.DB.Model(&models.Vote{}).Where("poll_id = ?", poll.ID).Count(&count)
+	return count > 0
+}
+
+// GetPollHistory 获取投票标题、描述和各选项内容的修改历史
+func GetPollHistory(c *gin.Context) {
+	pollID := c.Param("id")
+
+	var poll models.Poll
+	if err := database.DB.First(&poll, "id = ?", pollID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "投票不存在"})
+		return
+	}
+
+	var pollRevisions []models.PollRevision
+	database.DB.Where("poll_id = ?", pollID).Order("version ASC").Find(&pollRevisions)
+
+	var optionRevisions []models.OptionRevision
+	database.DB.Where("poll_id = ?", pollID).Order("created_at ASC, version ASC").Find(&optionRevisions)
+
+	// 按选项分组，包括已删除选项的历史
+	options := make(map[string][]models.OptionRevision)
+	for _, revision := range optionRevisions {
+		options[revision.OptionID] = append(options[revision.OptionID], revision)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"poll_id": pollID,
+		"version": poll.Version,
+		"poll":    pollRevisions,
+		"options": options,
+	})
+}
+
+// recordCommentRevision 在事务中将评论当前的内容保存为一个版本，在修改或删除评论前调用
+func recordCommentRevision(tx *gorm.DB, comment models.Comment) error {
+	createdAt := comment.CreatedAt
+	if comment.EditedAt != nil {
+		createdAt = *comment.EditedAt
+	}
+	revision := models.CommentRevision{
+		CommentID:  comment.ID,
+		PollID:     comment.PollID,
+		Version:    comment.EditCount + 1,
+		Content:    comment.Content,
+		CreatedAt:  createdAt,
+		ReplacedAt: time.Now(),
+	}
+	return tx.Create(&revision).Error
+}
+
+// GetCommentHistory 获取评论的修改历史，仅评论作者和可以审核该投票评论的用户可用
+func GetCommentHistory(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未提供有效的用户ID"})
+		return
+	}
+
+	var comment models.Comment
+	if err := database.DB.First(&comment, "id = ? AND poll_id = ?", c.Param("comment_id"), c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "评论不存在"})
+		return
+	}
+
+	var poll models.Poll
+	if err := database.DB.First(&poll, "id = ?", comment.PollID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "投票不存在"})
+		return
+	}
+	if comment.UserID != user.ID && !canModerate(user, poll) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "无权查看该评论的修改历史"})
+		return
+	}
+
+	revisions := []models.CommentRevision{}
+	database.DB.Where("comment_id = ?", comment.ID).Order("version ASC").Find(&revisions)
+
+	c.JSON(http.StatusOK, gin.H{
+		"comment_id": comment.ID,
+		"edit_count": comment.EditCount,
+		"is_deleted": comment.IsDeleted,
+		"current":    comment.Content,
+		"edited_at":  comment.EditedAt,
+		"revisions":  revisions,
+	})
+}
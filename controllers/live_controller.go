@@ -0,0 +1,331 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+	"vote-demo/database"
+	"vote-demo/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+// 实时房间推送给客户端的事件类型
+const (
+	LiveEventResults        = "results_updated" // 投票结果变化（有人投票或选项变化）
+	LiveEventCommentAdded   = "comment_added"
+	LiveEventCommentUpdated = "comment_updated"
+	LiveEventCommentDeleted = "comment_deleted"
+	LiveEventCommentReacted = "comment_reacted" // 评论的反应数量变化
+	LiveEventOptionAdded    = "option_added"
+	LiveEventOptionUpdated  = "option_updated"
+	LiveEventOptionDeleted  = "option_deleted"
+	LiveEventPollUpdated    = "poll_updated" // 投票信息或状态变化
+	LiveEventPollDeleted    = "poll_deleted"
+)
+
+const (
+	liveSendBuffer   = 64               // 每个连接待发送消息的缓冲数量，写满说明客户端过慢，连接会被断开
+	liveWriteTimeout = 10 * time.Second // 单条消息的写超时
+	livePongTimeout  = 60 * time.Second // 超过该时间没有收到 pong 则认为连接已断开
+	livePingInterval = 30 * time.Second
+	liveMaxMessage   = 64 * 1024 // 客户端消息的最大字节数
+)
+
+// LiveEvent 实时房间中推送给客户端的事件，Seq 在同一投票内严格递增
+type LiveEvent struct {
+	Seq    uint64      `json:"seq"`
+	Type   string      `json:"type"`
+	PollID string      `json:"poll_id"`
+	Data   interface{} `json:"data"`
+	Time   time.Time   `json:"time"`
+}
+
+// liveClient 一个 WebSocket 连接
+type liveClient struct {
+	pollID    string
+	userID    string
+	requestID string // 建立连接的请求ID，写入该连接上请求的审计记录
+	conn      *websocket.Conn
+	send      chan []byte
+	once      sync.Once
+}
+
+// close 关闭发送通道，写协程随后关闭连接
+func (client *liveClient) close() {
+	client.once.Do(func() {
+		close(client.send)
+	})
+}
+
+// liveHub 按投票管理实时房间的订阅，并按提交顺序向订阅者推送事件
+type liveHub struct {
+	mu    sync.Mutex
+	seqs  map[string]uint64
+	rooms map[string]map[*liveClient]bool
+}
+
+var hub = &liveHub{
+	seqs:  make(map[string]uint64),
+	rooms: make(map[string]map[*liveClient]bool),
+}
+
+// join 加入投票的实时房间
+func (h *liveHub) join(client *liveClient) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.rooms[client.pollID] == nil {
+		h.rooms[client.pollID] = make(map[*liveClient]bool)
+	}
+	h.rooms[client.pollID][client] = true
+}
+
+// leave 离开投票的实时房间
+func (h *liveHub) leave(client *liveClient) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.removeLocked(client)
+}
+
+func (h *liveHub) removeLocked(client *liveClient) {
+	delete(h.rooms[client.pollID], client)
+	if len(h.rooms[client.pollID]) == 0 {
+		delete(h.rooms, client.pollID)
+	}
+	client.close()
+}
+
+// hasSubscribers 投票的实时房间中是否有连接，没有连接时可以跳过构造事件数据
+func (h *liveHub) hasSubscribers(pollID string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return len(h.rooms[pollID]) > 0
+}
+
+// publish 向投票的实时房间推送事件。事件在锁内编号并放入各连接的发送队列，
+// 因此所有连接收到的事件顺序与调用顺序（即写操作提交的顺序）一致；
+// 发送队列已满的连接会被断开，而不是跳过事件，避免客户端看到不完整的序列
+func (h *liveHub) publish(pollID, eventType string, data interface{}) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.seqs[pollID]++
+	message, err := json.Marshal(LiveEvent{
+		Seq:    h.seqs[pollID],
+		Type:   eventType,
+		PollID: pollID,
+		Data:   data,
+		Time:   time.Now(),
+	})
+	if err != nil {
+		return
+	}
+
+	for client := range h.rooms[pollID] {
+		select {
+		case client.send <- message:
+		default:
+			h.removeLocked(client)
+		}
+	}
+
+	// 投票删除后关闭房间内的所有连接
+	if eventType == LiveEventPollDeleted {
+		for client := range h.rooms[pollID] {
+			h.removeLocked(client)
+		}
+		delete(h.seqs, pollID)
+	}
+}
+
+// publishLiveEvent 在写操作提交后调用，向投票的实时房间推送事件
+func publishLiveEvent(pollID, eventType string, data interface{}) {
+	hub.publish(pollID, eventType, data)
+}
+
+// publishLiveResults 向实时房间推送最新的投票结果
+func publishLiveResults(pollID string) {
+	if !hub.hasSubscribers(pollID) {
+		return
+	}
+
+	var poll models.Poll
+	if err := database.DB.Preload("Options").First(&poll, "id = ?", pollID).Error; err != nil {
+		return
+	}
+	hub.publish(pollID, LiveEventResults, pollResults(poll))
+}
+
+// liveRequest 客户端通过 WebSocket 发送的请求
+type liveRequest struct {
+	RequestID string          `json:"request_id"` // 客户端自定义的请求ID，会在响应中原样返回
+	Type      string          `json:"type"`       // vote 或 comment
+	Payload   json.RawMessage `json:"payload"`    // 与对应 HTTP 接口的请求体相同
+}
+
+// liveResponse 对客户端请求的响应
+type liveResponse struct {
+	Type      string          `json:"type"` // ack 或 error
+	RequestID string          `json:"request_id,omitempty"`
+	Status    int             `json:"status"`
+	Data      json.RawMessage `json:"data,omitempty"`
+}
+
+var liveUpgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+	// 与 CORS 设置保持一致，允许任意来源
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+// handleLiveRequest 处理客户端通过 WebSocket 发送的投票和评论请求，与 HTTP 接口共用同一套验证和写入逻辑
+func (client *liveClient) handleLiveRequest(request liveRequest) liveResponse {
+	response := liveResponse{RequestID: request.RequestID}
+
+	if client.userID == "" {
+		response.Type = "error"
+		response.Status = http.StatusBadRequest
+		response.Data, _ = json.Marshal(gin.H{"error": "未提供用户ID"})
+		return response
+	}
+
+	// 审计记录的请求ID由连接的请求ID和客户端自定义的请求ID组成
+	by := actor{UserID: client.userID, RequestID: client.requestID}
+	if request.RequestID != "" {
+		by.RequestID += "/" + request.RequestID
+	}
+
+	var result interface{}
+	var err error
+	switch request.Type {
+	case "vote":
+		var input voteInput
+		if err = decodeInput(request.Payload, &input); err == nil {
+			result, err = castVote(by, client.pollID, input)
+		}
+	case "comment":
+		var input commentInput
+		if err = decodeInput(request.Payload, &input); err == nil {
+			result, err = addComment(by, client.pollID, input)
+		}
+	default:
+		err = badRequest("不支持的请求类型")
+	}
+
+	if err != nil {
+		var body gin.H
+		response.Type = "error"
+		response.Status, body = failure(err)
+		response.Data, _ = json.Marshal(body)
+		return response
+	}
+	response.Type = "ack"
+	response.Status = http.StatusCreated
+	response.Data, _ = json.Marshal(result)
+	return response
+}
+
+// writePump 将发送队列中的消息写入连接，并定期发送 ping
+func (client *liveClient) writePump() {
+	ticker := time.NewTicker(livePingInterval)
+	defer func() {
+		ticker.Stop()
+		client.conn.Close()
+	}()
+
+	for {
+		select {
+		case message, ok := <-client.send:
+			client.conn.SetWriteDeadline(time.Now().Add(liveWriteTimeout))
+			if !ok {
+				client.conn.WriteMessage(websocket.CloseMessage, []byte{})
+				return
+			}
+			if err := client.conn.WriteMessage(websocket.TextMessage, message); err != nil {
+				return
+			}
+		case <-ticker.C:
+			client.conn.SetWriteDeadline(time.Now().Add(liveWriteTimeout))
+			if err := client.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// JoinLiveRoom 建立投票实时房间的 WebSocket 连接
+func JoinLiveRoom(c *gin.Context) {
+	pollID := c.Param("id")
+
+	var poll models.Poll
+	if err := database.DB.First(&poll, "id = ?", pollID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "投票不存在"})
+		return
+	}
+
+	// 浏览器无法为 WebSocket 设置请求头，也可以通过 user_id 查询参数提供用户ID
+	userID := c.GetHeader("User-ID")
+	if userID == "" {
+		userID = c.Query("user_id")
+	}
+	if userID != "" {
+		var user models.User
+		if err := database.DB.First(&user, "id = ?", userID).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "用户不存在"})
+			return
+		}
+	}
+
+	conn, err := liveUpgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		return
+	}
+
+	client := &liveClient{
+		pollID:    pollID,
+		userID:    userID,
+		requestID: requestID(c),
+		conn:      conn,
+		send:      make(chan []byte, liveSendBuffer),
+	}
+	hub.join(client)
+	defer hub.leave(client)
+
+	go client.writePump()
+
+	// 读取客户端请求，请求按顺序处理
+	conn.SetReadLimit(liveMaxMessage)
+	conn.SetReadDeadline(time.Now().Add(livePongTimeout))
+	conn.SetPongHandler(func(string) error {
+		conn.SetReadDeadline(time.Now().Add(livePongTimeout))
+		return nil
+	})
+
+	for {
+		var request liveRequest
+		if err := conn.ReadJSON(&request); err != nil {
+			return
+		}
+
+		message, err := json.Marshal(client.handleLiveRequest(request))
+		if err != nil {
+			continue
+		}
+
+		// 通过发送队列回复，保证同一连接只有一个写协程
+		hub.mu.Lock()
+		if hub.rooms[pollID][client] {
+			select {
+			case client.send <- message:
+			default:
+				hub.removeLocked(client)
+			}
+		}
+		hub.mu.Unlock()
+	}
+}
@@ -0,0 +1,292 @@
+package controllers
+
+import (
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+	"vote-demo/database"
+	"vote-demo/events"
+	"vote-demo/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+)
+
+// DefaultReportThreshold 评论被自动隐藏前默认需要的举报数
+const DefaultReportThreshold = 3
+
+// reportThreshold 自动隐藏评论的举报数阈值，可通过环境变量 COMMENT_REPORT_THRESHOLD 配置
+func reportThreshold() int {
+	if value, err := strconv.Atoi(os.Getenv("COMMENT_REPORT_THRESHOLD")); err == nil && value > 0 {
+		return value
+	}
+	return DefaultReportThreshold
+}
+
+// moderationItem 审核队列中的评论及其未处理的举报
+type moderationItem struct {
+	models.Comment
+	ReportCount int                    `json:"report_count"`
+	Reports     []models.CommentReport `json:"reports"`
+}
+
+// ReportComment 举报评论。未处理的举报数达到阈值时评论会被自动隐藏，等待审核
+func ReportComment(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未提供有效的用户ID"})
+		return
+	}
+
+	var comment models.Comment
+	if err := database.DB.First(&comment, "id = ? AND poll_id = ? AND status = ?", c.Param("comment_id"), c.Param("id"), models.CommentVisible).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "评论不存在"})
+		return
+	}
+	if comment.IsDeleted {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "评论已删除"})
+		return
+	}
+	if comment.UserID == user.ID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "不能举报自己的评论"})
+		return
+	}
+
+	var input struct {
+		Reason string `json:"reason"`
+	}
+	// 举报理由是可选的
+	c.ShouldBindJSON(&input)
+
+	var existing models.CommentReport
+	if err := database.DB.First(&existing, "comment_id = ? AND reporter_id = ?", comment.ID, user.ID).Error; err == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "已经举报过该评论"})
+		return
+	}
+
+	report := models.CommentReport{
+		CommentID:  comment.ID,
+		ReporterID: user.ID,
+		PollID:     comment.PollID,
+		Reason:     input.Reason,
+		Status:     models.ReportOpen,
+		CreatedAt:  time.Now(),
+	}
+
+	tx := database.DB.Begin()
+	if err := tx.Create(&report).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusConflict, gin.H{"error": "已经举报过该评论"})
+		return
+	}
+	if err := recordAudit(tx, c, models.AuditEntry{Action: models.AuditCommentReport, TargetType: models.AuditTargetComment, TargetID: comment.ID, PollID: comment.PollID}, nil, report); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "举报评论失败"})
+		return
+	}
+
+	var reportCount int
+	tx.Model(&models.CommentReport{}).Where("comment_id = ? AND status = ?", comment.ID, models.ReportOpen).Count(&reportCount)
+	hidden := reportCount >= reportThreshold()
+	if hidden {
+		if err := setCommentStatus(tx, c, comment, models.CommentHidden, models.AuditCommentHide); err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "举报评论失败"})
+			return
+		}
+	}
+	if err := tx.Commit().Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "举报评论失败"})
+		return
+	}
+	events.Notify()
+
+	c.JSON(http.StatusCreated, gin.H{
+		"report":       report,
+		"report_count": reportCount,
+		"hidden":       hidden,
+	})
+}
+
+// setCommentStatus 在事务中修改评论的审核状态，并写入审计记录和事件
+func setCommentStatus(tx *gorm.DB, c *gin.Context, comment models.Comment, status, action string) error {
+	before := comment
+	if err := tx.Model(&comment).UpdateColumn("status", status).Error; err != nil {
+		return err
+	}
+	if err := recordAudit(tx, c, models.AuditEntry{Action: action, TargetType: models.AuditTargetComment, TargetID: comment.ID, PollID: comment.PollID}, before, comment); err != nil {
+		return err
+	}
+	return events.Record(tx, events.CommentModerated{Before: before, Comment: comment})
+}
+
+// resolveReports 在事务中将评论未处理的举报标记为已处理
+func resolveReports(tx *gorm.DB, commentID, moderatorID string) error {
+	return tx.Model(&models.CommentReport{}).
+		Where("comment_id = ? AND status = ?", commentID, models.ReportOpen).
+		Updates(map[string]interface{}{"status": models.ReportResolved, "resolved_by": moderatorID, "resolved_at": time.Now()}).Error
+}
+
+// ListModerationQueue 获取待审核的评论。
+// 默认返回等待审核、被自动隐藏和有未处理举报的评论，status 可以指定 pending、hidden、reported 或 removed。
+// 审核员和管理员可以查看所有投票，投票创建者需要通过 poll_id 指定自己的投票
+func ListModerationQueue(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未提供有效的用户ID"})
+		return
+	}
+
+	query := database.DB.Model(&models.Comment{})
+	if pollID := c.Query("poll_id"); pollID != "" {
+		var poll models.Poll
+		if err := database.DB.First(&poll, "id = ?", pollID).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "投票不存在"})
+			return
+		}
+		if !canModerate(user, poll) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "无权审核该投票的评论"})
+			return
+		}
+		query = query.Where("poll_id = ?", pollID)
+	} else if user.Role != models.RoleModerator && user.Role != models.RoleAdmin {
+		c.JSON(http.StatusForbidden, gin.H{"error": "只有审核员或管理员可以查看所有投票的审核队列"})
+		return
+	}
+
+	reported := database.DB.Model(&models.CommentReport{}).Select("comment_id").Where("status = ?", models.ReportOpen).QueryExpr()
+	switch status := c.Query("status"); status {
+	case "":
+		query = query.Where("status IN (?) OR (status = ? AND id IN (?))",
+			[]string{models.CommentPending, models.CommentHidden}, models.CommentVisible, reported)
+	case "reported":
+		query = query.Where("id IN (?)", reported)
+	case models.CommentPending, models.CommentHidden, models.CommentRemoved:
+		query = query.Where("status = ?", status)
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "status 必须是 pending、hidden、reported 或 removed"})
+		return
+	}
+
+	limit := 100
+	if value, err := strconv.Atoi(c.Query("limit")); err == nil && value > 0 && value <= 500 {
+		limit = value
+	}
+
+	var comments []models.Comment
+	query.Preload("User").Order("created_at ASC").Limit(limit).Find(&comments)
+
+	ids := make([]string, 0, len(comments))
+	for _, comment := range comments {
+		ids = append(ids, comment.ID)
+	}
+	reports := make(map[string][]models.CommentReport)
+	if len(ids) > 0 {
+		var rows []models.CommentReport
+		database.DB.Where("comment_id IN (?) AND status = ?", ids, models.ReportOpen).Order("created_at ASC").Find(&rows)
+		for _, report := range rows {
+			reports[report.CommentID] = append(reports[report.CommentID], report)
+		}
+	}
+
+	items := make([]moderationItem, 0, len(comments))
+	for _, comment := range comments {
+		item := moderationItem{Comment: comment, Reports: reports[comment.ID]}
+		if item.Reports == nil {
+			item.Reports = []models.CommentReport{}
+		}
+		item.ReportCount = len(item.Reports)
+		items = append(items, item)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"comments":         items,
+		"report_threshold": reportThreshold(),
+	})
+}
+
+// ApproveComment 审核通过评论：显示评论，并将未处理的举报标记为已处理
+func ApproveComment(c *gin.Context) {
+	moderateComment(c, models.CommentVisible, models.AuditCommentApprove, true)
+}
+
+// RemoveComment 移除评论，并将未处理的举报标记为已处理
+func RemoveComment(c *gin.Context) {
+	moderateComment(c, models.CommentRemoved, models.AuditCommentRemove, true)
+}
+
+// ReinstateComment 恢复被自动隐藏或移除的评论，不处理举报
+func ReinstateComment(c *gin.Context) {
+	moderateComment(c, models.CommentVisible, models.AuditCommentReinstate, false)
+}
+
+func moderateComment(c *gin.Context, status, action string, resolve bool) {
+	user, ok := currentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未提供有效的用户ID"})
+		return
+	}
+
+	var comment models.Comment
+	if err := database.DB.First(&comment, "id = ?", c.Param("comment_id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "评论不存在"})
+		return
+	}
+
+	var poll models.Poll
+	if err := database.DB.First(&poll, "id = ?", comment.PollID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "投票不存在"})
+		return
+	}
+	if !canModerate(user, poll) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "无权审核该投票的评论"})
+		return
+	}
+
+	switch action {
+	case models.AuditCommentApprove:
+		if comment.Status == models.CommentRemoved {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "评论已被移除，请使用恢复操作"})
+			return
+		}
+	case models.AuditCommentRemove:
+		if comment.Status == models.CommentRemoved {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "评论已被移除"})
+			return
+		}
+	case models.AuditCommentReinstate:
+		if comment.Status != models.CommentHidden && comment.Status != models.CommentRemoved {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "只能恢复被隐藏或移除的评论"})
+			return
+		}
+	}
+
+	tx := database.DB.Begin()
+	if resolve {
+		if err := resolveReports(tx, comment.ID, user.ID); err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "审核评论失败"})
+			return
+		}
+	}
+	if comment.Status != status {
+		if err := setCommentStatus(tx, c, comment, status, action); err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "审核评论失败"})
+			return
+		}
+	} else if err := recordAudit(tx, c, models.AuditEntry{Action: action, TargetType: models.AuditTargetComment, TargetID: comment.ID, PollID: comment.PollID}, comment, comment); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "审核评论失败"})
+		return
+	}
+	if err := tx.Commit().Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "审核评论失败"})
+		return
+	}
+	events.Notify()
+
+	comment.Status = status
+	c.JSON(http.StatusOK, comment)
+}
@@ -0,0 +1,335 @@
+package controllers
+
+import (
+	"net/http"
+	"net/mail"
+	"strconv"
+	"strings"
+	"time"
+	"vote-demo/database"
+	"vote-demo/email"
+	"vote-demo/models"
+	"vote-demo/notifications"
+
+	"github.com/gin-gonic/gin"
+)
+
+// unreadNotificationCount 用户的未读通知数
+func unreadNotificationCount(userID string) int {
+	var count int
+	database.DB.Model(&models.Notification{}).Where("user_id = ? AND read_at IS NULL", userID).Count(&count)
+	return count
+}
+
+// ListNotifications 获取当前用户的通知，最新的在前。
+// unread=true 只返回未读通知，before 为 RFC3339 时间，用于获取更早的通知
+func ListNotifications(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未提供有效的用户ID"})
+		return
+	}
+
+	query := database.DB.Where("user_id = ?", user.ID)
+	if c.Query("unread") == "true" {
+		query = query.Where("read_at IS NULL")
+	}
+	if value := c.Query("type"); value != "" {
+		if !models.ValidNotificationType(value) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的通知类型", "allowed": models.NotificationTypes})
+			return
+		}
+		query = query.Where("type = ?", value)
+	}
+	if value := c.Query("before"); value != "" {
+		before, err := time.Parse(time.RFC3339Nano, value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "before 必须是 RFC3339 格式的时间"})
+			return
+		}
+		// 数据库中的时间按服务器本地时区保存为字符串，比较前转换为相同的时区
+		query = query.Where("created_at < ?", before.Local())
+	}
+
+	limit := 50
+	if value, err := strconv.Atoi(c.Query("limit")); err == nil && value > 0 && value <= 200 {
+		limit = value
+	}
+
+	var items []models.Notification
+	query.Preload("Actor").Order("created_at DESC").Limit(limit).Find(&items)
+
+	// 补充投票标题，已删除的投票没有标题
+	var pollIDs []string
+	for _, item := range items {
+		if item.PollID != "" {
+			pollIDs = append(pollIDs, item.PollID)
+		}
+	}
+	titles := make(map[string]string)
+	if len(pollIDs) > 0 {
+		var polls []models.Poll
+		database.DB.Select("id, title").Where("id IN (?)", pollIDs).Find(&polls)
+		for _, poll := range polls {
+			titles[poll.ID] = poll.Title
+		}
+	}
+	for i := range items {
+		items[i].PollTitle = titles[items[i].PollID]
+	}
+	if items == nil {
+		items = []models.Notification{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"notifications": items,
+		"unread_count":  unreadNotificationCount(user.ID),
+	})
+}
+
+// MarkNotificationRead 将当前用户的一条通知标记为已读
+func MarkNotificationRead(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未提供有效的用户ID"})
+		return
+	}
+
+	var notification models.Notification
+	if err := database.DB.First(&notification, "id = ? AND user_id = ?", c.Param("id"), user.ID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "通知不存在"})
+		return
+	}
+	if notification.ReadAt == nil {
+		now := time.Now()
+		if err := database.DB.Model(&notification).UpdateColumn("read_at", now).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "标记通知失败"})
+			return
+		}
+		notification.ReadAt = &now
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"notification": notification,
+		"unread_count": unreadNotificationCount(user.ID),
+	})
+}
+
+// MarkAllNotificationsRead 将当前用户的所有未读通知标记为已读
+func MarkAllNotificationsRead(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未提供有效的用户ID"})
+		return
+	}
+
+	result := database.DB.Model(&models.Notification{}).
+		Where("user_id = ? AND read_at IS NULL", user.ID).
+		UpdateColumn("read_at", time.Now())
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "标记通知失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"marked": result.RowsAffected, "unread_count": 0})
+}
+
+// notificationPreferences 用户各类通知的设置，未设置的类型默认接收
+func notificationPreferences(userID string) map[string]bool {
+	preferences := make(map[string]bool, len(models.NotificationTypes))
+	for _, kind := range models.NotificationTypes {
+		preferences[kind] = notifications.Enabled(userID, kind)
+	}
+	return preferences
+}
+
+// GetNotificationPreferences 获取当前用户的通知设置
+func GetNotificationPreferences(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未提供有效的用户ID"})
+		return
+	}
+
+	c.JSON(http.StatusOK, notificationPreferences(user.ID))
+}
+
+// UpdateNotificationPreferences 修改当前用户的通知设置，请求体为通知类型到是否接收的映射，未提供的类型保持不变
+func UpdateNotificationPreferences(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未提供有效的用户ID"})
+		return
+	}
+
+	var input map[string]bool
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	for kind := range input {
+		if !models.ValidNotificationType(kind) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的通知类型: " + kind, "allowed": models.NotificationTypes})
+			return
+		}
+	}
+
+	before := notificationPreferences(user.ID)
+	after := make(map[string]bool, len(before))
+	for kind, enabled := range before {
+		after[kind] = enabled
+	}
+
+	tx := database.DB.Begin()
+	for kind, enabled := range input {
+		preference := models.NotificationPreference{UserID: user.ID, Type: kind}
+		if err := tx.Where(preference).Assign(map[string]interface{}{"enabled": enabled, "updated_at": time.Now()}).FirstOrCreate(&preference).Error; err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "修改通知设置失败"})
+			return
+		}
+		after[kind] = enabled
+	}
+	if err := recordAudit(tx, c, models.AuditEntry{Action: models.AuditNotificationPreferenceUpdate, TargetType: models.AuditTargetUser, TargetID: user.ID}, before, after); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "修改通知设置失败"})
+		return
+	}
+	if err := tx.Commit().Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "修改通知设置失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, notificationPreferences(user.ID))
+}
+
+// emailSettings 用户的邮件通知设置，enabled 表示服务是否配置了邮件发送方式
+func emailSettings(user models.User) gin.H {
+	types := make(map[string]bool, len(models.EmailNotificationTypes))
+	for _, kind := range models.EmailNotificationTypes {
+		types[kind] = notifications.EmailEnabled(user.ID, kind)
+	}
+	language := user.Language
+	if language == "" {
+		language = email.LanguageZh
+	}
+	return gin.H{
+		"email":    user.Email,
+		"language": language,
+		"digest":   user.EmailDigest,
+		"types":    types,
+		"enabled":  email.Enabled(),
+	}
+}
+
+// GetEmailSettings 获取当前用户的邮件通知设置
+func GetEmailSettings(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未提供有效的用户ID"})
+		return
+	}
+
+	c.JSON(http.StatusOK, emailSettings(user))
+}
+
+// UpdateEmailSettings 修改当前用户的邮件通知设置，未提供的字段保持不变。email 为空字符串时不再发送邮件
+func UpdateEmailSettings(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未提供有效的用户ID"})
+		return
+	}
+
+	var input struct {
+		Email    *string         `json:"email"`
+		Language *string         `json:"language"`
+		Digest   *bool           `json:"digest"`
+		Types    map[string]bool `json:"types"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	updates := make(map[string]interface{})
+	if input.Email != nil {
+		address := strings.TrimSpace(*input.Email)
+		if address != "" {
+			parsed, err := mail.ParseAddress(address)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "无效的邮件地址"})
+				return
+			}
+			address = parsed.Address
+		}
+		updates["email"] = address
+	}
+	if input.Language != nil {
+		if !email.ValidLanguage(*input.Language) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的语言", "allowed": []string{email.LanguageZh, email.LanguageEn}})
+			return
+		}
+		updates["language"] = *input.Language
+	}
+	if input.Digest != nil {
+		updates["email_digest"] = *input.Digest
+	}
+	for kind := range input.Types {
+		if !models.ValidEmailNotificationType(kind) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "该类型不支持邮件通知: " + kind, "allowed": models.EmailNotificationTypes})
+			return
+		}
+	}
+
+	// 审计记录修改前后的设置，不包括服务是否配置了邮件发送方式
+	before := emailSettings(user)
+	delete(before, "enabled")
+	after := gin.H{"email": before["email"], "language": before["language"], "digest": before["digest"]}
+	types := make(map[string]bool)
+	for kind, enabled := range before["types"].(map[string]bool) {
+		types[kind] = enabled
+	}
+	after["types"] = types
+	for column, key := range map[string]string{"email": "email", "language": "language", "email_digest": "digest"} {
+		if value, ok := updates[column]; ok {
+			after[key] = value
+		}
+	}
+
+	tx := database.DB.Begin()
+	if len(updates) > 0 {
+		if err := tx.Model(&user).Updates(updates).Error; err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "修改邮件通知设置失败"})
+			return
+		}
+	}
+	for kind, enabled := range input.Types {
+		// 同时写入站内通知的当前设置，避免新建记录时被当作关闭
+		preference := models.NotificationPreference{UserID: user.ID, Type: kind}
+		assign := map[string]interface{}{
+			"enabled":    notifications.Enabled(user.ID, kind),
+			"email":      enabled,
+			"updated_at": time.Now(),
+		}
+		if err := tx.Where(preference).Assign(assign).FirstOrCreate(&preference).Error; err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "修改邮件通知设置失败"})
+			return
+		}
+		types[kind] = enabled
+	}
+	if err := recordAudit(tx, c, models.AuditEntry{Action: models.AuditEmailSettingsUpdate, TargetType: models.AuditTargetUser, TargetID: user.ID}, before, after); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "修改邮件通知设置失败"})
+		return
+	}
+	if err := tx.Commit().Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "修改邮件通知设置失败"})
+		return
+	}
+
+	database.DB.First(&user, "id = ?", user.ID)
+	c.JSON(http.StatusOK, emailSettings(user))
+}
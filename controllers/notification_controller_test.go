@@ -0,0 +1,62 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+	"vote-demo/database"
+	"vote-demo/models"
+)
+
+func TestListNotificationsBefore(t *testing.T) {
+	useLocalZone(t)
+	setupDB(t)
+
+	user := models.User{Username: "alice"}
+	database.DB.Create(&user)
+
+	// 数据库中的时间按本地时区（UTC+8）保存
+	base := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	for hour := 1; hour <= 4; hour++ {
+		notification := models.Notification{
+			UserID:    user.ID,
+			Type:      models.NotificationResults,
+			PollID:    fmt.Sprintf("poll-%d", hour),
+			CreatedAt: base.Add(time.Duration(hour) * time.Hour).Local(),
+		}
+		if err := database.DB.Create(&notification).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		before time.Time
+		want   int
+	}{
+		{"request offset west of server", base.Add(3 * time.Hour).In(time.FixedZone("UTC-5", -5*60*60)), 2},
+		{"request in UTC", base.Add(2 * time.Hour), 1},
+		{"request in server zone", base.Add(5 * time.Hour).Local(), 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query := url.Values{"before": {tt.before.Format(time.RFC3339Nano)}}
+			var response struct {
+				Notifications []models.Notification `json:"notifications"`
+			}
+			if code := serveJSON(t, ListNotifications, "/api/notifications?"+query.Encode(), user.ID, &response); code != http.StatusOK {
+				t.Fatalf("status = %d", code)
+			}
+			if len(response.Notifications) != tt.want {
+				t.Fatalf("got %d notifications, want %d", len(response.Notifications), tt.want)
+			}
+			for _, notification := range response.Notifications {
+				if !notification.CreatedAt.Before(tt.before) {
+					t.Errorf("notification created at %v is not before %v", notification.CreatedAt, tt.before)
+				}
+			}
+		})
+	}
+}
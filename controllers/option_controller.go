@@ -4,7 +4,9 @@ import (
 	"net/http"
 	"time"
 	"vote-demo/database"
+	"vote-demo/events"
 	"vote-demo/models"
+	"vote-demo/trash"
 
 	"github.com/gin-gonic/gin"
 )
@@ -26,8 +28,14 @@ func AddOption(c *gin.Context) {
 		return
 	}
 
+	if optionsLocked(poll) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "投票已开始，选项已被锁定"})
+		return
+	}
+
 	var input struct {
-		Text string `json:"text" binding:"required"`
+		Text string `json:"text"`
+		SlotInput
 	}
 
 	if err := c.ShouldBindJSON(&input); err != nil {
@@ -35,18 +43,56 @@ func AddOption(c *gin.Context) {
 		return
 	}
 
-	// 创建新选项
-	option := models.Option{
-		PollID:    pollID,
-		Text:      input.Text,
-		CreatedAt: time.Now(),
-		UpdatedAt: time.Now(),
+	// 创建新选项，时间安排投票的选项由时间段生成
+	option := models.Option{Text: input.Text}
+	if poll.Type == models.PollTypeSchedule {
+		slot, err := slotOption(input.SlotInput)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		option = slot
+		if !filterPollContent(c, &option.Text) {
+			return
+		}
+	} else if input.Text == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "选项内容不能为空"})
+		return
+	} else if !filterPollContent(c, &option.Text) {
+		return
 	}
 
-	if err := database.DB.Create(&option).Error; err != nil {
+	option.PollID = pollID
+	option.CreatedAt = time.Now()
+	option.UpdatedAt = time.Now()
+	option.Version = 1
+
+	tx := database.DB.Begin()
+	if err := tx.Create(&option).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建选项失败"})
+		return
+	}
+	if err := recordOptionRevision(tx, option, c.GetHeader("User-ID")); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建选项失败"})
+		return
+	}
+	if err := recordAudit(tx, c, models.AuditEntry{Action: models.AuditOptionCreate, TargetType: models.AuditTargetOption, TargetID: option.ID, PollID: pollID}, nil, option); err != nil {
+		tx.Rollback()
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建选项失败"})
 		return
 	}
+	if err := events.Record(tx, events.OptionAdded{Option: option}); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建选项失败"})
+		return
+	}
+	if err := tx.Commit().Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建选项失败"})
+		return
+	}
+	events.Notify()
 
 	c.JSON(http.StatusCreated, option)
 }
@@ -73,8 +119,14 @@ func UpdateOption(c *gin.Context) {
 		return
 	}
 
+	if optionsLocked(poll) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "投票已开始，选项已被锁定"})
+		return
+	}
+
 	var input struct {
-		Text string `json:"text" binding:"required"`
+		Text string `json:"text"`
+		SlotInput
 	}
 
 	if err := c.ShouldBindJSON(&input); err != nil {
@@ -82,19 +134,91 @@ func UpdateOption(c *gin.Context) {
 		return
 	}
 
-	// 更新选项
+	// 时间安排投票的选项文本由时间段生成，修改时提供新的时间段并重新生成文本
+	updated := models.Option{Text: input.Text}
+	if poll.Type == models.PollTypeSchedule {
+		if input.Text != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "时间安排投票的选项内容由时间段生成，请修改时间段"})
+			return
+		}
+		slot, err := slotOption(input.SlotInput)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		updated = slot
+	} else if input.Text == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "选项内容不能为空"})
+		return
+	}
+
+	if !filterPollContent(c, &updated.Text) {
+		return
+	}
+
+	before := option
+
+	// 更新选项，内容变化时生成新版本；已有人投票时标记为投票后被修改
 	updates := map[string]interface{}{
-		"text":       input.Text,
+		"text":       updated.Text,
 		"updated_at": time.Now(),
 	}
+	edited := updated.Text != option.Text
+	if poll.Type == models.PollTypeSchedule {
+		updates["starts_at"] = updated.StartsAt
+		updates["ends_at"] = updated.EndsAt
+		updates["timezone"] = updated.Timezone
+		edited = edited || !sameTime(updated.StartsAt, option.StartsAt) || !sameTime(updated.EndsAt, option.EndsAt) || updated.Timezone != option.Timezone
+	}
+
+	if edited {
+		var voteCount int
+		database.DB.Model(&models.Vote{}).Where("option_id = ?", option.ID).Count(&voteCount)
+		updates["version"] = option.Version + 1
+		if voteCount > 0 {
+			updates["edited_after_votes"] = true
+		}
+	}
 
-	if err := database.DB.Model(&option).Updates(updates).Error; err != nil {
+	tx := database.DB.Begin()
+	if edited {
+		if err := ensureOptionRevision(tx, before); err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "更新选项失败"})
+			return
+		}
+	}
+	if err := tx.Model(&option).Updates(updates).Error; err != nil {
+		tx.Rollback()
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新选项失败"})
 		return
 	}
 
 	// 返回更新后的选项
-	database.DB.First(&option, "id = ?", optionID)
+	tx.First(&option, "id = ?", optionID)
+	if edited {
+		if err := recordOptionRevision(tx, option, c.GetHeader("User-ID")); err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "更新选项失败"})
+			return
+		}
+	}
+	if err := recordAudit(tx, c, models.AuditEntry{Action: models.AuditOptionUpdate, TargetType: models.AuditTargetOption, TargetID: option.ID, PollID: option.PollID}, before, option); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新选项失败"})
+		return
+	}
+	if err := events.Record(tx, events.OptionUpdated{Before: before, Option: option}); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新选项失败"})
+		return
+	}
+	if err := tx.Commit().Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新选项失败"})
+		return
+	}
+	events.Notify()
+
 	c.JSON(http.StatusOK, option)
 }
 
@@ -102,6 +226,12 @@ func UpdateOption(c *gin.Context) {
 func DeleteOption(c *gin.Context) {
 	optionID := c.Param("option_id")
 
+	user, ok := currentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未提供有效的用户ID"})
+		return
+	}
+
 	var option models.Option
 	if err := database.DB.First(&option, "id = ?", optionID).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "选项不存在"})
@@ -115,11 +245,22 @@ func DeleteOption(c *gin.Context) {
 		return
 	}
 
+	// 与恢复相同，只有投票创建者或管理员可以删除
+	if !canManagePoll(user, poll) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "只有投票创建者或管理员可以删除选项"})
+		return
+	}
+
 	if poll.Type == models.PollTypeBinary {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "二分类型投票不允许删除选项"})
 		return
 	}
 
+	if optionsLocked(poll) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "投票已开始，选项已被锁定"})
+		return
+	}
+
 	// 检查剩余选项数量，至少保留两个选项
 	var count int
 	database.DB.Model(&models.Option{}).Where("poll_id = ?", option.PollID).Count(&count)
@@ -128,11 +269,30 @@ func DeleteOption(c *gin.Context) {
 		return
 	}
 
-	// 删除相关的投票记录
-	database.DB.Where("option_id = ?", optionID).Delete(&models.Vote{})
-	
-	// 删除选项
-	database.DB.Delete(&option)
+	// 将选项及其投票记录移入回收站，被删除的投票记录写入审计记录
+	tx := database.DB.Begin()
+	var votes []models.Vote
+	tx.Where("option_id = ?", optionID).Find(&votes)
+	if err := trashOption(tx, optionID, trash.Stamp()); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "删除选项失败"})
+		return
+	}
+	if err := recordAudit(tx, c, models.AuditEntry{Action: models.AuditOptionDelete, TargetType: models.AuditTargetOption, TargetID: option.ID, PollID: option.PollID}, gin.H{"option": option, "votes": votes}, nil); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "删除选项失败"})
+		return
+	}
+	if err := events.Record(tx, events.OptionDeleted{Option: option}); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "删除选项失败"})
+		return
+	}
+	if err := tx.Commit().Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "删除选项失败"})
+		return
+	}
+	events.Notify()
 
 	c.JSON(http.StatusOK, gin.H{"message": "选项已删除"})
-} 
\ No newline at end of file
+}
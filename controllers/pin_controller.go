@@ -0,0 +1,124 @@
+package controllers
+
+import (
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+	"vote-demo/database"
+	"vote-demo/events"
+	"vote-demo/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DefaultPinnedCommentLimit 每个投票默认最多置顶的评论数
+const DefaultPinnedCommentLimit = 3
+
+// pinnedCommentLimit 每个投票最多置顶的评论数，可通过环境变量 COMMENT_PIN_LIMIT 配置
+func pinnedCommentLimit() int {
+	if value, err := strconv.Atoi(os.Getenv("COMMENT_PIN_LIMIT")); err == nil && value > 0 {
+		return value
+	}
+	return DefaultPinnedCommentLimit
+}
+
+// findPinTarget 检查当前用户可以管理投票，并查找投票下显示中的根评论，失败时已写入错误响应
+func findPinTarget(c *gin.Context) (models.Poll, models.Comment, bool) {
+	var poll models.Poll
+	var comment models.Comment
+
+	user, ok := currentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未提供有效的用户ID"})
+		return poll, comment, false
+	}
+	if err := database.DB.First(&poll, "id = ?", c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "投票不存在"})
+		return poll, comment, false
+	}
+	if !canManagePoll(user, poll) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "只有投票创建者可以置顶评论"})
+		return poll, comment, false
+	}
+	if err := database.DB.First(&comment, "id = ? AND poll_id = ?", c.Param("comment_id"), poll.ID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "评论不存在"})
+		return poll, comment, false
+	}
+	return poll, comment, true
+}
+
+// PinComment 置顶评论，仅投票创建者和管理员可用。只能置顶显示中的根评论，每个投票置顶的评论数有上限
+func PinComment(c *gin.Context) {
+	poll, comment, ok := findPinTarget(c)
+	if !ok {
+		return
+	}
+	if comment.ParentID != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "只能置顶根评论"})
+		return
+	}
+	if comment.Status != models.CommentVisible || comment.IsDeleted {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "只能置顶显示中的评论"})
+		return
+	}
+	if comment.Pinned {
+		c.JSON(http.StatusOK, comment)
+		return
+	}
+
+	limit := pinnedCommentLimit()
+	var pinned int
+	database.DB.Model(&models.Comment{}).Where("poll_id = ? AND pinned_at IS NOT NULL", poll.ID).Count(&pinned)
+	if pinned >= limit {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "置顶评论数已达上限，请先取消其他评论的置顶", "limit": limit})
+		return
+	}
+
+	setCommentPinned(c, poll, comment, models.AuditCommentPin, time.Now())
+}
+
+// UnpinComment 取消置顶评论，仅投票创建者和管理员可用
+func UnpinComment(c *gin.Context) {
+	poll, comment, ok := findPinTarget(c)
+	if !ok {
+		return
+	}
+	if !comment.Pinned {
+		c.JSON(http.StatusOK, comment)
+		return
+	}
+
+	setCommentPinned(c, poll, comment, models.AuditCommentUnpin, nil)
+}
+
+// setCommentPinned 修改评论的置顶时间，pinnedAt 为 nil 表示取消置顶
+func setCommentPinned(c *gin.Context, poll models.Poll, comment models.Comment, action string, pinnedAt interface{}) {
+	before := comment
+
+	tx := database.DB.Begin()
+	if err := tx.Model(&comment).UpdateColumn("pinned_at", pinnedAt).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "修改置顶失败"})
+		return
+	}
+	tx.Preload("User").Preload("Mentions").First(&comment, "id = ?", comment.ID)
+	comment.IsPollCreator = comment.UserID == poll.CreatorID
+	if err := recordAudit(tx, c, models.AuditEntry{Action: action, TargetType: models.AuditTargetComment, TargetID: comment.ID, PollID: comment.PollID}, before, comment); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "修改置顶失败"})
+		return
+	}
+	if err := events.Record(tx, events.CommentUpdated{Before: before, Comment: comment}); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "修改置顶失败"})
+		return
+	}
+	if err := tx.Commit().Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "修改置顶失败"})
+		return
+	}
+	events.Notify()
+
+	c.JSON(http.StatusOK, comment)
+}
@@ -2,9 +2,12 @@ package controllers
 
 import (
 	"net/http"
+	"sort"
 	"time"
 	"vote-demo/database"
+	"vote-demo/events"
 	"vote-demo/models"
+	"vote-demo/trash"
 
 	"github.com/gin-gonic/gin"
 )
@@ -12,11 +15,19 @@ import (
 // CreatePoll 创建新投票
 func CreatePoll(c *gin.Context) {
 	var input struct {
-		Title       string        `json:"title" binding:"required"`
-		Description string        `json:"description"`
-		Type        string        `json:"type" binding:"required"`
-		Options     []string      `json:"options" binding:"required,min=2"`
-		EndTime     time.Time     `json:"end_time"`
+		Title          string      `json:"title" binding:"required"`
+		Description    string      `json:"description"`
+		Type           string      `json:"type" binding:"required"`
+		Options        []string    `json:"options"`
+		Slots          []SlotInput `json:"slots"` // 时间安排投票的时间段
+		EndTime        time.Time   `json:"end_time"`
+		CreditBudget   int         `json:"credit_budget"`
+		PointBudget    int         `json:"point_budget"`
+		MaxPerOption   int         `json:"max_per_option"`
+		IsQuiz         bool        `json:"is_quiz"`
+		CorrectOptions []int       `json:"correct_options"` // 测验模式：正确答案在选项列表中的序号
+		LockOptions    bool        `json:"lock_options"`    // 有人投票后禁止修改选项
+		PreModerate    bool        `json:"pre_moderate"`    // 新评论需要审核通过后才显示
 	}
 
 	if err := c.ShouldBindJSON(&input); err != nil {
@@ -24,10 +35,24 @@ func CreatePoll(c *gin.Context) {
 		return
 	}
 
+	// 记录创建者（在实际应用中，这应该从认证中间件获取）
+	creatorID := c.GetHeader("User-ID")
+	if creatorID != "" {
+		var creator models.User
+		if err := database.DB.First(&creator, "id = ?", creatorID).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "用户不存在"})
+			return
+		}
+	}
+
 	// 验证投票类型
-	if input.Type != models.PollTypeBinary && 
-	   input.Type != models.PollTypeSingle && 
-	   input.Type != models.PollTypeMulti {
+	if input.Type != models.PollTypeBinary &&
+		input.Type != models.PollTypeSingle &&
+		input.Type != models.PollTypeMulti &&
+		input.Type != models.PollTypeQuadratic &&
+		input.Type != models.PollTypeDot &&
+		input.Type != models.PollTypeSchedule &&
+		input.Type != models.PollTypeForecast {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的投票类型"})
 		return
 	}
@@ -37,39 +62,175 @@ func CreatePoll(c *gin.Context) {
 		input.Options = []string{"是", "否"}
 	}
 
+	// 内容过滤
+	texts := []*string{&input.Title, &input.Description}
+	for i := range input.Options {
+		texts = append(texts, &input.Options[i])
+	}
+	if !filterPollContent(c, texts...) {
+		return
+	}
+
+	// 二次方投票需要信用点预算，未提供时使用默认值
+	if input.Type == models.PollTypeQuadratic {
+		if input.CreditBudget < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "信用点预算不能为负数"})
+			return
+		}
+		if input.CreditBudget == 0 {
+			input.CreditBudget = models.DefaultCreditBudget
+		}
+	} else {
+		input.CreditBudget = 0
+	}
+
+	// 点投票需要总点数，单个选项上限可选
+	if input.Type == models.PollTypeDot {
+		if input.PointBudget < 0 || input.MaxPerOption < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "点数不能为负数"})
+			return
+		}
+		if input.PointBudget == 0 {
+			input.PointBudget = models.DefaultPointBudget
+		}
+		if input.MaxPerOption > input.PointBudget {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "单个选项上限不能超过总点数"})
+			return
+		}
+	} else {
+		input.PointBudget = 0
+		input.MaxPerOption = 0
+	}
+
+	// 准备选项，时间安排投票的选项由时间段生成
+	var options []models.Option
+	if input.Type == models.PollTypeSchedule {
+		for _, slot := range input.Slots {
+			option, err := slotOption(slot)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			options = append(options, option)
+		}
+		// 时间段生成的选项文本与其他选项一样需要经过内容过滤
+		texts := make([]*string, len(options))
+		for i := range options {
+			texts[i] = &options[i].Text
+		}
+		if !filterPollContent(c, texts...) {
+			return
+		}
+	} else {
+		for _, optionText := range input.Options {
+			options = append(options, models.Option{Text: optionText})
+		}
+	}
+
+	if len(options) < 2 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "投票至少需要两个选项"})
+		return
+	}
+
+	// 测验模式只支持二分、单选和多选，需要标记正确答案
+	if input.IsQuiz {
+		if input.Type != models.PollTypeBinary &&
+			input.Type != models.PollTypeSingle &&
+			input.Type != models.PollTypeMulti {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "该投票类型不支持测验模式"})
+			return
+		}
+		if len(input.CorrectOptions) == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "测验需要至少一个正确答案"})
+			return
+		}
+		if input.Type != models.PollTypeMulti && len(input.CorrectOptions) != 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "该投票类型只能有一个正确答案"})
+			return
+		}
+		for _, index := range input.CorrectOptions {
+			if index < 0 || index >= len(options) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "无效的正确答案序号"})
+				return
+			}
+			options[index].IsCorrect = true
+		}
+	}
+
 	// 创建投票
 	poll := models.Poll{
-		Title:       input.Title,
-		Description: input.Description,
-		Type:        input.Type,
-		EndTime:     input.EndTime,
-		IsActive:    true,
-		CreatedAt:   time.Now(),
-		UpdatedAt:   time.Now(),
+		Title:        input.Title,
+		Description:  input.Description,
+		CreatorID:    creatorID,
+		Type:         input.Type,
+		EndTime:      input.EndTime,
+		IsActive:     true,
+		CreditBudget: input.CreditBudget,
+		PointBudget:  input.PointBudget,
+		MaxPerOption: input.MaxPerOption,
+		IsQuiz:       input.IsQuiz,
+		Version:      1,
+		LockOptions:  input.LockOptions,
+		PreModerate:  input.PreModerate,
+		CreatedAt:    time.Now(),
+		UpdatedAt:    time.Now(),
 	}
 
-	if err := database.DB.Create(&poll).Error; err != nil {
+	tx := database.DB.Begin()
+	if err := tx.Create(&poll).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建投票失败"})
+		return
+	}
+	if err := recordPollRevision(tx, poll, creatorID); err != nil {
+		tx.Rollback()
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建投票失败"})
 		return
 	}
 
 	// 创建选项
-	for _, optionText := range input.Options {
-		option := models.Option{
-			PollID:    poll.ID,
-			Text:      optionText,
-			CreatedAt: time.Now(),
-			UpdatedAt: time.Now(),
-		}
-		if err := database.DB.Create(&option).Error; err != nil {
+	for _, option := range options {
+		option.PollID = poll.ID
+		option.CreatedAt = time.Now()
+		option.UpdatedAt = time.Now()
+		option.Version = 1
+		if err := tx.Create(&option).Error; err != nil {
+			tx.Rollback()
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "创建选项失败"})
 			return
 		}
+		if err := recordOptionRevision(tx, option, creatorID); err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "创建选项失败"})
+			return
+		}
+	}
+
+	// 创建者自动关注投票
+	if err := watchPoll(tx, creatorID, poll.ID); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建投票失败"})
+		return
 	}
 
 	// 重新查询完整的投票信息（包括选项）
 	var result models.Poll
-	database.DB.Preload("Options").First(&result, "id = ?", poll.ID)
+	tx.Preload("Options").First(&result, "id = ?", poll.ID)
+	if err := recordAudit(tx, c, models.AuditEntry{Action: models.AuditPollCreate, TargetType: models.AuditTargetPoll, TargetID: result.ID, PollID: result.ID}, nil, result); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建投票失败"})
+		return
+	}
+	if err := events.Record(tx, events.PollCreated{Poll: result}); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建投票失败"})
+		return
+	}
+	if err := tx.Commit().Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建投票失败"})
+		return
+	}
+	events.Notify()
 
 	c.JSON(http.StatusCreated, result)
 }
@@ -84,6 +245,8 @@ func GetPoll(c *gin.Context) {
 		return
 	}
 
+	revealQuizAnswers(&poll)
+	touchPollWatch(c, poll.ID)
 	c.JSON(http.StatusOK, poll)
 }
 
@@ -92,6 +255,10 @@ func ListPolls(c *gin.Context) {
 	var polls []models.Poll
 	database.DB.Preload("Options").Find(&polls)
 
+	for i := range polls {
+		revealQuizAnswers(&polls[i])
+	}
+
 	c.JSON(http.StatusOK, polls)
 }
 
@@ -109,7 +276,9 @@ func UpdatePoll(c *gin.Context) {
 		Title       string    `json:"title"`
 		Description string    `json:"description"`
 		EndTime     time.Time `json:"end_time"`
-		IsActive    *bool     `json:"is_active"`
+		IsActive    *bool     `json:"is_active"`    // 仅投票创建者或管理员可以修改
+		LockOptions *bool     `json:"lock_options"` // 仅投票创建者或管理员可以修改
+		PreModerate *bool     `json:"pre_moderate"` // 仅投票创建者或管理员可以修改
 	}
 
 	if err := c.ShouldBindJSON(&input); err != nil {
@@ -117,6 +286,52 @@ func UpdatePoll(c *gin.Context) {
 		return
 	}
 
+	if !filterPollContent(c, &input.Title, &input.Description) {
+		return
+	}
+
+	if input.LockOptions != nil {
+		user, ok := currentUser(c)
+		if !ok || !canManagePoll(user, poll) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "只有投票创建者或管理员可以锁定选项"})
+			return
+		}
+	}
+	if input.PreModerate != nil {
+		user, ok := currentUser(c)
+		if !ok || !canManagePoll(user, poll) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "只有投票创建者或管理员可以开启评论审核"})
+			return
+		}
+	}
+	if input.IsActive != nil || !input.EndTime.IsZero() {
+		user, ok := currentUser(c)
+		if !ok || !canManagePoll(user, poll) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "只有投票创建者或管理员可以开启、关闭投票或修改截止时间"})
+			return
+		}
+	}
+
+	// 测验结束后已经公布了答案，预测投票结算后已经知道结果，都不能重新开启
+	resolvedForecast := poll.Type == models.PollTypeForecast && poll.ResolvedAt != nil
+	if (poll.IsQuiz && poll.IsClosed()) || resolvedForecast {
+		reopened := poll
+		if input.IsActive != nil {
+			reopened.IsActive = *input.IsActive
+		}
+		if !input.EndTime.IsZero() {
+			reopened.EndTime = input.EndTime
+		}
+		if !reopened.IsClosed() {
+			if resolvedForecast {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "预测投票已结算，不能重新开启"})
+			} else {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "测验已结束并公布了答案，不能重新开启"})
+			}
+			return
+		}
+	}
+
 	// 更新字段
 	updates := map[string]interface{}{
 		"updated_at": time.Now(),
@@ -125,26 +340,96 @@ func UpdatePoll(c *gin.Context) {
 	if input.Title != "" {
 		updates["title"] = input.Title
 	}
-	
+
 	if input.Description != "" {
 		updates["description"] = input.Description
 	}
-	
+
 	if !input.EndTime.IsZero() {
 		updates["end_time"] = input.EndTime
 	}
-	
+
 	if input.IsActive != nil {
 		updates["is_active"] = *input.IsActive
 	}
 
-	if err := database.DB.Model(&poll).Updates(updates).Error; err != nil {
+	if input.LockOptions != nil {
+		updates["lock_options"] = *input.LockOptions
+	}
+
+	if input.PreModerate != nil {
+		updates["pre_moderate"] = *input.PreModerate
+	}
+
+	// 标题或描述变化时生成新版本
+	edited := (input.Title != "" && input.Title != poll.Title) ||
+		(input.Description != "" && input.Description != poll.Description)
+	if edited {
+		updates["version"] = poll.Version + 1
+	}
+
+	before := poll
+	tx := database.DB.Begin()
+	if edited {
+		if err := ensurePollRevision(tx, before); err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "更新投票失败"})
+			return
+		}
+	}
+	if err := tx.Model(&poll).Updates(updates).Error; err != nil {
+		tx.Rollback()
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新投票失败"})
 		return
 	}
 
 	// 返回更新后的投票
-	database.DB.Preload("Options").First(&poll, "id = ?", id)
+	tx.Preload("Options").First(&poll, "id = ?", id)
+	if edited {
+		if err := recordPollRevision(tx, poll, c.GetHeader("User-ID")); err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "更新投票失败"})
+			return
+		}
+	}
+	// 停用或把截止时间改到过去都会关闭投票。closed_at 有条件地写入，与截止时间检查任务并发时只有一方记录关闭事件
+	updated := []events.Event{events.PollUpdated{Before: before, Poll: poll}}
+	if before.IsActive && poll.IsClosed() && poll.ClosedAt == nil {
+		now := time.Now()
+		result := tx.Model(&models.Poll{}).Where("id = ? AND closed_at IS NULL", id).UpdateColumn("closed_at", now)
+		if result.Error != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "更新投票失败"})
+			return
+		}
+		if result.RowsAffected > 0 {
+			poll.ClosedAt = &now
+			updated = append(updated, events.PollClosed{Poll: poll})
+		}
+	} else if !poll.IsClosed() && poll.ClosedAt != nil {
+		if err := tx.Model(&poll).UpdateColumn("closed_at", nil).Error; err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "更新投票失败"})
+			return
+		}
+		poll.ClosedAt = nil
+	}
+	if err := recordAudit(tx, c, models.AuditEntry{Action: models.AuditPollUpdate, TargetType: models.AuditTargetPoll, TargetID: id, PollID: id}, before, poll); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新投票失败"})
+		return
+	}
+	if err := events.Record(tx, updated...); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新投票失败"})
+		return
+	}
+	if err := tx.Commit().Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新投票失败"})
+		return
+	}
+	events.Notify()
+
 	c.JSON(http.StatusOK, poll)
 }
 
@@ -152,20 +437,48 @@ func UpdatePoll(c *gin.Context) {
 func DeletePoll(c *gin.Context) {
 	id := c.Param("id")
 
+	user, ok := currentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未提供有效的用户ID"})
+		return
+	}
+
 	var poll models.Poll
-	if err := database.DB.First(&poll, "id = ?", id).Error; err != nil {
+	if err := database.DB.Preload("Options").First(&poll, "id = ?", id).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "投票不存在"})
 		return
 	}
 
-	// 删除相关的投票记录
-	database.DB.Where("poll_id = ?", id).Delete(&models.Vote{})
-	
-	// 删除相关的选项
-	database.DB.Where("poll_id = ?", id).Delete(&models.Option{})
-	
-	// 删除投票
-	database.DB.Delete(&poll)
+	// 与恢复相同，只有投票创建者或管理员可以删除
+	if !canManagePoll(user, poll) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "只有投票创建者或管理员可以删除投票"})
+		return
+	}
+
+	// 将投票及其选项、投票记录和评论移入回收站
+	tx := database.DB.Begin()
+	var voteCount int
+	tx.Model(&models.Vote{}).Where("poll_id = ?", id).Count(&voteCount)
+	if err := trashPoll(tx, id, trash.Stamp()); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "删除投票失败"})
+		return
+	}
+	if err := recordAudit(tx, c, models.AuditEntry{Action: models.AuditPollDelete, TargetType: models.AuditTargetPoll, TargetID: id, PollID: id}, gin.H{"poll": poll, "vote_count": voteCount}, nil); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "删除投票失败"})
+		return
+	}
+	if err := events.Record(tx, events.PollDeleted{Poll: poll}); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "删除投票失败"})
+		return
+	}
+	if err := tx.Commit().Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "删除投票失败"})
+		return
+	}
+	events.Notify()
 
 	c.JSON(http.StatusOK, gin.H{"message": "投票已删除"})
 }
@@ -180,32 +493,94 @@ func GetPollResults(c *gin.Context) {
 		return
 	}
 
+	c.JSON(http.StatusOK, pollResults(poll))
+}
+
+// pollResults 汇总投票结果，GetPollResults 和实时结果推送共用，以保证两者遵循相同的可见性规则
+func pollResults(poll models.Poll) gin.H {
+
 	// 获取每个选项的投票数
 	type OptionResult struct {
-		ID    string `json:"id"`
-		Text  string `json:"text"`
-		Count int    `json:"count"`
+		ID      string `json:"id"`
+		Text    string `json:"text"`
+		Count   int    `json:"count"`
+		Votes   int    `json:"votes,omitempty"`   // 二次方投票：获得的总票数
+		Credits int    `json:"credits,omitempty"` // 二次方投票：花费的信用点
+		Points  *int   `json:"points,omitempty"`  // 点投票：获得的总点数，没有点数时为 0
+		Rank    *int   `json:"rank,omitempty"`    // 点投票：按总点数的排名
+
+		Availability *SlotAvailability `json:"availability,omitempty"` // 时间安排投票：各回答的人数
+		IsCorrect    *bool             `json:"is_correct,omitempty"`   // 测验模式：投票结束后公布的正确答案
+
+		MeanProbability *float64 `json:"mean_probability,omitempty"` // 预测投票：预测者给出的平均概率
+
+		Version          int  `json:"version"`                      // 选项内容的版本号
+		EditedAfterVotes bool `json:"edited_after_votes,omitempty"` // 有人投票后选项内容被修改过
+	}
+
+	revealQuizAnswers(&poll)
+
+	var forecasters int
+	if poll.Type == models.PollTypeForecast {
+		forecasters = forecasterCount(poll.ID)
 	}
 
 	var results []OptionResult
 	for _, option := range poll.Options {
 		var count int
 		database.DB.Model(&models.Vote{}).Where("option_id = ?", option.ID).Count(&count)
-		
-		results = append(results, OptionResult{
-			ID:    option.ID,
-			Text:  option.Text,
-			Count: count,
+
+		result := OptionResult{
+			ID:        option.ID,
+			Text:      option.Text,
+			Count:     count,
+			IsCorrect: option.Correct,
+
+			Version:          option.Version,
+			EditedAfterVotes: option.EditedAfterVotes,
+		}
+		switch poll.Type {
+		case models.PollTypeQuadratic:
+			result.Votes, result.Credits = quadraticTally(option.ID)
+		case models.PollTypeDot:
+			points := optionWeightSum(option.ID)
+			result.Points = &points
+		case models.PollTypeSchedule:
+			availability := slotAvailability(option.ID)
+			result.Availability = &availability
+		case models.PollTypeForecast:
+			mean := meanProbability(option.ID, forecasters)
+			result.MeanProbability = &mean
+		}
+		results = append(results, result)
+	}
+
+	// 点投票按总点数从高到低排名，点数相同的选项名次相同
+	if poll.Type == models.PollTypeDot {
+		sort.SliceStable(results, func(i, j int) bool {
+			return *results[i].Points > *results[j].Points
 		})
+		for i := range results {
+			rank := i + 1
+			if i > 0 && *results[i].Points == *results[i-1].Points {
+				rank = *results[i-1].Rank
+			}
+			results[i].Rank = &rank
+		}
 	}
 
 	// 获取总投票数
 	var totalVotes int
-	database.DB.Model(&models.Vote{}).Where("poll_id = ?", id).Count(&totalVotes)
+	database.DB.Model(&models.Vote{}).Where("poll_id = ?", poll.ID).Count(&totalVotes)
 
-	c.JSON(http.StatusOK, gin.H{
-		"poll":       poll,
-		"results":    results,
+	response := gin.H{
+		"poll":        poll,
+		"results":     results,
 		"total_votes": totalVotes,
-	})
-} 
\ No newline at end of file
+	}
+	if poll.Type == models.PollTypeSchedule {
+		response["best_slots"] = bestSlotIDs(poll.Options)
+	}
+
+	return response
+}
@@ -0,0 +1,136 @@
+package controllers
+
+import (
+	"math"
+	"net/http"
+	"vote-demo/database"
+	"vote-demo/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// creditBudget 返回二次方投票的信用点预算
+func creditBudget(poll models.Poll) int {
+	if poll.CreditBudget > 0 {
+		return poll.CreditBudget
+	}
+	return models.DefaultCreditBudget
+}
+
+// castQuadraticVote 处理二次方投票，新的分配会整体替换用户之前的分配
+func castQuadraticVote(by actor, poll models.Poll, userID string, allocations map[string]int) (gin.H, error) {
+	if len(allocations) == 0 {
+		return nil, badRequest("未分配任何票数")
+	}
+
+	budget := creditBudget(poll)
+	cost, problem := quadraticCost(allocations, budget)
+	if problem != nil {
+		return nil, &requestError{Status: http.StatusBadRequest, Body: problem}
+	}
+
+	optionIDs, err := allocationOptionIDs(poll.ID, allocations)
+	if err != nil {
+		return nil, badRequest(err.Error())
+	}
+
+	votes, err := replaceAllocation(by, poll.ID, userID, optionIDs, allocations)
+	if err != nil {
+		return nil, errVoteFailed
+	}
+
+	return gin.H{
+		"message":           "投票成功",
+		"votes":             votes,
+		"credits_spent":     cost,
+		"credits_remaining": budget - cost,
+	}, nil
+}
+
+// isqrt 返回不超过 √n 的最大整数
+func isqrt(n int) int {
+	if n <= 0 {
+		return 0
+	}
+	r := int(math.Sqrt(float64(n)))
+	for r > 0 && r > n/r {
+		r--
+	}
+	for r+1 <= n/(r+1) {
+		r++
+	}
+	return r
+}
+
+// quadraticCost 计算分配花费的信用点（n 票花费 n² 个信用点）。
+// 分配无效或超出预算时返回错误响应。单个选项的票数不能超过 √budget，累加时也不会溢出
+func quadraticCost(allocations map[string]int, budget int) (int, gin.H) {
+	maxVotes := isqrt(budget)
+	cost := 0
+	for _, n := range allocations {
+		if n < 0 {
+			return 0, gin.H{"error": "票数不能为负数"}
+		}
+		if n > maxVotes {
+			return 0, gin.H{"error": "信用点不足", "max_votes_per_option": maxVotes, "budget": budget}
+		}
+		if n*n > budget-cost {
+			return 0, gin.H{"error": "信用点不足", "budget": budget}
+		}
+		cost += n * n
+	}
+	if cost == 0 {
+		return 0, gin.H{"error": "未分配任何票数"}
+	}
+	return cost, nil
+}
+
+// quadraticTally 统计选项在二次方投票中获得的票数和花费的信用点
+func quadraticTally(optionID string) (votes int, credits int) {
+	row := database.DB.Model(&models.Vote{}).
+		Where("option_id = ?", optionID).
+		Select("COALESCE(SUM(weight), 0), COALESCE(SUM(weight * weight), 0)").
+		Row()
+	row.Scan(&votes, &credits)
+	return votes, credits
+}
+
+// GetUserCredits 获取用户在二次方投票中的信用点使用情况
+func GetUserCredits(c *gin.Context) {
+	pollID := c.Param("id")
+	userID := c.GetHeader("User-ID")
+
+	if userID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "未提供用户ID"})
+		return
+	}
+
+	var poll models.Poll
+	if err := database.DB.First(&poll, "id = ?", pollID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "投票不存在"})
+		return
+	}
+
+	if poll.Type != models.PollTypeQuadratic {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "该投票不是二次方投票"})
+		return
+	}
+
+	var votes []models.Vote
+	database.DB.Where("poll_id = ? AND user_id = ?", pollID, userID).Find(&votes)
+
+	spent := 0
+	allocations := make(map[string]int)
+	for _, vote := range votes {
+		allocations[vote.OptionID] += vote.Weight
+		spent += vote.Weight * vote.Weight
+	}
+
+	budget := creditBudget(poll)
+	c.JSON(http.StatusOK, gin.H{
+		"budget":      budget,
+		"spent":       spent,
+		"remaining":   budget - spent,
+		"allocations": allocations,
+	})
+}
@@ -0,0 +1,65 @@
+package controllers
+
+import (
+	"math"
+	"testing"
+)
+
+func TestIsqrt(t *testing.T) {
+	tests := []struct {
+		n    int
+		want int
+	}{
+		{-1, 0},
+		{0, 0},
+		{1, 1},
+		{99, 9},
+		{100, 10},
+		{101, 10},
+		{math.MaxInt64, 3037000499},
+	}
+	for _, tt := range tests {
+		if got := isqrt(tt.n); got != tt.want {
+			t.Errorf("isqrt(%d) = %d, want %d", tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestQuadraticCost(t *testing.T) {
+	tests := []struct {
+		name        string
+		allocations map[string]int
+		budget      int
+		want        int
+		wantErr     string
+	}{
+		{"single option", map[string]int{"a": 3}, 100, 9, ""},
+		{"spends whole budget", map[string]int{"a": 6, "b": 8}, 100, 100, ""},
+		{"zero votes are allowed alongside others", map[string]int{"a": 0, "b": 10}, 100, 100, ""},
+		{"one vote over the square root", map[string]int{"a": 11}, 100, 0, "信用点不足"},
+		{"sum over budget", map[string]int{"a": 8, "b": 7}, 100, 0, "信用点不足"},
+		{"n*n would overflow", map[string]int{"a": math.MaxInt64}, 100, 0, "信用点不足"},
+		{"square root of overflow", map[string]int{"a": 3037000500}, math.MaxInt64, 0, "信用点不足"},
+		{"running sum would overflow", map[string]int{"a": 3037000499, "b": 3037000499}, math.MaxInt64, 0, "信用点不足"},
+		{"negative votes", map[string]int{"a": -1, "b": 2}, 100, 0, "票数不能为负数"},
+		{"nothing allocated", map[string]int{"a": 0}, 100, 0, "未分配任何票数"},
+		{"empty allocation", map[string]int{}, 100, 0, "未分配任何票数"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cost, errBody := quadraticCost(tt.allocations, tt.budget)
+			if tt.wantErr != "" {
+				if errBody == nil || errBody["error"] != tt.wantErr {
+					t.Fatalf("error = %v, want %q", errBody, tt.wantErr)
+				}
+				return
+			}
+			if errBody != nil {
+				t.Fatalf("unexpected error %v", errBody)
+			}
+			if cost != tt.want {
+				t.Errorf("cost = %d, want %d", cost, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,185 @@
+package controllers
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+	"vote-demo/database"
+	"vote-demo/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// quizAnswer 用户在测验投票中的作答情况
+type quizAnswer struct {
+	Correct    bool
+	AnswerTime time.Duration // 从投票创建到最后一次作答的用时
+}
+
+// revealQuizAnswers 测验投票结束后公布每个选项是否为正确答案
+func revealQuizAnswers(poll *models.Poll) {
+	if !poll.IsQuiz || !poll.IsClosed() {
+		return
+	}
+	for i := range poll.Options {
+		correct := poll.Options[i].IsCorrect
+		poll.Options[i].Correct = &correct
+	}
+}
+
+// quizAnswers 统计测验投票中每位用户的作答情况，选择的选项与正确答案完全一致才算答对
+func quizAnswers(poll models.Poll) map[string]quizAnswer {
+	correctIDs := make(map[string]bool)
+	var options []models.Option
+	database.DB.Where("poll_id = ? AND is_correct = ?", poll.ID, true).Find(&options)
+	for _, option := range options {
+		correctIDs[option.ID] = true
+	}
+
+	var votes []models.Vote
+	database.DB.Where("poll_id = ?", poll.ID).Find(&votes)
+
+	selected := make(map[string]map[string]bool)
+	answeredAt := make(map[string]time.Time)
+	for _, vote := range votes {
+		if selected[vote.UserID] == nil {
+			selected[vote.UserID] = make(map[string]bool)
+		}
+		selected[vote.UserID][vote.OptionID] = true
+		if vote.CreatedAt.After(answeredAt[vote.UserID]) {
+			answeredAt[vote.UserID] = vote.CreatedAt
+		}
+	}
+
+	answers := make(map[string]quizAnswer)
+	for userID, optionIDs := range selected {
+		correct := len(optionIDs) == len(correctIDs)
+		for optionID := range optionIDs {
+			if !correctIDs[optionID] {
+				correct = false
+			}
+		}
+
+		answerTime := answeredAt[userID].Sub(poll.CreatedAt)
+		if answerTime < 0 {
+			answerTime = 0
+		}
+		answers[userID] = quizAnswer{Correct: correct, AnswerTime: answerTime}
+	}
+	return answers
+}
+
+// GetQuizScore 获取用户在测验投票中的成绩
+func GetQuizScore(c *gin.Context) {
+	pollID := c.Param("id")
+	userID := c.GetHeader("User-ID")
+
+	if userID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "未提供用户ID"})
+		return
+	}
+
+	var poll models.Poll
+	if err := database.DB.Preload("Options").First(&poll, "id = ?", pollID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "投票不存在"})
+		return
+	}
+
+	if !poll.IsQuiz {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "该投票不是测验"})
+		return
+	}
+
+	if !poll.IsClosed() {
+		c.JSON(http.StatusForbidden, gin.H{"error": "测验结束后才能查看成绩"})
+		return
+	}
+
+	var correctOptionIDs []string
+	for _, option := range poll.Options {
+		if option.IsCorrect {
+			correctOptionIDs = append(correctOptionIDs, option.ID)
+		}
+	}
+
+	answer, answered := quizAnswers(poll)[userID]
+	score := 0
+	if answer.Correct {
+		score = 1
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"poll_id":             poll.ID,
+		"user_id":             userID,
+		"answered":            answered,
+		"correct":             answer.Correct,
+		"score":               score,
+		"answer_time_seconds": answer.AnswerTime.Seconds(),
+		"correct_option_ids":  correctOptionIDs,
+	})
+}
+
+// GetQuizLeaderboard 获取测验排行榜，按答对题数从高到低、总用时从短到长排名
+func GetQuizLeaderboard(c *gin.Context) {
+	// 只统计已结束的测验，未指定 poll_ids 时统计所有已结束的测验
+	var polls []models.Poll
+	query := database.DB.Where("is_quiz = ?", true)
+	if pollIDs := c.Query("poll_ids"); pollIDs != "" {
+		query = query.Where("id IN (?)", strings.Split(pollIDs, ","))
+	}
+	query.Find(&polls)
+
+	type LeaderboardEntry struct {
+		Rank             int         `json:"rank"`
+		User             models.User `json:"user"`
+		Score            int         `json:"score"`
+		Answered         int         `json:"answered"`
+		TotalTimeSeconds float64     `json:"total_time_seconds"`
+	}
+
+	entries := make(map[string]*LeaderboardEntry)
+	var quizIDs []string
+	for _, poll := range polls {
+		if !poll.IsClosed() {
+			continue
+		}
+		quizIDs = append(quizIDs, poll.ID)
+
+		for userID, answer := range quizAnswers(poll) {
+			entry, exists := entries[userID]
+			if !exists {
+				entry = &LeaderboardEntry{}
+				database.DB.First(&entry.User, "id = ?", userID)
+				entries[userID] = entry
+			}
+			entry.Answered++
+			if answer.Correct {
+				entry.Score++
+			}
+			entry.TotalTimeSeconds += answer.AnswerTime.Seconds()
+		}
+	}
+
+	leaderboard := make([]LeaderboardEntry, 0, len(entries))
+	for _, entry := range entries {
+		leaderboard = append(leaderboard, *entry)
+	}
+	sort.Slice(leaderboard, func(i, j int) bool {
+		if leaderboard[i].Score != leaderboard[j].Score {
+			return leaderboard[i].Score > leaderboard[j].Score
+		}
+		if leaderboard[i].TotalTimeSeconds != leaderboard[j].TotalTimeSeconds {
+			return leaderboard[i].TotalTimeSeconds < leaderboard[j].TotalTimeSeconds
+		}
+		return leaderboard[i].User.Username < leaderboard[j].User.Username
+	})
+	for i := range leaderboard {
+		leaderboard[i].Rank = i + 1
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"polls":       quizIDs,
+		"leaderboard": leaderboard,
+	})
+}
@@ -0,0 +1,236 @@
+package controllers
+
+import (
+	"net/http"
+	"time"
+	"vote-demo/database"
+	"vote-demo/events"
+	"vote-demo/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+)
+
+// reactionCounts 统计评论的各类反应数量
+func reactionCounts(db *gorm.DB, commentIDs []string) map[string]map[string]int {
+	counts := make(map[string]map[string]int)
+	if len(commentIDs) == 0 {
+		return counts
+	}
+
+	var rows []struct {
+		CommentID string
+		Kind      string
+		Count     int
+	}
+	db.Model(&models.CommentReaction{}).
+		Select("comment_id, kind, COUNT(*) AS count").
+		Where("comment_id IN (?)", commentIDs).
+		Group("comment_id, kind").
+		Scan(&rows)
+	for _, row := range rows {
+		if counts[row.CommentID] == nil {
+			counts[row.CommentID] = make(map[string]int)
+		}
+		counts[row.CommentID][row.Kind] = row.Count
+	}
+	return counts
+}
+
+// userReactions 用户对评论添加的反应
+func userReactions(db *gorm.DB, userID string, commentIDs []string) map[string][]string {
+	reactions := make(map[string][]string)
+	if userID == "" || len(commentIDs) == 0 {
+		return reactions
+	}
+
+	var rows []models.CommentReaction
+	db.Where("user_id = ? AND comment_id IN (?)", userID, commentIDs).Order("created_at ASC").Find(&rows)
+	for _, row := range rows {
+		reactions[row.CommentID] = append(reactions[row.CommentID], row.Kind)
+	}
+	return reactions
+}
+
+// findReactionTarget 检查用户和评论，失败时已写入错误响应
+func findReactionTarget(c *gin.Context) (models.User, models.Comment, bool) {
+	var user models.User
+	var comment models.Comment
+
+	userID := c.GetHeader("User-ID")
+	if userID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "未提供用户ID"})
+		return user, comment, false
+	}
+	if err := database.DB.First(&user, "id = ?", userID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "用户不存在"})
+		return user, comment, false
+	}
+	if err := database.DB.First(&comment, "id = ? AND poll_id = ? AND status = ?", c.Param("comment_id"), c.Param("id"), models.CommentVisible).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "评论不存在"})
+		return user, comment, false
+	}
+	if comment.IsDeleted {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "评论已删除"})
+		return user, comment, false
+	}
+	return user, comment, true
+}
+
+// recordReactionChange 在事务中更新评论得分，写入审计记录和反应变化事件，返回变化后的反应数量
+func recordReactionChange(tx *gorm.DB, c *gin.Context, action string, reaction models.CommentReaction, before, after interface{}) (map[string]int, error) {
+	if err := recordAudit(tx, c, models.AuditEntry{Action: action, TargetType: models.AuditTargetReaction, TargetID: reaction.ID, PollID: reaction.PollID}, before, after); err != nil {
+		return nil, err
+	}
+	counts := reactionCounts(tx, []string{reaction.CommentID})[reaction.CommentID]
+	if counts == nil {
+		counts = map[string]int{}
+	}
+	// 更新 top 排序使用的得分
+	score := models.WilsonScore(counts[models.ReactionUp], counts[models.ReactionDown])
+	if err := tx.Model(&models.Comment{}).Where("id = ?", reaction.CommentID).UpdateColumn("score", score).Error; err != nil {
+		return nil, err
+	}
+	if err := events.Record(tx, events.CommentReacted{PollID: reaction.PollID, CommentID: reaction.CommentID, Reactions: counts}); err != nil {
+		return nil, err
+	}
+	return counts, nil
+}
+
+// AddReaction 对评论添加反应。赞成和反对互斥，添加其中一个会取消另一个；重复添加同一反应不会产生新记录
+func AddReaction(c *gin.Context) {
+	user, comment, ok := findReactionTarget(c)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Kind string `json:"kind" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !models.ValidReaction(input.Kind) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的反应类型", "allowed": append([]string{models.ReactionUp, models.ReactionDown}, models.ReactionEmojis...)})
+		return
+	}
+
+	var existing models.CommentReaction
+	if err := database.DB.First(&existing, "comment_id = ? AND user_id = ? AND kind = ?", comment.ID, user.ID, input.Kind).Error; err == nil {
+		c.JSON(http.StatusOK, gin.H{
+			"comment_id":   comment.ID,
+			"reactions":    reactionCounts(database.DB, []string{comment.ID})[comment.ID],
+			"my_reactions": userReactions(database.DB, user.ID, []string{comment.ID})[comment.ID],
+		})
+		return
+	}
+
+	tx := database.DB.Begin()
+	var removed []models.CommentReaction
+	opposite := map[string]string{models.ReactionUp: models.ReactionDown, models.ReactionDown: models.ReactionUp}[input.Kind]
+	if opposite != "" {
+		tx.Where("comment_id = ? AND user_id = ? AND kind = ?", comment.ID, user.ID, opposite).Find(&removed)
+		if err := tx.Where("comment_id = ? AND user_id = ? AND kind = ?", comment.ID, user.ID, opposite).Delete(&models.CommentReaction{}).Error; err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "添加反应失败"})
+			return
+		}
+	}
+
+	reaction := models.CommentReaction{
+		CommentID: comment.ID,
+		UserID:    user.ID,
+		Kind:      input.Kind,
+		PollID:    comment.PollID,
+		CreatedAt: time.Now(),
+	}
+	if err := tx.Create(&reaction).Error; err != nil {
+		// 并发请求已经添加了同一反应
+		tx.Rollback()
+		c.JSON(http.StatusConflict, gin.H{"error": "已经添加过该反应"})
+		return
+	}
+
+	var before interface{}
+	if len(removed) > 0 {
+		before = removed[0]
+	}
+	counts, err := recordReactionChange(tx, c, models.AuditReactionCreate, reaction, before, reaction)
+	if err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "添加反应失败"})
+		return
+	}
+	if err := tx.Commit().Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "添加反应失败"})
+		return
+	}
+	events.Notify()
+
+	c.JSON(http.StatusCreated, gin.H{
+		"comment_id":   comment.ID,
+		"reactions":    counts,
+		"my_reactions": userReactions(database.DB, user.ID, []string{comment.ID})[comment.ID],
+	})
+}
+
+// RemoveReaction 取消对评论的反应
+func RemoveReaction(c *gin.Context) {
+	user, comment, ok := findReactionTarget(c)
+	if !ok {
+		return
+	}
+
+	var reaction models.CommentReaction
+	if err := database.DB.First(&reaction, "comment_id = ? AND user_id = ? AND kind = ?", comment.ID, user.ID, c.Param("kind")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "没有添加过该反应"})
+		return
+	}
+
+	tx := database.DB.Begin()
+	if err := tx.Delete(&reaction).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "取消反应失败"})
+		return
+	}
+	counts, err := recordReactionChange(tx, c, models.AuditReactionDelete, reaction, reaction, nil)
+	if err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "取消反应失败"})
+		return
+	}
+	if err := tx.Commit().Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "取消反应失败"})
+		return
+	}
+	events.Notify()
+
+	c.JSON(http.StatusOK, gin.H{
+		"comment_id":   comment.ID,
+		"reactions":    counts,
+		"my_reactions": userReactions(database.DB, user.ID, []string{comment.ID})[comment.ID],
+	})
+}
+
+// GetCommentReactions 获取评论的各类反应数量，以及当前用户添加的反应
+func GetCommentReactions(c *gin.Context) {
+	var comment models.Comment
+	if err := database.DB.First(&comment, "id = ? AND poll_id = ? AND status = ?", c.Param("comment_id"), c.Param("id"), models.CommentVisible).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "评论不存在"})
+		return
+	}
+
+	counts := reactionCounts(database.DB, []string{comment.ID})[comment.ID]
+	if counts == nil {
+		counts = map[string]int{}
+	}
+	up, down := counts[models.ReactionUp], counts[models.ReactionDown]
+
+	c.JSON(http.StatusOK, gin.H{
+		"comment_id":   comment.ID,
+		"reactions":    counts,
+		"my_reactions": userReactions(database.DB, c.GetHeader("User-ID"), []string{comment.ID})[comment.ID],
+		"score":        models.WilsonScore(up, down),
+	})
+}
@@ -0,0 +1,308 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+	"vote-demo/database"
+	"vote-demo/events"
+	"vote-demo/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SlotInput 时间安排投票的时间段输入
+type SlotInput struct {
+	StartsAt string `json:"starts_at"`
+	EndsAt   string `json:"ends_at"`
+	Timezone string `json:"timezone"` // IANA 时区名称，默认 UTC
+}
+
+// SlotAvailability 时间段的可用情况
+type SlotAvailability struct {
+	Yes      int `json:"yes"`
+	IfNeedBe int `json:"if_need_be"`
+	No       int `json:"no"`
+}
+
+// Available 可以参加（包括必要时可以）的人数
+func (a SlotAvailability) Available() int {
+	return a.Yes + a.IfNeedBe
+}
+
+// 不带时区偏移的时间格式，按时间段的时区解析
+var slotTimeLayouts = []string{
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+}
+
+// parseSlotTime 解析时间段的时间，带时区偏移的 RFC3339 时间会转换到时间段的时区
+func parseSlotTime(value string, loc *time.Location) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t.In(loc), nil
+	}
+	for _, layout := range slotTimeLayouts {
+		if t, err := time.ParseInLocation(layout, value, loc); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("无效的时间格式: %s", value)
+}
+
+// slotOption 根据时间段输入生成选项
+func slotOption(slot SlotInput) (models.Option, error) {
+	if slot.StartsAt == "" || slot.EndsAt == "" {
+		return models.Option{}, errors.New("时间段需要提供开始时间和结束时间")
+	}
+
+	timezone := slot.Timezone
+	if timezone == "" {
+		timezone = "UTC"
+	}
+
+	loc, err := time.LoadLocation(timezone)
+	if err != nil {
+		return models.Option{}, fmt.Errorf("无效的时区: %s", timezone)
+	}
+
+	startsAt, err := parseSlotTime(slot.StartsAt, loc)
+	if err != nil {
+		return models.Option{}, err
+	}
+	endsAt, err := parseSlotTime(slot.EndsAt, loc)
+	if err != nil {
+		return models.Option{}, err
+	}
+	if !endsAt.After(startsAt) {
+		return models.Option{}, errors.New("时间段的结束时间必须晚于开始时间")
+	}
+
+	// 选项文本使用时间段所在时区的本地时间
+	text := startsAt.Format("2006-01-02 15:04") + " - "
+	if endsAt.Format("2006-01-02") == startsAt.Format("2006-01-02") {
+		text += endsAt.Format("15:04")
+	} else {
+		text += endsAt.Format("2006-01-02 15:04")
+	}
+	text += " (" + timezone + ")"
+
+	startsAt = startsAt.UTC()
+	endsAt = endsAt.UTC()
+	return models.Option{
+		Text:     text,
+		StartsAt: &startsAt,
+		EndsAt:   &endsAt,
+		Timezone: timezone,
+	}, nil
+}
+
+// sameTime 判断两个可能为空的时间是否相同
+func sameTime(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Equal(*b)
+}
+
+// castScheduleVote 处理时间安排投票，用户需要对每个时间段作出回答，新的回答会整体替换之前的回答
+func castScheduleVote(by actor, poll models.Poll, userID string, availability map[string]string) (gin.H, error) {
+	var options []models.Option
+	database.DB.Where("poll_id = ?", poll.ID).Order("starts_at ASC").Find(&options)
+
+	if len(availability) != len(options) {
+		return nil, badRequest("需要对每个时间段作出回答")
+	}
+
+	for _, option := range options {
+		answer, exists := availability[option.ID]
+		if !exists {
+			return nil, badRequest("需要对每个时间段作出回答")
+		}
+		if answer != models.AnswerYes && answer != models.AnswerIfNeedBe && answer != models.AnswerNo {
+			return nil, badRequest("无效的回答，只能是 yes、if_need_be 或 no")
+		}
+	}
+
+	// 删除之前的回答并写入新的回答
+	tx := database.DB.Begin()
+	previous, err := deleteUserVotes(tx, poll.ID, userID)
+	if err != nil {
+		tx.Rollback()
+		return nil, errVoteFailed
+	}
+
+	var votes []models.Vote
+	for _, option := range options {
+		vote := models.Vote{
+			PollID:    poll.ID,
+			OptionID:  option.ID,
+			UserID:    userID,
+			Answer:    availability[option.ID],
+			CreatedAt: time.Now(),
+		}
+		if err := tx.Create(&vote).Error; err != nil {
+			tx.Rollback()
+			return nil, errVoteFailed
+		}
+		votes = append(votes, vote)
+	}
+
+	if err := recordVoteCast(tx, by, poll.ID, userID, previous, votes); err != nil {
+		tx.Rollback()
+		return nil, errVoteFailed
+	}
+	if err := tx.Commit().Error; err != nil {
+		return nil, errVoteFailed
+	}
+	events.Notify()
+
+	return gin.H{
+		"message": "投票成功",
+		"votes":   votes,
+	}, nil
+}
+
+// slotAvailability 统计时间段的回答情况
+func slotAvailability(optionID string) SlotAvailability {
+	var availability SlotAvailability
+	rows, err := database.DB.Model(&models.Vote{}).
+		Where("option_id = ?", optionID).
+		Select("answer, COUNT(*)").
+		Group("answer").
+		Rows()
+	if err != nil {
+		return availability
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var answer string
+		var count int
+		rows.Scan(&answer, &count)
+
+		switch answer {
+		case models.AnswerYes:
+			availability.Yes = count
+		case models.AnswerIfNeedBe:
+			availability.IfNeedBe = count
+		case models.AnswerNo:
+			availability.No = count
+		}
+	}
+	return availability
+}
+
+// bestSlotIDs 返回可参加人数最多的时间段，人数相同时优先“可以”人数多的时间段
+func bestSlotIDs(options []models.Option) []string {
+	bestIDs := []string{}
+	var best SlotAvailability
+	for _, option := range options {
+		availability := slotAvailability(option.ID)
+		if availability.Available() == 0 {
+			continue
+		}
+
+		switch {
+		case len(bestIDs) == 0,
+			availability.Available() > best.Available(),
+			availability.Available() == best.Available() && availability.Yes > best.Yes:
+			best = availability
+			bestIDs = []string{option.ID}
+		case availability.Available() == best.Available() && availability.Yes == best.Yes:
+			bestIDs = append(bestIDs, option.ID)
+		}
+	}
+	return bestIDs
+}
+
+// escapeICSText 转义 iCalendar 文本中的特殊字符
+func escapeICSText(text string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`)
+	return replacer.Replace(text)
+}
+
+// foldICSLine 按 RFC 5545 将超过 75 字节的行折叠，不会拆开多字节字符
+func foldICSLine(line string) string {
+	var builder strings.Builder
+	width := 0
+	for _, r := range line {
+		size := len(string(r))
+		if width+size > 75 {
+			builder.WriteString("\r\n ")
+			width = 1
+		}
+		builder.WriteRune(r)
+		width += size
+	}
+	builder.WriteString("\r\n")
+	return builder.String()
+}
+
+// ExportScheduleICS 导出时间安排投票选定时间段的 iCalendar 文件
+func ExportScheduleICS(c *gin.Context) {
+	pollID := c.Param("id")
+
+	var poll models.Poll
+	if err := database.DB.Preload("Options").First(&poll, "id = ?", pollID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "投票不存在"})
+		return
+	}
+
+	if poll.Type != models.PollTypeSchedule {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "该投票不是时间安排投票"})
+		return
+	}
+
+	// 未指定时间段时导出可参加人数最多的时间段
+	optionID := c.Query("option_id")
+	if optionID == "" {
+		bestIDs := bestSlotIDs(poll.Options)
+		if len(bestIDs) == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "暂无可导出的时间段"})
+			return
+		}
+		optionID = bestIDs[0]
+	}
+
+	var slot *models.Option
+	for i := range poll.Options {
+		if poll.Options[i].ID == optionID {
+			slot = &poll.Options[i]
+		}
+	}
+	if slot == nil || slot.StartsAt == nil || slot.EndsAt == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "时间段不存在"})
+		return
+	}
+
+	const icsTime = "20060102T150405Z"
+	lines := []string{
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"PRODID:-//vote-demo//schedule//CN",
+		"CALSCALE:GREGORIAN",
+		"METHOD:PUBLISH",
+		"BEGIN:VEVENT",
+		"UID:" + slot.ID + "@vote-demo",
+		"DTSTAMP:" + time.Now().UTC().Format(icsTime),
+		"DTSTART:" + slot.StartsAt.UTC().Format(icsTime),
+		"DTEND:" + slot.EndsAt.UTC().Format(icsTime),
+		"SUMMARY:" + escapeICSText(poll.Title),
+	}
+	if poll.Description != "" {
+		lines = append(lines, "DESCRIPTION:"+escapeICSText(poll.Description))
+	}
+	lines = append(lines, "END:VEVENT", "END:VCALENDAR")
+
+	var builder strings.Builder
+	for _, line := range lines {
+		builder.WriteString(foldICSLine(line))
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="poll-%s.ics"`, poll.ID))
+	c.Data(http.StatusOK, "text/calendar; charset=utf-8", []byte(builder.String()))
+}
@@ -0,0 +1,60 @@
+package controllers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"vote-demo/database"
+	"vote-demo/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestUpdateScheduleOption(t *testing.T) {
+	setupDB(t)
+
+	poll := models.Poll{Title: "周会时间", Type: models.PollTypeSchedule, IsActive: true}
+	database.DB.Create(&poll)
+	option, err := slotOption(SlotInput{StartsAt: "2026-03-02T10:00", EndsAt: "2026-03-02T11:00", Timezone: "Asia/Shanghai"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	option.PollID, option.Version = poll.ID, 1
+	database.DB.Create(&option)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.PUT("/options/:option_id", UpdateOption)
+	update := func(body string) int {
+		req := httptest.NewRequest(http.MethodPut, "/options/"+option.ID, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+		return recorder.Code
+	}
+
+	// 只修改文本时，文本与时间段会不一致
+	if code := update(`{"text":"随便什么时候"}`); code != http.StatusBadRequest {
+		t.Errorf("text edit status = %d, want %d", code, http.StatusBadRequest)
+	}
+
+	if code := update(`{"starts_at":"2026-03-02T14:00","ends_at":"2026-03-02T15:30","timezone":"Asia/Shanghai"}`); code != http.StatusOK {
+		t.Fatalf("slot edit status = %d, want %d", code, http.StatusOK)
+	}
+	var updated models.Option
+	database.DB.First(&updated, "id = ?", option.ID)
+	if want := "2026-03-02 14:00 - 15:30 (Asia/Shanghai)"; updated.Text != want {
+		t.Errorf("text = %q, want %q", updated.Text, want)
+	}
+	if want := time.Date(2026, 3, 2, 6, 0, 0, 0, time.UTC); updated.StartsAt == nil || !updated.StartsAt.Equal(want) {
+		t.Errorf("starts_at = %v, want %v", updated.StartsAt, want)
+	}
+	if want := time.Date(2026, 3, 2, 7, 30, 0, 0, time.UTC); updated.EndsAt == nil || !updated.EndsAt.Equal(want) {
+		t.Errorf("ends_at = %v, want %v", updated.EndsAt, want)
+	}
+	if updated.Version != 2 {
+		t.Errorf("version = %d, want 2", updated.Version)
+	}
+}
@@ -44,28 +44,47 @@ func GetPollStats(c *gin.Context) {
 
 	// 获取每个选项的投票数和百分比
 	type OptionStat struct {
-		ID        string  `json:"id"`
-		Text      string  `json:"text"`
-		Count     int     `json:"count"`
-		Percentage float64 `json:"percentage"`
+		ID                string        `json:"id"`
+		Text              string        `json:"text"`
+		Count             int           `json:"count"`
+		Percentage        float64       `json:"percentage"`
+		Points            *int          `json:"points,omitempty"`             // 点投票：获得的总点数，没有点数时为 0
+		PointDistribution []PointBucket `json:"point_distribution,omitempty"` // 点投票：各点数的投票者人数
+	}
+
+	// 点投票的百分比按点数占比计算
+	totalPoints := 0
+	if poll.Type == models.PollTypeDot {
+		database.DB.Model(&models.Vote{}).
+			Where("poll_id = ?", pollID).
+			Select("COALESCE(SUM(weight), 0)").
+			Row().
+			Scan(&totalPoints)
 	}
 
 	var optionStats []OptionStat
 	for _, option := range poll.Options {
 		var count int
 		database.DB.Model(&models.Vote{}).Where("option_id = ?", option.ID).Count(&count)
-		
-		percentage := 0.0
-		if totalVotes > 0 {
-			percentage = float64(count) / float64(totalVotes) * 100
+
+		stat := OptionStat{
+			ID:    option.ID,
+			Text:  option.Text,
+			Count: count,
 		}
-		
-		optionStats = append(optionStats, OptionStat{
-			ID:         option.ID,
-			Text:       option.Text,
-			Count:      count,
-			Percentage: percentage,
-		})
+
+		if poll.Type == models.PollTypeDot {
+			points := optionWeightSum(option.ID)
+			stat.Points = &points
+			stat.PointDistribution = dotPointDistribution(option.ID)
+			if totalPoints > 0 {
+				stat.Percentage = float64(points) / float64(totalPoints) * 100
+			}
+		} else if totalVotes > 0 {
+			stat.Percentage = float64(count) / float64(totalVotes) * 100
+		}
+
+		optionStats = append(optionStats, stat)
 	}
 
 	// 获取投票的时间分布
@@ -93,59 +112,64 @@ func GetPollStats(c *gin.Context) {
 			var hour string
 			var count int
 			rows.Scan(&hour, &count)
-			
+
 			hourInt := 0
 			if h, err := time.Parse("15", hour); err == nil {
 				hourInt = h.Hour()
 			}
-			
+
 			if hourInt >= 0 && hourInt < 24 {
 				timeDistribution[hourInt].Count = count
 			}
 		}
 	}
 
-	c.JSON(http.StatusOK, gin.H{
+	response := gin.H{
 		"poll":              poll,
 		"total_votes":       totalVotes,
 		"unique_voters":     len(uniqueUsers),
 		"option_stats":      optionStats,
 		"time_distribution": timeDistribution,
-	})
+	}
+	if poll.Type == models.PollTypeDot {
+		response["total_points"] = totalPoints
+	}
+
+	c.JSON(http.StatusOK, response)
 }
 
 // GetTrendingPolls 获取热门投票
 func GetTrendingPolls(c *gin.Context) {
 	// 获取过去7天内的热门投票（按投票数排序）
 	sevenDaysAgo := time.Now().AddDate(0, 0, -7)
-	
+
 	type PollWithVoteCount struct {
 		models.Poll
 		VoteCount int `json:"vote_count"`
 	}
-	
+
 	var trendingPolls []PollWithVoteCount
-	
+
 	// 查询过去7天内有投票记录的投票
 	rows, err := database.DB.Table("votes").
 		Select("poll_id, COUNT(*) as vote_count").
-		Where("created_at > ?", sevenDaysAgo).
+		Where("created_at > ? AND deleted_at IS NULL", sevenDaysAgo).
 		Group("poll_id").
 		Order("vote_count DESC").
 		Limit(10).
 		Rows()
-	
+
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取热门投票失败"})
 		return
 	}
 	defer rows.Close()
-	
+
 	for rows.Next() {
 		var pollID string
 		var voteCount int
 		rows.Scan(&pollID, &voteCount)
-		
+
 		var poll models.Poll
 		if err := database.DB.Preload("Options").First(&poll, "id = ?", pollID).Error; err == nil {
 			trendingPolls = append(trendingPolls, PollWithVoteCount{
@@ -154,7 +178,7 @@ func GetTrendingPolls(c *gin.Context) {
 			})
 		}
 	}
-	
+
 	c.JSON(http.StatusOK, gin.H{
 		"trending_polls": trendingPolls,
 	})
@@ -163,14 +187,14 @@ func GetTrendingPolls(c *gin.Context) {
 // GetUserStats 获取用户的投票统计信息
 func GetUserStats(c *gin.Context) {
 	userID := c.Param("id")
-	
+
 	// 检查用户是否存在
 	var user models.User
 	if err := database.DB.First(&user, "id = ?", userID).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "用户不存在"})
 		return
 	}
-	
+
 	// 获取用户参与的投票数
 	var participatedPollCount int
 	rows, err := database.DB.Model(&models.Vote{}).
@@ -182,7 +206,7 @@ func GetUserStats(c *gin.Context) {
 		return
 	}
 	defer rows.Close()
-	
+
 	var participatedPollIDs []string
 	for rows.Next() {
 		var pollID string
@@ -190,27 +214,27 @@ func GetUserStats(c *gin.Context) {
 		participatedPollIDs = append(participatedPollIDs, pollID)
 	}
 	participatedPollCount = len(participatedPollIDs)
-	
+
 	// 获取用户的投票总数
 	var totalVoteCount int
 	database.DB.Model(&models.Vote{}).Where("user_id = ?", userID).Count(&totalVoteCount)
-	
+
 	// 获取用户最近的投票记录
 	var recentVotes []models.Vote
 	database.DB.Where("user_id = ?", userID).
 		Order("created_at DESC").
 		Limit(10).
 		Find(&recentVotes)
-	
+
 	// 获取这些投票记录对应的投票和选项信息
 	var recentVoteDetails []gin.H
 	for _, vote := range recentVotes {
 		var poll models.Poll
 		var option models.Option
-		
+
 		database.DB.First(&poll, "id = ?", vote.PollID)
 		database.DB.First(&option, "id = ?", vote.OptionID)
-		
+
 		recentVoteDetails = append(recentVoteDetails, gin.H{
 			"vote_id":     vote.ID,
 			"poll_id":     vote.PollID,
@@ -220,11 +244,34 @@ func GetUserStats(c *gin.Context) {
 			"created_at":  vote.CreatedAt,
 		})
 	}
-	
+
+	// 获取用户在预测投票中的校准历史
+	var forecastScores []models.ForecastScore
+	database.DB.Where("user_id = ?", userID).
+		Order("created_at DESC").
+		Find(&forecastScores)
+
+	averageBrier, averageLogScore := 0.0, 0.0
+	for _, score := range forecastScores {
+		averageBrier += score.Brier
+		averageLogScore += score.LogScore
+	}
+	if len(forecastScores) > 0 {
+		averageBrier /= float64(len(forecastScores))
+		averageLogScore /= float64(len(forecastScores))
+	}
+
 	c.JSON(http.StatusOK, gin.H{
-		"user":                  user,
-		"participated_polls":    participatedPollCount,
-		"total_votes":           totalVoteCount,
-		"recent_vote_details":   recentVoteDetails,
+		"user":                user,
+		"participated_polls":  participatedPollCount,
+		"total_votes":         totalVoteCount,
+		"recent_vote_details": recentVoteDetails,
+		"forecast": gin.H{
+			"resolved_forecasts": len(forecastScores),
+			"average_brier":      averageBrier,
+			"average_log_score":  averageLogScore,
+			"history":            forecastScores,
+			"calibration":        userCalibration(userID),
+		},
 	})
-} 
\ No newline at end of file
+}
@@ -0,0 +1,172 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+	"vote-demo/database"
+	"vote-demo/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 结果推送的节流间隔：一段时间内的多次变更合并为一次推送
+const resultsStreamInterval = 500 * time.Millisecond
+
+// 结果推送的心跳间隔，防止代理断开空闲连接
+const resultsStreamHeartbeat = 15 * time.Second
+
+// resultsBroker 按投票记录结果的版本号，并通知订阅者结果已变更
+type resultsBroker struct {
+	mu          sync.Mutex
+	epoch       string // 服务启动标识，服务重启后旧的事件ID全部失效
+	versions    map[string]uint64
+	subscribers map[string]map[chan struct{}]bool
+}
+
+var broker = &resultsBroker{
+	epoch:       strconv.FormatInt(time.Now().UnixNano(), 36),
+	versions:    make(map[string]uint64),
+	subscribers: make(map[string]map[chan struct{}]bool),
+}
+
+// subscribe 订阅投票结果的变更通知，通道容量为 1，未处理的通知会被合并
+func (b *resultsBroker) subscribe(pollID string) chan struct{} {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	ch := make(chan struct{}, 1)
+	if b.subscribers[pollID] == nil {
+		b.subscribers[pollID] = make(map[chan struct{}]bool)
+	}
+	b.subscribers[pollID][ch] = true
+	return ch
+}
+
+// unsubscribe 取消订阅
+func (b *resultsBroker) unsubscribe(pollID string, ch chan struct{}) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	delete(b.subscribers[pollID], ch)
+	if len(b.subscribers[pollID]) == 0 {
+		delete(b.subscribers, pollID)
+	}
+}
+
+// publish 增加投票结果的版本号并通知所有订阅者
+func (b *resultsBroker) publish(pollID string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.versions[pollID]++
+	for ch := range b.subscribers[pollID] {
+		select {
+		case ch <- struct{}{}:
+		default:
+			// 已有未处理的通知，合并到同一次推送中
+		}
+	}
+}
+
+// eventID 返回投票结果当前版本对应的事件ID
+func (b *resultsBroker) eventID(pollID string) string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return fmt.Sprintf("%s-%d", b.epoch, b.versions[pollID])
+}
+
+// notifyResultsChanged 在投票结果相关的写操作提交后调用，通知 SSE 结果推送和 WebSocket 实时房间
+func notifyResultsChanged(pollID string) {
+	broker.publish(pollID)
+	publishLiveResults(pollID)
+}
+
+// StreamPollResults 通过 Server-Sent Events 实时推送投票结果
+func StreamPollResults(c *gin.Context) {
+	pollID := c.Param("id")
+
+	var poll models.Poll
+	if err := database.DB.First(&poll, "id = ?", pollID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "投票不存在"})
+		return
+	}
+
+	updates := broker.subscribe(pollID)
+	defer broker.unsubscribe(pollID, updates)
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+
+	fmt.Fprintf(c.Writer, "retry: %d\n\n", (3 * time.Second).Milliseconds())
+	c.Writer.Flush()
+
+	// 推送当前结果，返回 false 表示投票已被删除，连接需要关闭
+	lastSent := ""
+	push := func() bool {
+		id := broker.eventID(pollID)
+		if id == lastSent {
+			return true
+		}
+
+		var poll models.Poll
+		if err := database.DB.Preload("Options").First(&poll, "id = ?", pollID).Error; err != nil {
+			fmt.Fprintf(c.Writer, "id: %s\nevent: deleted\ndata: {}\n\n", id)
+			c.Writer.Flush()
+			return false
+		}
+
+		data, err := json.Marshal(pollResults(poll))
+		if err != nil {
+			return true
+		}
+		fmt.Fprintf(c.Writer, "id: %s\nevent: results\ndata: %s\n\n", id, data)
+		c.Writer.Flush()
+		lastSent = id
+		return true
+	}
+
+	// 断线重连时如果客户端的事件ID已是最新版本，则无需重复推送
+	lastSent = c.GetHeader("Last-Event-ID")
+	if !push() {
+		return
+	}
+
+	heartbeat := time.NewTicker(resultsStreamHeartbeat)
+	defer heartbeat.Stop()
+
+	lastPush := time.Now()
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case <-heartbeat.C:
+			fmt.Fprint(c.Writer, ": heartbeat\n\n")
+			c.Writer.Flush()
+		case <-updates:
+			// 距离上次推送不足节流间隔时先等待，期间的变更合并为一次推送
+			if wait := resultsStreamInterval - time.Since(lastPush); wait > 0 {
+				select {
+				case <-c.Request.Context().Done():
+					return
+				case <-time.After(wait):
+				}
+			}
+			select {
+			case <-updates:
+			default:
+			}
+			if !push() {
+				return
+			}
+			lastPush = time.Now()
+		}
+	}
+}
@@ -0,0 +1,300 @@
+package controllers
+
+import (
+	"net/http"
+	"time"
+	"vote-demo/database"
+	"vote-demo/events"
+	"vote-demo/models"
+	"vote-demo/trash"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+)
+
+// trashPoll 在事务中将投票及其选项、投票记录和评论移入回收站
+func trashPoll(tx *gorm.DB, pollID string, at time.Time) error {
+	for _, model := range []interface{}{&models.Vote{}, &models.Option{}, &models.Comment{}} {
+		if err := tx.Model(model).Where("poll_id = ?", pollID).UpdateColumn("deleted_at", at).Error; err != nil {
+			return err
+		}
+	}
+	return tx.Model(&models.Poll{}).Where("id = ?", pollID).UpdateColumn("deleted_at", at).Error
+}
+
+// trashOption 在事务中将选项及其投票记录移入回收站
+func trashOption(tx *gorm.DB, optionID string, at time.Time) error {
+	if err := tx.Model(&models.Vote{}).Where("option_id = ?", optionID).UpdateColumn("deleted_at", at).Error; err != nil {
+		return err
+	}
+	return tx.Model(&models.Option{}).Where("id = ?", optionID).UpdateColumn("deleted_at", at).Error
+}
+
+// trashComment 在事务中将评论及其所有层级的回复移入回收站
+func trashComment(tx *gorm.DB, commentID string, at time.Time) error {
+	ids, err := commentReplyIDs(tx, commentID)
+	if err != nil {
+		return err
+	}
+	ids = append(ids, commentID)
+	return tx.Model(&models.Comment{}).Where("id IN (?)", ids).UpdateColumn("deleted_at", at).Error
+}
+
+// commentReplyIDs 按层级查找评论下所有回复的ID。
+// 永久删除时回复由外键级联删除；移入回收站和恢复只修改 deleted_at，不会触发外键，需要按这里找到的回复一起处理
+func commentReplyIDs(tx *gorm.DB, commentID string) ([]string, error) {
+	var ids []string
+	seen := map[string]bool{commentID: true}
+	parents := []string{commentID}
+	for len(parents) > 0 {
+		var children []string
+		if err := tx.Model(&models.Comment{}).Where("parent_id IN (?)", parents).Pluck("id", &children).Error; err != nil {
+			return nil, err
+		}
+		parents = parents[:0]
+		for _, id := range children {
+			// 防止异常数据中的循环引用
+			if !seen[id] {
+				seen[id] = true
+				ids = append(ids, id)
+				parents = append(parents, id)
+			}
+		}
+	}
+	return ids, nil
+}
+
+// restoreTrashed 在事务中恢复 query 匹配的、与 at 同时移入回收站的记录
+func restoreTrashed(tx *gorm.DB, model interface{}, at *time.Time, query string, args ...interface{}) error {
+	return tx.Unscoped().Model(model).
+		Where(query, args...).
+		Where("deleted_at = ?", at).
+		UpdateColumn("deleted_at", nil).Error
+}
+
+// ListTrash 获取当前用户可以恢复的回收站内容，管理员可以看到所有内容
+func ListTrash(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未提供有效的用户ID"})
+		return
+	}
+	isAdmin := user.Role == models.RoleAdmin
+
+	// 投票：创建者可以恢复
+	polls := []models.Poll{}
+	query := database.DB.Unscoped().Where("deleted_at IS NOT NULL")
+	if !isAdmin {
+		query = query.Where("creator_id = ?", user.ID)
+	}
+	query.Order("deleted_at DESC").Find(&polls)
+
+	// 选项：只列出单独删除的选项，随投票一起删除的选项会随投票恢复
+	options := []models.Option{}
+	query = database.DB.Unscoped().Table("options").
+		Select("options.*").
+		Joins("JOIN polls ON polls.id = options.poll_id").
+		Where("options.deleted_at IS NOT NULL AND polls.deleted_at IS NULL")
+	if !isAdmin {
+		query = query.Where("polls.creator_id = ?", user.ID)
+	}
+	query.Order("options.deleted_at DESC").Find(&options)
+
+	// 评论：作者可以恢复，同样只列出投票未被删除的评论
+	comments := []models.Comment{}
+	query = database.DB.Unscoped().Table("comments").
+		Select("comments.*").
+		Joins("JOIN polls ON polls.id = comments.poll_id").
+		Where("comments.deleted_at IS NOT NULL AND polls.deleted_at IS NULL")
+	if !isAdmin {
+		query = query.Where("comments.user_id = ?", user.ID)
+	}
+	query.Order("comments.deleted_at DESC").Find(&comments)
+
+	c.JSON(http.StatusOK, gin.H{
+		"polls":          polls,
+		"options":        options,
+		"comments":       comments,
+		"retention_days": int(trash.Retention().Hours() / 24),
+	})
+}
+
+// RestorePoll 从回收站恢复投票，以及与投票一起删除的选项、投票记录和评论
+func RestorePoll(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未提供有效的用户ID"})
+		return
+	}
+
+	var poll models.Poll
+	if err := database.DB.Unscoped().First(&poll, "id = ? AND deleted_at IS NOT NULL", c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "回收站中没有该投票"})
+		return
+	}
+
+	if !canManagePoll(user, poll) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "只有投票创建者或管理员可以恢复投票"})
+		return
+	}
+
+	tx := database.DB.Begin()
+	for _, model := range []interface{}{&models.Vote{}, &models.Option{}, &models.Comment{}} {
+		if err := restoreTrashed(tx, model, poll.DeletedAt, "poll_id = ?", poll.ID); err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "恢复投票失败"})
+			return
+		}
+	}
+	if err := restoreTrashed(tx, &models.Poll{}, poll.DeletedAt, "id = ?", poll.ID); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "恢复投票失败"})
+		return
+	}
+
+	before := poll
+	tx.Preload("Options").First(&poll, "id = ?", poll.ID)
+	if err := recordAudit(tx, c, models.AuditEntry{Action: models.AuditPollRestore, TargetType: models.AuditTargetPoll, TargetID: poll.ID, PollID: poll.ID}, before, poll); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "恢复投票失败"})
+		return
+	}
+	if err := events.Record(tx, events.PollRestored{Poll: poll}); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "恢复投票失败"})
+		return
+	}
+	if err := tx.Commit().Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "恢复投票失败"})
+		return
+	}
+	events.Notify()
+
+	c.JSON(http.StatusOK, poll)
+}
+
+// RestoreOption 从回收站恢复选项及其投票记录，所属投票必须未被删除
+func RestoreOption(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未提供有效的用户ID"})
+		return
+	}
+
+	var option models.Option
+	if err := database.DB.Unscoped().First(&option, "id = ? AND deleted_at IS NOT NULL", c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "回收站中没有该选项"})
+		return
+	}
+
+	var poll models.Poll
+	if err := database.DB.First(&poll, "id = ?", option.PollID).Error; err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "所属投票已被删除，请先恢复投票"})
+		return
+	}
+
+	if !canManagePoll(user, poll) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "只有投票创建者或管理员可以恢复选项"})
+		return
+	}
+
+	tx := database.DB.Begin()
+	if err := restoreTrashed(tx, &models.Vote{}, option.DeletedAt, "option_id = ?", option.ID); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "恢复选项失败"})
+		return
+	}
+	if err := restoreTrashed(tx, &models.Option{}, option.DeletedAt, "id = ?", option.ID); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "恢复选项失败"})
+		return
+	}
+
+	before := option
+	tx.First(&option, "id = ?", option.ID)
+	if err := recordAudit(tx, c, models.AuditEntry{Action: models.AuditOptionRestore, TargetType: models.AuditTargetOption, TargetID: option.ID, PollID: option.PollID}, before, option); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "恢复选项失败"})
+		return
+	}
+	if err := events.Record(tx, events.OptionRestored{Option: option}); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "恢复选项失败"})
+		return
+	}
+	if err := tx.Commit().Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "恢复选项失败"})
+		return
+	}
+	events.Notify()
+
+	c.JSON(http.StatusOK, option)
+}
+
+// RestoreComment 从回收站恢复评论及与其一起删除的各层回复，所属投票和父评论必须未被删除
+func RestoreComment(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未提供有效的用户ID"})
+		return
+	}
+
+	var comment models.Comment
+	if err := database.DB.Unscoped().First(&comment, "id = ? AND deleted_at IS NOT NULL", c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "回收站中没有该评论"})
+		return
+	}
+
+	if user.Role != models.RoleAdmin && user.ID != comment.UserID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "只有评论作者或管理员可以恢复评论"})
+		return
+	}
+
+	var poll models.Poll
+	if err := database.DB.First(&poll, "id = ?", comment.PollID).Error; err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "所属投票已被删除，请先恢复投票"})
+		return
+	}
+	if comment.ParentID != "" {
+		var parent models.Comment
+		if err := database.DB.First(&parent, "id = ?", comment.ParentID).Error; err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "父评论已被删除，请先恢复父评论"})
+			return
+		}
+	}
+
+	tx := database.DB.Begin()
+	// 在回收站中查找所有层级的回复，只恢复与该评论一起删除的
+	ids, err := commentReplyIDs(tx.Unscoped(), comment.ID)
+	if err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "恢复评论失败"})
+		return
+	}
+	ids = append(ids, comment.ID)
+	if err := restoreTrashed(tx, &models.Comment{}, comment.DeletedAt, "id IN (?)", ids); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "恢复评论失败"})
+		return
+	}
+
+	before := comment
+	tx.Preload("User").First(&comment, "id = ?", comment.ID)
+	if err := recordAudit(tx, c, models.AuditEntry{Action: models.AuditCommentRestore, TargetType: models.AuditTargetComment, TargetID: comment.ID, PollID: comment.PollID}, before, comment); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "恢复评论失败"})
+		return
+	}
+	if err := events.Record(tx, events.CommentRestored{Comment: comment}); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "恢复评论失败"})
+		return
+	}
+	if err := tx.Commit().Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "恢复评论失败"})
+		return
+	}
+	events.Notify()
+
+	c.JSON(http.StatusOK, comment)
+}
@@ -9,7 +9,7 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
-// CreateUser 创建用户
+// CreateUser 创建用户。新用户都是普通用户，角色只能由管理员通过 UpdateUserRole 修改
 func CreateUser(c *gin.Context) {
 	var input struct {
 		Username string `json:"username" binding:"required"`
@@ -30,11 +30,29 @@ func CreateUser(c *gin.Context) {
 	// 创建用户
 	user := models.User{
 		Username:  input.Username,
+		Role:      models.RoleUser,
 		CreatedAt: time.Now(),
 		UpdatedAt: time.Now(),
 	}
 
-	if err := database.DB.Create(&user).Error; err != nil {
+	tx := database.DB.Begin()
+	if err := tx.Create(&user).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建用户失败"})
+		return
+	}
+
+	// 未登录时视为用户自行注册
+	entry := models.AuditEntry{Action: models.AuditUserCreate, TargetType: models.AuditTargetUser, TargetID: user.ID}
+	if c.GetHeader("User-ID") == "" {
+		entry.ActorID = user.ID
+	}
+	if err := recordAudit(tx, c, entry, nil, user); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建用户失败"})
+		return
+	}
+	if err := tx.Commit().Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建用户失败"})
 		return
 	}
@@ -42,6 +60,65 @@ func CreateUser(c *gin.Context) {
 	c.JSON(http.StatusCreated, user)
 }
 
+// UpdateUserRole 修改用户角色，仅管理员可用。管理员不能修改自己的角色，避免没有管理员
+func UpdateUserRole(c *gin.Context) {
+	admin, ok := currentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未提供有效的用户ID"})
+		return
+	}
+	if admin.Role != models.RoleAdmin {
+		c.JSON(http.StatusForbidden, gin.H{"error": "只有管理员可以修改用户角色"})
+		return
+	}
+
+	var input struct {
+		Role string `json:"role" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !models.ValidRole(input.Role) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的用户角色"})
+		return
+	}
+
+	var user models.User
+	if err := database.DB.First(&user, "id = ?", c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "用户不存在"})
+		return
+	}
+	if user.ID == admin.ID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "不能修改自己的角色"})
+		return
+	}
+	if user.Role == input.Role {
+		c.JSON(http.StatusOK, user)
+		return
+	}
+
+	before := user
+	tx := database.DB.Begin()
+	if err := tx.Model(&user).Updates(map[string]interface{}{"role": input.Role, "updated_at": time.Now()}).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "修改用户角色失败"})
+		return
+	}
+	entry := models.AuditEntry{Action: models.AuditUserRoleUpdate, TargetType: models.AuditTargetUser, TargetID: user.ID}
+	if err := recordAudit(tx, c, entry, before, user); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "修改用户角色失败"})
+		return
+	}
+	if err := tx.Commit().Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "修改用户角色失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, user)
+}
+
 // GetUser 获取用户信息
 func GetUser(c *gin.Context) {
 	id := c.Param("id")
@@ -52,6 +129,12 @@ func GetUser(c *gin.Context) {
 		return
 	}
 
+	// 查看自己的资料时返回未读通知数
+	if c.GetHeader("User-ID") == user.ID {
+		unread := unreadNotificationCount(user.ID)
+		user.UnreadNotifications = &unread
+	}
+
 	c.JSON(http.StatusOK, user)
 }
 
@@ -74,4 +157,27 @@ func ListUsers(c *gin.Context) {
 	database.DB.Find(&users)
 
 	c.JSON(http.StatusOK, users)
-} 
\ No newline at end of file
+}
+
+// currentUser 获取请求头中 User-ID 对应的用户（在实际应用中，这应该从认证中间件获取）
+func currentUser(c *gin.Context) (models.User, bool) {
+	var user models.User
+	userID := c.GetHeader("User-ID")
+	if userID == "" {
+		return user, false
+	}
+	if err := database.DB.First(&user, "id = ?", userID).Error; err != nil {
+		return user, false
+	}
+	return user, true
+}
+
+// canModerate 用户是否可以审核投票的评论（审核员、管理员或投票创建者）
+func canModerate(user models.User, poll models.Poll) bool {
+	return user.Role == models.RoleModerator || canManagePoll(user, poll)
+}
+
+// canManagePoll 用户是否可以管理投票（投票创建者或管理员）
+func canManagePoll(user models.User, poll models.Poll) bool {
+	return user.Role == models.RoleAdmin || (poll.CreatorID != "" && poll.CreatorID == user.ID)
+}
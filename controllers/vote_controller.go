@@ -1,39 +1,64 @@
 package controllers
 
 import (
+	"errors"
 	"net/http"
 	"time"
 	"vote-demo/database"
+	"vote-demo/events"
 	"vote-demo/models"
 
 	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
 )
 
+// errVoteFailed 写入投票记录失败
+var errVoteFailed = errors.New("投票失败")
+
+// voteInput 投票请求体，HTTP 接口和实时房间相同
+type voteInput struct {
+	OptionIDs     []string           `json:"option_ids"`
+	Allocations   map[string]int     `json:"allocations"`   // 二次方投票/点投票：选项ID -> 票数或点数
+	Availability  map[string]string  `json:"availability"`  // 时间安排投票：选项ID -> yes/if_need_be/no
+	Probabilities map[string]float64 `json:"probabilities"` // 预测投票：选项ID -> 概率
+}
+
 // CastVote 进行投票
 func CastVote(c *gin.Context) {
-	pollID := c.Param("id")
+	var input voteInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	result, err := castVote(actorOf(c), c.Param("id"), input)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, result)
+}
 
+// castVote 按投票类型验证并写入投票，返回响应体。被拒绝的请求返回 *requestError
+func castVote(by actor, pollID string, input voteInput) (gin.H, error) {
 	// 检查投票是否存在
 	var poll models.Poll
 	if err := database.DB.First(&poll, "id = ?", pollID).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "投票不存在"})
-		return
+		return nil, &requestError{Status: http.StatusNotFound, Body: gin.H{"error": "投票不存在"}}
 	}
 
 	// 检查投票是否已结束
 	if !poll.EndTime.IsZero() && poll.EndTime.Before(time.Now()) {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "投票已结束"})
-		return
+		return nil, badRequest("投票已结束")
 	}
 
 	// 检查投票是否活跃
 	if !poll.IsActive {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "投票已关闭"})
-		return
+		return nil, badRequest("投票已关闭")
 	}
 
 	// 获取用户ID（在实际应用中，这应该从认证中间件获取）
-	userID := c.GetHeader("User-ID")
+	userID := by.UserID
 	if userID == "" {
 		// 为了演示，如果没有提供用户ID，我们创建一个临时用户
 		user := models.User{
@@ -42,27 +67,35 @@ func CastVote(c *gin.Context) {
 			UpdatedAt: time.Now(),
 		}
 		if err := database.DB.Create(&user).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "创建临时用户失败"})
-			return
+			return nil, errors.New("创建临时用户失败")
 		}
 		userID = user.ID
 	}
 
-	var input struct {
-		OptionIDs []string `json:"option_ids" binding:"required"`
+	switch poll.Type {
+	case models.PollTypeQuadratic:
+		// 二次方投票按信用点预算分配票数，单独处理
+		return castQuadraticVote(by, poll, userID, input.Allocations)
+	case models.PollTypeDot:
+		// 点投票按总点数分配，单独处理
+		return castDotVote(by, poll, userID, input.Allocations)
+	case models.PollTypeSchedule:
+		// 时间安排投票需要对每个时间段作出回答，单独处理
+		return castScheduleVote(by, poll, userID, input.Availability)
+	case models.PollTypeForecast:
+		// 预测投票需要给出各选项的概率，单独处理
+		return castForecastVote(by, poll, userID, input.Probabilities)
 	}
 
-	if err := c.ShouldBindJSON(&input); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-		return
+	if len(input.OptionIDs) == 0 {
+		return nil, badRequest("未选择任何选项")
 	}
 
 	// 验证选项是否属于该投票
 	for _, optionID := range input.OptionIDs {
 		var option models.Option
 		if err := database.DB.Where("id = ? AND poll_id = ?", optionID, pollID).First(&option).Error; err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "选项不存在或不属于该投票"})
-			return
+			return nil, badRequest("选项不存在或不属于该投票")
 		}
 	}
 
@@ -70,40 +103,41 @@ func CastVote(c *gin.Context) {
 	switch poll.Type {
 	case models.PollTypeBinary, models.PollTypeSingle:
 		if len(input.OptionIDs) != 1 {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "该投票类型只允许选择一个选项"})
-			return
+			return nil, badRequest("该投票类型只允许选择一个选项")
 		}
 	case models.PollTypeMulti:
 		// 多选类型允许多个选项，无需额外验证
 	default:
-		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的投票类型"})
-		return
+		return nil, badRequest("无效的投票类型")
 	}
 
 	// 检查用户是否已经投过票
 	var existingVotes []models.Vote
 	database.DB.Where("poll_id = ? AND user_id = ?", pollID, userID).Find(&existingVotes)
 
-	// 如果用户已经投过票，根据投票类型处理
-	if len(existingVotes) > 0 {
-		// 对于单选和二分类型，删除之前的投票
-		if poll.Type == models.PollTypeBinary || poll.Type == models.PollTypeSingle {
+	// 对于多选类型，检查是否重复投票
+	if poll.Type == models.PollTypeMulti {
+		for _, optionID := range input.OptionIDs {
 			for _, vote := range existingVotes {
-				database.DB.Delete(&vote)
-			}
-		} else {
-			// 对于多选类型，检查是否重复投票
-			for _, optionID := range input.OptionIDs {
-				for _, vote := range existingVotes {
-					if vote.OptionID == optionID {
-						c.JSON(http.StatusBadRequest, gin.H{"error": "您已经为该选项投过票"})
-						return
-					}
+				if vote.OptionID == optionID {
+					return nil, badRequest("您已经为该选项投过票")
 				}
 			}
 		}
 	}
 
+	tx := database.DB.Begin()
+
+	// 对于单选和二分类型，删除之前的投票
+	var previous []models.Vote
+	if poll.Type == models.PollTypeBinary || poll.Type == models.PollTypeSingle {
+		var err error
+		if previous, err = deleteUserVotes(tx, pollID, userID); err != nil {
+			tx.Rollback()
+			return nil, errVoteFailed
+		}
+	}
+
 	// 创建投票记录
 	var votes []models.Vote
 	for _, optionID := range input.OptionIDs {
@@ -113,17 +147,57 @@ func CastVote(c *gin.Context) {
 			UserID:    userID,
 			CreatedAt: time.Now(),
 		}
-		if err := database.DB.Create(&vote).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "投票失败"})
-			return
+		if err := tx.Create(&vote).Error; err != nil {
+			tx.Rollback()
+			return nil, errVoteFailed
 		}
 		votes = append(votes, vote)
 	}
 
-	c.JSON(http.StatusCreated, gin.H{
+	if err := recordVoteCast(tx, by, pollID, userID, previous, votes); err != nil {
+		tx.Rollback()
+		return nil, errVoteFailed
+	}
+	if err := tx.Commit().Error; err != nil {
+		return nil, errVoteFailed
+	}
+	events.Notify()
+
+	return gin.H{
 		"message": "投票成功",
 		"votes":   votes,
-	})
+	}, nil
+}
+
+// deleteUserVotes 在事务中永久删除用户在投票中之前的投票记录（被替换的投票不进入回收站），返回被删除的记录
+func deleteUserVotes(tx *gorm.DB, pollID, userID string) ([]models.Vote, error) {
+	var previous []models.Vote
+	if err := tx.Where("poll_id = ? AND user_id = ?", pollID, userID).Find(&previous).Error; err != nil {
+		return nil, err
+	}
+	if err := tx.Unscoped().Where("poll_id = ? AND user_id = ? AND deleted_at IS NULL", pollID, userID).Delete(&models.Vote{}).Error; err != nil {
+		return nil, err
+	}
+	return previous, nil
+}
+
+// recordVoteCast 在投票事务中写入 VoteCast 事件和审计记录，previous 为本次投票替换掉的投票记录
+func recordVoteCast(tx *gorm.DB, by actor, pollID, userID string, previous, votes []models.Vote) error {
+	if err := events.Record(tx, events.VoteCast{PollID: pollID, UserID: userID, Votes: votes}); err != nil {
+		return err
+	}
+	entry := models.AuditEntry{
+		ActorID:    userID,
+		Action:     models.AuditVoteCast,
+		TargetType: models.AuditTargetPoll,
+		TargetID:   pollID,
+		PollID:     pollID,
+	}
+	var before interface{}
+	if len(previous) > 0 {
+		before = previous
+	}
+	return recordAuditAs(tx, by, entry, before, votes)
 }
 
 // GetUserVotes 获取用户在特定投票中的投票记录
@@ -154,4 +228,4 @@ func GetUserVotes(c *gin.Context) {
 		"votes":   votes,
 		"options": options,
 	})
-} 
\ No newline at end of file
+}
@@ -0,0 +1,189 @@
+package controllers
+
+import (
+	"net/http"
+	"time"
+	"vote-demo/database"
+	"vote-demo/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+)
+
+// insertPollWatch 写入关注记录，返回是否新建。已经关注时不做修改，并发的关注请求不会因主键冲突而失败
+func insertPollWatch(db *gorm.DB, watch *models.PollWatch) (bool, error) {
+	result := db.Set("gorm:insert_option", "ON CONFLICT DO NOTHING").Create(watch)
+	return result.RowsAffected > 0, result.Error
+}
+
+// watchPoll 让用户关注投票，已经关注时不做修改。用于创建投票和发表评论时自动关注
+func watchPoll(db *gorm.DB, userID, pollID string) error {
+	if userID == "" {
+		return nil
+	}
+	_, err := insertPollWatch(db, &models.PollWatch{UserID: userID, PollID: pollID, LastVisitedAt: time.Now()})
+	return err
+}
+
+// touchPollWatch 记录关注者查看投票的时间，请求没有用户或用户没有关注投票时不做任何事
+func touchPollWatch(c *gin.Context, pollID string) {
+	userID := c.GetHeader("User-ID")
+	if userID == "" {
+		return
+	}
+	database.DB.Model(&models.PollWatch{}).
+		Where("user_id = ? AND poll_id = ?", userID, pollID).
+		UpdateColumn("last_visited_at", time.Now())
+}
+
+// WatchPoll 关注投票，已经关注时返回现有的关注记录
+func WatchPoll(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未提供有效的用户ID"})
+		return
+	}
+
+	var poll models.Poll
+	if err := database.DB.First(&poll, "id = ?", c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "投票不存在"})
+		return
+	}
+
+	watch := models.PollWatch{UserID: user.ID, PollID: poll.ID, LastVisitedAt: time.Now()}
+	tx := database.DB.Begin()
+	created, err := insertPollWatch(tx, &watch)
+	if err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "关注投票失败"})
+		return
+	}
+	if !created {
+		tx.Rollback()
+		database.DB.First(&watch, "user_id = ? AND poll_id = ?", user.ID, poll.ID)
+		c.JSON(http.StatusOK, watch)
+		return
+	}
+	if err := recordAudit(tx, c, models.AuditEntry{Action: models.AuditPollWatch, TargetType: models.AuditTargetPoll, TargetID: poll.ID, PollID: poll.ID}, nil, watch); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "关注投票失败"})
+		return
+	}
+	if err := tx.Commit().Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "关注投票失败"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, watch)
+}
+
+// UnwatchPoll 取消关注投票
+func UnwatchPoll(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未提供有效的用户ID"})
+		return
+	}
+
+	var watch models.PollWatch
+	if err := database.DB.First(&watch, "user_id = ? AND poll_id = ?", user.ID, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "没有关注该投票"})
+		return
+	}
+
+	tx := database.DB.Begin()
+	result := tx.Where("user_id = ? AND poll_id = ?", watch.UserID, watch.PollID).Delete(&models.PollWatch{})
+	if result.Error != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "取消关注失败"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		// 并发的取消关注请求已经删除了关注记录
+		tx.Rollback()
+		c.JSON(http.StatusNotFound, gin.H{"error": "没有关注该投票"})
+		return
+	}
+	if err := recordAudit(tx, c, models.AuditEntry{Action: models.AuditPollUnwatch, TargetType: models.AuditTargetPoll, TargetID: watch.PollID, PollID: watch.PollID}, watch, nil); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "取消关注失败"})
+		return
+	}
+	if err := tx.Commit().Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "取消关注失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "已取消关注"})
+}
+
+// ListWatchedPolls 获取当前用户关注的投票，以及上次查看后其他用户发表的评论数和投票人数。
+// 在回收站中的投票不会返回
+func ListWatchedPolls(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未提供有效的用户ID"})
+		return
+	}
+
+	var watches []models.PollWatch
+	database.DB.Where("user_id = ?", user.ID).Order("created_at DESC").Find(&watches)
+
+	pollIDs := make([]string, 0, len(watches))
+	for _, watch := range watches {
+		pollIDs = append(pollIDs, watch.PollID)
+	}
+	polls := make(map[string]models.Poll, len(pollIDs))
+	if len(pollIDs) > 0 {
+		var rows []models.Poll
+		database.DB.Preload("Options").Where("id IN (?)", pollIDs).Find(&rows)
+		for _, poll := range rows {
+			revealQuizAnswers(&poll)
+			polls[poll.ID] = poll
+		}
+	}
+
+	newComments := watchedPollCounts(database.DB.Table("comments").
+		Select("comments.poll_id, COUNT(*) AS count").
+		Joins("JOIN poll_watches ON poll_watches.poll_id = comments.poll_id AND poll_watches.user_id = ?", user.ID).
+		Where("comments.created_at > poll_watches.last_visited_at AND comments.user_id <> ?", user.ID).
+		Where("comments.status = ? AND comments.is_deleted = ? AND comments.deleted_at IS NULL", models.CommentVisible, false).
+		Group("comments.poll_id"))
+	newVotes := watchedPollCounts(database.DB.Table("votes").
+		Select("votes.poll_id, COUNT(DISTINCT votes.user_id) AS count").
+		Joins("JOIN poll_watches ON poll_watches.poll_id = votes.poll_id AND poll_watches.user_id = ?", user.ID).
+		Where("votes.created_at > poll_watches.last_visited_at AND votes.user_id <> ?", user.ID).
+		Where("votes.deleted_at IS NULL").
+		Group("votes.poll_id"))
+
+	items := make([]models.WatchedPoll, 0, len(watches))
+	for _, watch := range watches {
+		poll, ok := polls[watch.PollID]
+		if !ok {
+			continue
+		}
+		items = append(items, models.WatchedPoll{
+			Poll:          poll,
+			WatchedAt:     watch.CreatedAt,
+			LastVisitedAt: watch.LastVisitedAt,
+			NewComments:   newComments[watch.PollID],
+			NewVotes:      newVotes[watch.PollID],
+		})
+	}
+
+	c.JSON(http.StatusOK, items)
+}
+
+// watchedPollCounts 执行按投票分组的计数查询
+func watchedPollCounts(query *gorm.DB) map[string]int {
+	var rows []struct {
+		PollID string
+		Count  int
+	}
+	query.Scan(&rows)
+	counts := make(map[string]int, len(rows))
+	for _, row := range rows {
+		counts[row.PollID] = row.Count
+	}
+	return counts
+}
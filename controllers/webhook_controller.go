@@ -0,0 +1,243 @@
+package controllers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"vote-demo/database"
+	"vote-demo/models"
+	"vote-demo/webhooks"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 支持订阅的 Webhook 事件
+var webhookEvents = map[string]bool{
+	models.WebhookEventPollCreated:  true,
+	models.WebhookEventVoteCast:     true,
+	models.WebhookEventPollClosed:   true,
+	models.WebhookEventCommentAdded: true,
+}
+
+// canManageWebhook 用户是否可以管理 Webhook：全局 Webhook 仅管理员，投票的 Webhook 为投票创建者或管理员
+func canManageWebhook(user models.User, webhook models.Webhook) bool {
+	if user.Role == models.RoleAdmin {
+		return true
+	}
+	if webhook.PollID == "" {
+		return false
+	}
+
+	var poll models.Poll
+	if err := database.DB.First(&poll, "id = ?", webhook.PollID).Error; err != nil {
+		return false
+	}
+	return canManagePoll(user, poll)
+}
+
+// generateWebhookSecret 生成随机的签名密钥
+func generateWebhookSecret() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// CreateWebhook 创建 Webhook
+func CreateWebhook(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未提供有效的用户ID"})
+		return
+	}
+
+	var input struct {
+		PollID string   `json:"poll_id"` // 为空表示全局 Webhook
+		URL    string   `json:"url" binding:"required"`
+		Events []string `json:"events" binding:"required,min=1"`
+		Secret string   `json:"secret"` // 可选，未提供时自动生成
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := webhooks.ValidateURL(input.URL); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	for _, event := range input.Events {
+		if !webhookEvents[event] {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "不支持的事件: " + event})
+			return
+		}
+	}
+
+	if input.PollID != "" {
+		var poll models.Poll
+		if err := database.DB.First(&poll, "id = ?", input.PollID).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "投票不存在"})
+			return
+		}
+	}
+
+	webhook := models.Webhook{
+		PollID:    input.PollID,
+		CreatorID: user.ID,
+		URL:       input.URL,
+		Secret:    input.Secret,
+		Events:    strings.Join(input.Events, ","),
+		IsActive:  true,
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+
+	if !canManageWebhook(user, webhook) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "只有投票创建者或管理员可以管理 Webhook"})
+		return
+	}
+
+	if webhook.Secret == "" {
+		var err error
+		if webhook.Secret, err = generateWebhookSecret(); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "生成签名密钥失败"})
+			return
+		}
+	}
+
+	tx := database.DB.Begin()
+	if err := tx.Create(&webhook).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建 Webhook 失败"})
+		return
+	}
+	if err := recordAudit(tx, c, models.AuditEntry{Action: models.AuditWebhookCreate, TargetType: models.AuditTargetWebhook, TargetID: webhook.ID, PollID: webhook.PollID}, nil, webhook); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建 Webhook 失败"})
+		return
+	}
+	if err := tx.Commit().Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建 Webhook 失败"})
+		return
+	}
+
+	// 签名密钥只在创建时返回一次
+	c.JSON(http.StatusCreated, gin.H{
+		"webhook": webhook,
+		"secret":  webhook.Secret,
+	})
+}
+
+// ListWebhooks 获取当前用户可以管理的 Webhook
+func ListWebhooks(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未提供有效的用户ID"})
+		return
+	}
+
+	query := database.DB.Order("created_at DESC")
+	if pollID := c.Query("poll_id"); pollID != "" {
+		query = query.Where("poll_id = ?", pollID)
+	}
+
+	var webhooks []models.Webhook
+	query.Find(&webhooks)
+
+	visible := []models.Webhook{}
+	for _, webhook := range webhooks {
+		if canManageWebhook(user, webhook) {
+			visible = append(visible, webhook)
+		}
+	}
+
+	c.JSON(http.StatusOK, visible)
+}
+
+// DeleteWebhook 删除 Webhook
+func DeleteWebhook(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未提供有效的用户ID"})
+		return
+	}
+
+	var webhook models.Webhook
+	if err := database.DB.First(&webhook, "id = ?", c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Webhook 不存在"})
+		return
+	}
+
+	if !canManageWebhook(user, webhook) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "只有投票创建者或管理员可以管理 Webhook"})
+		return
+	}
+
+	// 删除 Webhook 及其投送记录
+	tx := database.DB.Begin()
+	if err := tx.Where("webhook_id = ?", webhook.ID).Delete(&models.WebhookDelivery{}).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "删除 Webhook 失败"})
+		return
+	}
+	if err := tx.Delete(&webhook).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "删除 Webhook 失败"})
+		return
+	}
+	if err := recordAudit(tx, c, models.AuditEntry{Action: models.AuditWebhookDelete, TargetType: models.AuditTargetWebhook, TargetID: webhook.ID, PollID: webhook.PollID}, webhook, nil); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "删除 Webhook 失败"})
+		return
+	}
+	if err := tx.Commit().Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "删除 Webhook 失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Webhook 已删除"})
+}
+
+// ListWebhookDeliveries 获取 Webhook 的投送记录，可按状态过滤
+func ListWebhookDeliveries(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未提供有效的用户ID"})
+		return
+	}
+
+	var webhook models.Webhook
+	if err := database.DB.First(&webhook, "id = ?", c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Webhook 不存在"})
+		return
+	}
+
+	if !canManageWebhook(user, webhook) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "只有投票创建者或管理员可以管理 Webhook"})
+		return
+	}
+
+	limit := 50
+	if value, err := strconv.Atoi(c.Query("limit")); err == nil && value > 0 && value <= 500 {
+		limit = value
+	}
+
+	query := database.DB.Where("webhook_id = ?", webhook.ID)
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var deliveries []models.WebhookDelivery
+	query.Order("created_at DESC").Limit(limit).Find(&deliveries)
+
+	c.JSON(http.StatusOK, gin.H{
+		"webhook":    webhook,
+		"deliveries": deliveries,
+	})
+}
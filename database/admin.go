@@ -0,0 +1,48 @@
+package database
+
+import (
+	"encoding/json"
+	"time"
+	"vote-demo/models"
+)
+
+// EnsureAdmin 确保用户名为 username 的用户存在并且是管理员，不存在时创建。
+// 公开的创建用户接口只能创建普通用户，第一个管理员通过环境变量 ADMIN_USERNAME 在启动时指定
+func EnsureAdmin(username string) (models.User, error) {
+	var user models.User
+	tx := DB.Begin()
+
+	action := models.AuditUserRoleUpdate
+	var before interface{}
+	if err := tx.Where("username = ?", username).First(&user).Error; err != nil {
+		action = models.AuditUserCreate
+		user = models.User{Username: username, Role: models.RoleAdmin, CreatedAt: time.Now(), UpdatedAt: time.Now()}
+		if err := tx.Create(&user).Error; err != nil {
+			tx.Rollback()
+			return user, err
+		}
+	} else if user.Role == models.RoleAdmin {
+		tx.Rollback()
+		return user, nil
+	} else {
+		before = user
+		if err := tx.Model(&user).Updates(map[string]interface{}{"role": models.RoleAdmin, "updated_at": time.Now()}).Error; err != nil {
+			tx.Rollback()
+			return user, err
+		}
+	}
+
+	// 启动时的修改没有操作者和请求ID
+	entry := models.AuditEntry{Action: action, TargetType: models.AuditTargetUser, TargetID: user.ID, CreatedAt: time.Now()}
+	if before != nil {
+		data, _ := json.Marshal(before)
+		entry.Before = string(data)
+	}
+	data, _ := json.Marshal(user)
+	entry.After = string(data)
+	if err := tx.Create(&entry).Error; err != nil {
+		tx.Rollback()
+		return user, err
+	}
+	return user, tx.Commit().Error
+}
@@ -10,10 +10,20 @@ import (
 
 var DB *gorm.DB
 
+// Path 数据库文件路径
+var Path = "vote.db"
+
+// Open 打开数据库连接并启用外键约束。
+// SQLite 默认不检查外键，需要在每个连接上通过 _foreign_keys 参数开启，
+// 这样删除投票、选项时数据库会按 ON DELETE CASCADE 级联删除依附的记录
+func Open(path string) (*gorm.DB, error) {
+	return gorm.Open("sqlite3", path+"?_foreign_keys=1")
+}
+
 // InitDB 初始化数据库连接
 func InitDB() {
 	var err error
-	DB, err = gorm.Open("sqlite3", "vote.db")
+	DB, err = Open(Path)
 	if err != nil {
 		log.Fatalf("无法连接到数据库: %v", err)
 	}
@@ -25,15 +35,43 @@ func InitDB() {
 	autoMigrate()
 }
 
-// 自动迁移数据库结构
+// 自动迁移数据库结构。
+// 外键约束只在建表时生效，已有的表缺少约束时由 migrateForeignKeys 重建，
+// 有孤立记录而无法重建的表可以用 cmd/integrity-check 检查
 func autoMigrate() {
-	DB.AutoMigrate(&models.Poll{}, &models.Option{}, &models.Vote{}, &models.User{}, &models.Comment{})
+	scoreMissing := DB.HasTable(&models.Comment{}) && !DB.Dialect().HasColumn("comments", "score")
+	values := []interface{}{&models.Poll{}, &models.Option{}, &models.Vote{}, &models.User{}, &models.Comment{}, &models.ForecastScore{}, &models.Webhook{}, &models.WebhookDelivery{}, &models.OutboxEvent{}, &models.AuditEntry{}, &models.PollRevision{}, &models.OptionRevision{}, &models.CommentReaction{}, &models.CommentReport{}, &models.FilterRule{}, &models.CommentMention{}, &models.Notification{}, &models.CommentRevision{}, &models.NotificationPreference{}, &models.PollWatch{}}
+	DB.AutoMigrate(values...)
+	migrateForeignKeys(values...)
+	// 评论分页按 (poll_id, parent_id) 下的排序键查询，根评论的 parent_id 都为空，因此索引以 poll_id 开头
+	DB.Model(&models.Comment{}).AddIndex("idx_comment_thread", "poll_id", "parent_id", "created_at", "id")
+	DB.Model(&models.Comment{}).AddIndex("idx_comment_thread_score", "poll_id", "parent_id", "score", "created_at", "id")
+	if scoreMissing {
+		backfillCommentScores()
+	}
 	log.Println("数据库迁移完成")
 }
 
+// backfillCommentScores 为新增 score 列之前已有反应的评论计算得分
+func backfillCommentScores() {
+	var rows []struct {
+		CommentID string
+		Up        int
+		Down      int
+	}
+	DB.Model(&models.CommentReaction{}).
+		Select("comment_id, SUM(CASE WHEN kind = ? THEN 1 ELSE 0 END) AS up, SUM(CASE WHEN kind = ? THEN 1 ELSE 0 END) AS down", models.ReactionUp, models.ReactionDown).
+		Where("kind IN (?)", []string{models.ReactionUp, models.ReactionDown}).
+		Group("comment_id").
+		Scan(&rows)
+	for _, row := range rows {
+		DB.Model(&models.Comment{}).Where("id = ?", row.CommentID).UpdateColumn("score", models.WilsonScore(row.Up, row.Down))
+	}
+}
+
 // CloseDB 关闭数据库连接
 func CloseDB() {
 	if DB != nil {
 		DB.Close()
 	}
-} 
\ No newline at end of file
+}
@@ -0,0 +1,95 @@
+package database
+
+import (
+	"github.com/jinzhu/gorm"
+)
+
+// 每项检查最多列出的孤立记录ID数
+const integritySampleSize = 20
+
+// IntegrityIssue 一项完整性检查的结果
+type IntegrityIssue struct {
+	Check       string   `json:"check"`
+	Description string   `json:"description"`
+	Count       int      `json:"count"`
+	SampleIDs   []string `json:"sample_ids,omitempty"`
+}
+
+// integrityCheck 在 table 中查找满足 where 条件的孤立记录
+type integrityCheck struct {
+	name        string
+	description string
+	table       string
+	where       string
+	requires    []string // 条件中引用的其他表，缺少时跳过检查
+}
+
+var integrityChecks = []integrityCheck{
+	{"options.poll_id", "选项所属的投票不存在", "options",
+		"poll_id NOT IN (SELECT id FROM polls)", []string{"polls"}},
+	{"votes.poll_id", "投票记录所属的投票不存在", "votes",
+		"poll_id NOT IN (SELECT id FROM polls)", []string{"polls"}},
+	{"votes.option_id", "投票记录对应的选项不存在", "votes",
+		"option_id NOT IN (SELECT id FROM options)", []string{"options"}},
+	{"votes.option_poll", "投票记录的投票与选项所属的投票不一致", "votes",
+		"EXISTS (SELECT 1 FROM options WHERE options.id = votes.option_id AND options.poll_id <> votes.poll_id)", []string{"options"}},
+	{"comments.poll_id", "评论所属的投票不存在", "comments",
+		"poll_id NOT IN (SELECT id FROM polls)", []string{"polls"}},
+	{"comments.parent_id", "回复的父评论不存在", "comments",
+		"parent_id IS NOT NULL AND parent_id NOT IN (SELECT id FROM comments)", nil},
+	{"comment_reactions.comment_id", "反应对应的评论不存在", "comment_reactions",
+		"comment_id NOT IN (SELECT id FROM comments)", []string{"comments"}},
+	{"comment_reports.comment_id", "举报对应的评论不存在", "comment_reports",
+		"comment_id NOT IN (SELECT id FROM comments)", []string{"comments"}},
+	{"comment_mentions.comment_id", "提及记录对应的评论不存在", "comment_mentions",
+		"comment_id NOT IN (SELECT id FROM comments)", []string{"comments"}},
+	{"comment_revisions.comment_id", "评论修改历史对应的评论不存在", "comment_revisions",
+		"comment_id NOT IN (SELECT id FROM comments)", []string{"comments"}},
+	{"notifications.comment_id", "通知对应的评论不存在", "notifications",
+		"comment_id <> '' AND comment_id NOT IN (SELECT id FROM comments)", []string{"comments"}},
+	{"forecast_scores.poll_id", "预测评分所属的投票不存在", "forecast_scores",
+		"poll_id NOT IN (SELECT id FROM polls)", []string{"polls"}},
+	{"poll_watches.poll_id", "关注的投票不存在", "poll_watches",
+		"poll_id NOT IN (SELECT id FROM polls)", []string{"polls"}},
+	{"poll_revisions.poll_id", "投票修改历史所属的投票不存在", "poll_revisions",
+		"poll_id NOT IN (SELECT id FROM polls)", []string{"polls"}},
+	{"option_revisions.option_id", "选项修改历史对应的选项不存在", "option_revisions",
+		"option_id NOT IN (SELECT id FROM options)", []string{"options"}},
+	{"webhooks.poll_id", "Webhook 订阅的投票不存在", "webhooks",
+		"poll_id <> '' AND poll_id NOT IN (SELECT id FROM polls)", []string{"polls"}},
+	{"webhook_deliveries.webhook_id", "投递记录所属的 Webhook 不存在", "webhook_deliveries",
+		"webhook_id NOT IN (SELECT id FROM webhooks)", []string{"webhooks"}},
+}
+
+// CheckIntegrity 检查数据库中的孤立记录，包括回收站中的记录。
+// 返回每项检查的结果，Count 为 0 表示没有发现问题；缺少相关表的检查会被跳过
+func CheckIntegrity(db *gorm.DB) ([]IntegrityIssue, error) {
+	issues := make([]IntegrityIssue, 0, len(integrityChecks))
+	for _, check := range integrityChecks {
+		if !hasTables(db, append([]string{check.table}, check.requires...)...) {
+			continue
+		}
+
+		issue := IntegrityIssue{Check: check.name, Description: check.description}
+		query := db.Table(check.table).Where(check.where)
+		if err := query.Count(&issue.Count).Error; err != nil {
+			return nil, err
+		}
+		if issue.Count > 0 {
+			if err := query.Order("id").Limit(integritySampleSize).Pluck("id", &issue.SampleIDs).Error; err != nil {
+				return nil, err
+			}
+		}
+		issues = append(issues, issue)
+	}
+	return issues, nil
+}
+
+func hasTables(db *gorm.DB, tables ...string) bool {
+	for _, table := range tables {
+		if !db.HasTable(table) {
+			return false
+		}
+	}
+	return true
+}
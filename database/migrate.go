@@ -0,0 +1,187 @@
+package database
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/jinzhu/gorm"
+)
+
+// migrateForeignKeys 为缺少外键约束的已有表补加约束。
+// SQLite 不能给已有的表添加外键，只能按模型重建表再复制数据：
+// 在同一个连接上关闭外键检查，把旧表改名，按模型建新表，复制数据后删除旧表。
+// 重建后仍有违反外键的孤立记录时放弃重建这张表，可以用 cmd/integrity-check 查看并处理后重启
+func migrateForeignKeys(values ...interface{}) {
+	// 外键检查和改名方式都是连接级别的设置，迁移期间只使用一个连接
+	sqlDB := DB.DB()
+	sqlDB.SetMaxOpenConns(1)
+	defer sqlDB.SetMaxOpenConns(0)
+	DB.Exec("PRAGMA foreign_keys = OFF")
+	defer DB.Exec("PRAGMA foreign_keys = ON")
+	// 改名时不修改其他表中指向旧表名的外键
+	DB.Exec("PRAGMA legacy_alter_table = ON")
+	defer DB.Exec("PRAGMA legacy_alter_table = OFF")
+
+	for _, value := range values {
+		scope := DB.NewScope(value)
+		table := scope.TableName()
+
+		// 可以为空的外键列用 NULL 表示没有引用，早期的记录保存为空字符串
+		for _, column := range foreignKeyColumns(scope) {
+			if !column.notNull && !column.primaryKey {
+				DB.Table(table).Where(column.name+" = ''").UpdateColumn(column.name, gorm.Expr("NULL"))
+			}
+		}
+
+		missing, err := missingForeignKeys(DB, scope)
+		if err != nil {
+			log.Printf("检查 %s 的外键失败: %v", table, err)
+			continue
+		}
+		if len(missing) == 0 {
+			continue
+		}
+		if err := rebuildTable(value, table); err != nil {
+			log.Printf("为 %s 补加外键 %s 失败: %v", table, strings.Join(missing, ", "), err)
+			continue
+		}
+		log.Printf("已为 %s 补加外键 %s", table, strings.Join(missing, ", "))
+	}
+}
+
+// foreignKeyColumn 模型中声明了外键的列
+type foreignKeyColumn struct {
+	name       string
+	notNull    bool
+	primaryKey bool
+}
+
+func foreignKeyColumns(scope *gorm.Scope) []foreignKeyColumn {
+	var columns []foreignKeyColumn
+	for _, field := range scope.GetModelStruct().StructFields {
+		sqlType, _ := field.TagSettingsGet("TYPE")
+		if !strings.Contains(strings.ToUpper(sqlType), "REFERENCES") {
+			continue
+		}
+		_, notNull := field.TagSettingsGet("NOT NULL")
+		columns = append(columns, foreignKeyColumn{name: field.DBName, notNull: notNull, primaryKey: field.IsPrimaryKey})
+	}
+	return columns
+}
+
+// missingForeignKeys 返回模型中声明了外键、但数据库中的表没有外键约束的列
+func missingForeignKeys(db *gorm.DB, scope *gorm.Scope) ([]string, error) {
+	rows, err := db.Raw(fmt.Sprintf("PRAGMA foreign_key_list(%q)", scope.TableName())).Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	existing := make(map[string]bool)
+	for rows.Next() {
+		var id, seq int
+		var table, from, to, onUpdate, onDelete, match string
+		if err := rows.Scan(&id, &seq, &table, &from, &to, &onUpdate, &onDelete, &match); err != nil {
+			return nil, err
+		}
+		existing[from] = true
+	}
+
+	var missing []string
+	for _, column := range foreignKeyColumns(scope) {
+		if !existing[column.name] {
+			missing = append(missing, column.name)
+		}
+	}
+	return missing, rows.Err()
+}
+
+// rebuildTable 在一个事务中按模型重建 table，保留两边都有的列的数据
+func rebuildTable(value interface{}, table string) error {
+	tx := DB.Begin()
+	if err := rebuild(tx, value, table); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit().Error
+}
+
+func rebuild(tx *gorm.DB, value interface{}, table string) error {
+	old := table + "_old"
+	if err := tx.Exec(fmt.Sprintf("ALTER TABLE %q RENAME TO %q", table, old)).Error; err != nil {
+		return err
+	}
+
+	// 索引名在整个数据库中唯一，建新表前删除旧表的索引
+	var indexes []string
+	if err := tx.Raw("SELECT name FROM sqlite_master WHERE type = 'index' AND tbl_name = ? AND sql IS NOT NULL", old).Pluck("name", &indexes).Error; err != nil {
+		return err
+	}
+	for _, index := range indexes {
+		if err := tx.Exec(fmt.Sprintf("DROP INDEX %q", index)).Error; err != nil {
+			return err
+		}
+	}
+
+	if err := tx.CreateTable(value).Error; err != nil {
+		return err
+	}
+
+	oldColumns, err := tableColumns(tx, old)
+	if err != nil {
+		return err
+	}
+	newColumns, err := tableColumns(tx, table)
+	if err != nil {
+		return err
+	}
+	var columns []string
+	for name := range newColumns {
+		if _, ok := oldColumns[name]; ok {
+			columns = append(columns, fmt.Sprintf("%q", name))
+		}
+	}
+	list := strings.Join(columns, ", ")
+	if err := tx.Exec(fmt.Sprintf("INSERT INTO %q (%s) SELECT %s FROM %q", table, list, list, old)).Error; err != nil {
+		return err
+	}
+	if err := tx.Exec(fmt.Sprintf("DROP TABLE %q", old)).Error; err != nil {
+		return err
+	}
+
+	rows, err := tx.Raw(fmt.Sprintf("PRAGMA foreign_key_check(%q)", table)).Rows()
+	if err != nil {
+		return err
+	}
+	violations := 0
+	for rows.Next() {
+		violations++
+	}
+	rows.Close()
+	if violations > 0 {
+		return fmt.Errorf("有 %d 条记录引用的数据不存在", violations)
+	}
+	return nil
+}
+
+// tableColumns 返回表的列名
+func tableColumns(tx *gorm.DB, table string) (map[string]bool, error) {
+	rows, err := tx.Raw(fmt.Sprintf("PRAGMA table_info(%q)", table)).Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns := make(map[string]bool)
+	for rows.Next() {
+		var cid, notNull, pk int
+		var name, dataType string
+		var defaultValue interface{}
+		if err := rows.Scan(&cid, &name, &dataType, &notNull, &defaultValue, &pk); err != nil {
+			return nil, err
+		}
+		columns[name] = true
+	}
+	return columns, rows.Err()
+}
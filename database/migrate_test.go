@@ -0,0 +1,148 @@
+package database
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+	"vote-demo/models"
+)
+
+// 添加外键之前的评论表：根评论的 parent_id 为空字符串，没有外键约束
+type legacyComment struct {
+	ID        string `gorm:"primary_key"`
+	PollID    string `gorm:"not null"`
+	UserID    string `gorm:"not null"`
+	Content   string `gorm:"not null"`
+	ParentID  string `gorm:"index"`
+	Status    string
+	CreatedAt time.Time
+}
+
+func (legacyComment) TableName() string { return "comments" }
+
+// legacyDB 创建没有外键约束的旧数据库：一个投票，根评论 root 下有回复 reply，reply 下有回复 nested
+func legacyDB(t *testing.T, comments ...legacyComment) {
+	t.Helper()
+	Path = filepath.Join(t.TempDir(), "legacy.db")
+	db, err := Open(Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.LogMode(false)
+	db.CreateTable(&models.Poll{}, &legacyComment{})
+	poll := models.Poll{Title: "午饭吃什么", Type: models.PollTypeSingle}
+	db.Create(&poll)
+	now := time.Now()
+	for _, comment := range append([]legacyComment{
+		{ID: "root", ParentID: ""},
+		{ID: "reply", ParentID: "root"},
+		{ID: "nested", ParentID: "reply"},
+	}, comments...) {
+		comment.PollID, comment.UserID, comment.Content, comment.Status, comment.CreatedAt = poll.ID, "user", comment.ID, models.CommentVisible, now
+		if err := db.Create(&comment).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	db.Close()
+
+	InitDB()
+	DB.LogMode(false)
+	t.Cleanup(CloseDB)
+}
+
+func foreignKeyTargets(t *testing.T, table string) map[string]string {
+	t.Helper()
+	rows, err := DB.Raw("PRAGMA foreign_key_list(" + table + ")").Rows()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+
+	targets := make(map[string]string)
+	for rows.Next() {
+		var id, seq int
+		var target, from, to, onUpdate, onDelete, match string
+		if err := rows.Scan(&id, &seq, &target, &from, &to, &onUpdate, &onDelete, &match); err != nil {
+			t.Fatal(err)
+		}
+		targets[from] = target + "." + to + " " + onDelete
+	}
+	return targets
+}
+
+func TestMigrateForeignKeysRebuildsLegacyTables(t *testing.T) {
+	legacyDB(t)
+
+	targets := foreignKeyTargets(t, "comments")
+	for column, want := range map[string]string{"poll_id": "polls.id CASCADE", "parent_id": "comments.id CASCADE"} {
+		if targets[column] != want {
+			t.Errorf("comments.%s references %q, want %q", column, targets[column], want)
+		}
+	}
+
+	var count int
+	DB.Model(&models.Comment{}).Count(&count)
+	if count != 3 {
+		t.Fatalf("got %d comments after the rebuild, want 3", count)
+	}
+	var root models.Comment
+	DB.First(&root, "id = ?", "root")
+	if root.Content != "root" || root.ParentID != "" {
+		t.Errorf("root = %+v, want the copied root comment", root)
+	}
+	DB.Model(&models.Comment{}).Where("parent_id IS NULL").Count(&count)
+	if count != 1 {
+		t.Errorf("got %d comments with a NULL parent_id, want 1", count)
+	}
+
+	// 索引随新表重建
+	for _, index := range []string{"idx_comments_parent_id", "idx_comment_thread", "idx_comment_thread_score"} {
+		DB.Raw("SELECT COUNT(*) FROM sqlite_master WHERE type = 'index' AND name = ?", index).Count(&count)
+		if count != 1 {
+			t.Errorf("index %s missing after the rebuild", index)
+		}
+	}
+
+	// 永久删除根评论时，所有层级的回复都被级联删除
+	if err := DB.Unscoped().Delete(&models.Comment{ID: "root"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	DB.Unscoped().Model(&models.Comment{}).Count(&count)
+	if count != 0 {
+		t.Errorf("got %d comments after deleting the root, want 0", count)
+	}
+}
+
+func TestMigrateForeignKeysKeepsTablesWithOrphans(t *testing.T) {
+	legacyDB(t, legacyComment{ID: "orphan", ParentID: "missing"})
+
+	if _, ok := foreignKeyTargets(t, "comments")["parent_id"]; ok {
+		t.Error("comments was rebuilt with a foreign key although it has an orphaned reply")
+	}
+	var count int
+	DB.Model(&models.Comment{}).Count(&count)
+	if count != 4 {
+		t.Errorf("got %d comments, want all 4 kept", count)
+	}
+	// 根评论仍然改为 NULL，与新写入的根评论一致
+	DB.Model(&models.Comment{}).Where("parent_id IS NULL").Count(&count)
+	if count != 1 {
+		t.Errorf("got %d comments with a NULL parent_id, want 1", count)
+	}
+}
+
+func TestMigrateForeignKeysNewDatabase(t *testing.T) {
+	Path = filepath.Join(t.TempDir(), "test.db")
+	InitDB()
+	DB.LogMode(false)
+	t.Cleanup(CloseDB)
+
+	poll := models.Poll{Title: "午饭吃什么", Type: models.PollTypeSingle, IsActive: true}
+	DB.Create(&poll)
+	if err := DB.Create(&models.Comment{PollID: poll.ID, UserID: "user", Content: "回复", ParentID: "missing"}).Error; err == nil {
+		t.Error("created a reply to a comment that does not exist")
+	}
+	if err := DB.Create(&models.Comment{PollID: poll.ID, UserID: "user", Content: "根评论"}).Error; err != nil {
+		t.Errorf("create root comment: %v", err)
+	}
+}
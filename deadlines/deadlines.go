@@ -0,0 +1,81 @@
+// Package deadlines 在投票到达截止时间时记录 PollClosed 事件，
+// 由 Webhook 和通知等订阅者处理，与停用投票时的处理一致
+package deadlines
+
+import (
+	"log"
+	"time"
+	"vote-demo/database"
+	"vote-demo/events"
+	"vote-demo/models"
+)
+
+const (
+	// 检查到达截止时间的投票的间隔
+	checkInterval = time.Minute
+	// 只处理最近这段时间内到达截止时间的投票，避免首次启动时为历史投票补发事件
+	closeWindow = 24 * time.Hour
+)
+
+// StartScheduler 启动检查协程，定期关闭到达截止时间的投票
+func StartScheduler() {
+	go func() {
+		ticker := time.NewTicker(checkInterval)
+		defer ticker.Stop()
+
+		for {
+			if err := CloseExpired(time.Now()); err != nil {
+				log.Printf("关闭到达截止时间的投票失败: %v", err)
+			}
+			<-ticker.C
+		}
+	}()
+}
+
+// CloseExpired 为到达截止时间、还没有记录关闭事件的投票记录 PollClosed 事件，每个投票只记录一次
+func CloseExpired(now time.Time) error {
+	var ids []string
+	if err := database.DB.Model(&models.Poll{}).
+		Where("is_active = ? AND closed_at IS NULL AND end_time > ? AND end_time <= ?", true, now.Add(-closeWindow), now).
+		Pluck("id", &ids).Error; err != nil {
+		return err
+	}
+
+	closed := false
+	for _, id := range ids {
+		ok, err := closePoll(id, now)
+		if err != nil {
+			return err
+		}
+		closed = closed || ok
+	}
+	if closed {
+		events.Notify()
+	}
+	return nil
+}
+
+// closePoll 在同一事务中写入 closed_at 和 PollClosed 事件。投票同时被停用时只有先写入 closed_at 的一方记录事件
+func closePoll(id string, now time.Time) (bool, error) {
+	tx := database.DB.Begin()
+	result := tx.Model(&models.Poll{}).Where("id = ? AND closed_at IS NULL", id).UpdateColumn("closed_at", now)
+	if result.Error != nil {
+		tx.Rollback()
+		return false, result.Error
+	}
+	if result.RowsAffected == 0 {
+		tx.Rollback()
+		return false, nil
+	}
+
+	var poll models.Poll
+	if err := tx.Preload("Options").First(&poll, "id = ?", id).Error; err != nil {
+		tx.Rollback()
+		return false, err
+	}
+	if err := events.Record(tx, events.PollClosed{Poll: poll}); err != nil {
+		tx.Rollback()
+		return false, err
+	}
+	return true, tx.Commit().Error
+}
@@ -0,0 +1,231 @@
+package email
+
+import (
+	"errors"
+	"io"
+	"mime"
+	"mime/quotedprintable"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	"vote-demo/database"
+	"vote-demo/models"
+)
+
+// setupDB 使用临时目录中的数据库
+func setupDB(t *testing.T) {
+	t.Helper()
+	database.Path = filepath.Join(t.TempDir(), "test.db")
+	database.InitDB()
+	database.DB.LogMode(false)
+	t.Cleanup(database.CloseDB)
+}
+
+// readMessage 解析 FileSender 写入的邮件，返回解码后的标题和正文
+func readMessage(t *testing.T, path string) (*mail.Message, string, string) {
+	t.Helper()
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	msg, err := mail.ReadMessage(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := io.ReadAll(quotedprintable.NewReader(msg.Body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 正文按 RFC 5322 使用 CRLF 换行
+	return msg, subject, strings.ReplaceAll(string(body), "\r\n", "\n")
+}
+
+func TestFileSender(t *testing.T) {
+	tests := []struct {
+		name string
+		msg  Message
+	}{
+		{"chinese", Message{From: "投票 <noreply@example.com>", To: "alice@example.com", Subject: "投票「午饭」即将截止", Body: "alice，你好：\n\n投票将于明天截止。\n"}},
+		{"english", Message{From: "noreply@example.com", To: "Bob <bob@example.com>", Subject: `Results for "Lunch" are available`, Body: "Hi bob,\n\n" + strings.Repeat("a long line ", 20) + "\n"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := filepath.Join(t.TempDir(), "mail")
+			if err := (FileSender{Dir: dir}).Send(tt.msg); err != nil {
+				t.Fatal(err)
+			}
+			files, _ := filepath.Glob(filepath.Join(dir, "*.eml"))
+			if len(files) != 1 {
+				t.Fatalf("got %d .eml files, want 1", len(files))
+			}
+
+			msg, subject, body := readMessage(t, files[0])
+			if subject != tt.msg.Subject {
+				t.Errorf("Subject = %q, want %q", subject, tt.msg.Subject)
+			}
+			if body != tt.msg.Body {
+				t.Errorf("body = %q, want %q", body, tt.msg.Body)
+			}
+			to, err := mail.ParseAddress(msg.Header.Get("To"))
+			if err != nil || to.Address != envelopeAddress(tt.msg.To) {
+				t.Errorf("To = %q, want address %s", msg.Header.Get("To"), envelopeAddress(tt.msg.To))
+			}
+			from, err := msg.Header.AddressList("From")
+			if err != nil || len(from) != 1 || from[0].Address != envelopeAddress(tt.msg.From) {
+				t.Errorf("From = %q, want address %s", msg.Header.Get("From"), envelopeAddress(tt.msg.From))
+			}
+			if msg.Header.Get("Content-Type") != "text/plain; charset=UTF-8" {
+				t.Errorf("Content-Type = %q", msg.Header.Get("Content-Type"))
+			}
+		})
+	}
+}
+
+func TestCompose(t *testing.T) {
+	setupDB(t)
+
+	alice := models.User{Username: "alice", Email: "alice@example.com"}
+	bob := models.User{Username: "bob"}
+	database.DB.Create(&alice)
+	database.DB.Create(&bob)
+	poll := models.Poll{Title: "午饭吃什么", Type: models.PollTypeSingle, IsActive: true}
+	database.DB.Create(&poll)
+	comment := models.Comment{PollID: poll.ID, UserID: bob.ID, Content: "去食堂吧", Status: models.CommentVisible}
+	database.DB.Create(&comment)
+
+	reply := models.Notification{UserID: alice.ID, Type: models.NotificationReply, ActorID: bob.ID, PollID: poll.ID, CommentID: comment.ID}
+	results := models.Notification{UserID: alice.ID, Type: models.NotificationResults, PollID: poll.ID}
+
+	tests := []struct {
+		name        string
+		language    string
+		items       []models.Notification
+		wantSubject string
+		wantBody    []string
+	}{
+		{"zh reply", LanguageZh, []models.Notification{reply}, "bob 回复了你在「午饭吃什么」中的评论",
+			[]string{"alice，你好", "去食堂吧", "/api/polls/" + poll.ID, footers[LanguageZh]}},
+		{"en reply", LanguageEn, []models.Notification{reply}, `bob replied to your comment on "午饭吃什么"`,
+			[]string{"Hi alice,", "去食堂吧", "/api/polls/" + poll.ID, footers[LanguageEn]}},
+		{"zh results", LanguageZh, []models.Notification{results}, "投票「午饭吃什么」已结束，结果已公布",
+			[]string{"/api/polls/" + poll.ID + "/results", footers[LanguageZh]}},
+		{"zh digest", LanguageZh, []models.Notification{reply, results}, "你有 2 条新通知",
+			[]string{"- bob 回复了你在「午饭吃什么」中的评论：去食堂吧", "- 投票「午饭吃什么」已结束：", footers[LanguageZh]}},
+		{"en digest", LanguageEn, []models.Notification{reply, results}, "You have 2 new notifications",
+			[]string{"Here is what happened recently:", `- bob replied to your comment on "午饭吃什么": 去食堂吧`, `- Poll "午饭吃什么" has ended:`, footers[LanguageEn]}},
+		{"unknown language falls back to zh", "fr", []models.Notification{results}, "投票「午饭吃什么」已结束，结果已公布", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user := alice
+			user.Language = tt.language
+			msg, err := compose(tt.items, user)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if msg.To != alice.Email {
+				t.Errorf("To = %q, want %q", msg.To, alice.Email)
+			}
+			if msg.Subject != tt.wantSubject {
+				t.Errorf("Subject = %q, want %q", msg.Subject, tt.wantSubject)
+			}
+			for _, want := range tt.wantBody {
+				if !strings.Contains(msg.Body, want) {
+					t.Errorf("body does not contain %q:\n%s", want, msg.Body)
+				}
+			}
+		})
+	}
+}
+
+func TestExcerpt(t *testing.T) {
+	long := strings.Repeat("评", maxCommentExcerpt+1)
+	tests := []struct {
+		content string
+		want    string
+	}{
+		{"short", "short"},
+		{strings.Repeat("评", maxCommentExcerpt), strings.Repeat("评", maxCommentExcerpt)},
+		{long, strings.Repeat("评", maxCommentExcerpt) + "…"},
+	}
+	for _, tt := range tests {
+		if got := excerpt(tt.content); got != tt.want {
+			t.Errorf("excerpt(%d runes) = %d runes, want %d", len([]rune(tt.content)), len([]rune(got)), len([]rune(tt.want)))
+		}
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{1, time.Minute},
+		{2, 2 * time.Minute},
+		{4, 8 * time.Minute},
+		{7, time.Hour},
+	}
+	for _, tt := range tests {
+		if got := Backoff(tt.attempts); got != tt.want {
+			t.Errorf("Backoff(%d) = %v, want %v", tt.attempts, got, tt.want)
+		}
+	}
+}
+
+// failingSender 总是发送失败
+type failingSender struct{ calls int }
+
+func (s *failingSender) Send(Message) error {
+	s.calls++
+	return errors.New("smtp unavailable")
+}
+
+func TestDeliverPendingRetry(t *testing.T) {
+	setupDB(t)
+
+	failing := &failingSender{}
+	previous := sender
+	sender = failing
+	t.Cleanup(func() { sender = previous })
+
+	user := models.User{Username: "alice", Email: "alice@example.com"}
+	database.DB.Create(&user)
+	notification := models.Notification{UserID: user.ID, Type: models.NotificationResults, PollID: "poll", EmailPending: true}
+	database.DB.Create(&notification)
+
+	now := time.Now()
+	for attempt := 1; attempt <= MaxAttempts; attempt++ {
+		// 到重试时间之前不会再次发送
+		deliverPending(now)
+		deliverPending(now)
+		if failing.calls != attempt {
+			t.Fatalf("after attempt %d: sent %d times", attempt, failing.calls)
+		}
+
+		database.DB.First(&notification, "id = ?", notification.ID)
+		if notification.EmailAttempts != attempt {
+			t.Fatalf("email_attempts = %d, want %d", notification.EmailAttempts, attempt)
+		}
+		if notification.EmailPending != (attempt < MaxAttempts) {
+			t.Fatalf("after attempt %d: email_pending = %v", attempt, notification.EmailPending)
+		}
+		if notification.EmailNextAttemptAt == nil || !notification.EmailNextAttemptAt.Equal(now.Add(Backoff(attempt))) {
+			t.Fatalf("after attempt %d: next attempt at %v, want %v", attempt, notification.EmailNextAttemptAt, now.Add(Backoff(attempt)))
+		}
+		now = *notification.EmailNextAttemptAt
+	}
+
+	deliverPending(now.Add(time.Hour))
+	if failing.calls != MaxAttempts {
+		t.Errorf("sent %d times after giving up, want %d", failing.calls, MaxAttempts)
+	}
+}
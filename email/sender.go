@@ -0,0 +1,135 @@
+// Package email 发送邮件通知。
+//
+// 发送方式通过 Sender 接口实现：SMTPSender 通过 SMTP 服务器发送，
+// FileSender 将邮件写成 .eml 文件，用于开发和测试，不需要邮件服务器
+package email
+
+import (
+	"bytes"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Message 一封纯文本邮件
+type Message struct {
+	From    string
+	To      string
+	Subject string
+	Body    string
+}
+
+// Bytes 按 RFC 5322 格式生成邮件内容，标题和正文使用 UTF-8 编码
+func (msg Message) Bytes() []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", headerAddress(msg.From))
+	fmt.Fprintf(&buf, "To: %s\r\n", headerAddress(msg.To))
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.BEncoding.Encode("UTF-8", msg.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&buf, "Message-ID: <%s@vote-demo>\r\n", uuid.New().String())
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	buf.WriteString("Content-Transfer-Encoding: quoted-printable\r\n")
+	buf.WriteString("\r\n")
+
+	writer := quotedprintable.NewWriter(&buf)
+	writer.Write([]byte(msg.Body))
+	writer.Close()
+	return buf.Bytes()
+}
+
+// headerAddress 按 RFC 5322 格式化地址，非 ASCII 的名称会被编码
+func headerAddress(address string) string {
+	if parsed, err := mail.ParseAddress(address); err == nil {
+		return parsed.String()
+	}
+	return address
+}
+
+// envelopeAddress 去掉名称，只保留 SMTP 信封中使用的地址
+func envelopeAddress(address string) string {
+	if parsed, err := mail.ParseAddress(address); err == nil {
+		return parsed.Address
+	}
+	return address
+}
+
+// Sender 发送邮件的方式
+type Sender interface {
+	Send(msg Message) error
+}
+
+// SMTPSender 通过 SMTP 服务器发送邮件，Username 为空时不进行认证
+type SMTPSender struct {
+	Addr     string // host:port
+	Username string
+	Password string
+}
+
+// Send 通过 SMTP 服务器发送邮件
+func (s SMTPSender) Send(msg Message) error {
+	var auth smtp.Auth
+	if s.Username != "" {
+		host, _, err := net.SplitHostPort(s.Addr)
+		if err != nil {
+			return err
+		}
+		auth = smtp.PlainAuth("", s.Username, s.Password, host)
+	}
+	return smtp.SendMail(s.Addr, auth, envelopeAddress(msg.From), []string{envelopeAddress(msg.To)}, msg.Bytes())
+}
+
+// FileSender 将邮件写入 Dir 目录下的 .eml 文件，文件名以发送时间开头，便于按顺序查看
+type FileSender struct {
+	Dir string
+}
+
+// Send 将邮件写入文件
+func (s FileSender) Send(msg Message) error {
+	if err := os.MkdirAll(s.Dir, 0o755); err != nil {
+		return err
+	}
+	name := time.Now().UTC().Format("20060102T150405.000000000") + "-" + uuid.New().String() + ".eml"
+	return os.WriteFile(filepath.Join(s.Dir, name), msg.Bytes(), 0o644)
+}
+
+// SenderFromEnv 根据环境变量选择发送方式：
+// 设置 MAIL_SMTP_ADDR 时通过 SMTP 发送（认证使用 MAIL_SMTP_USERNAME 和 MAIL_SMTP_PASSWORD），
+// 否则设置 MAIL_DIR 时写入 .eml 文件；都没有设置时返回 nil，不发送邮件
+func SenderFromEnv() Sender {
+	if addr := os.Getenv("MAIL_SMTP_ADDR"); addr != "" {
+		return SMTPSender{
+			Addr:     addr,
+			Username: os.Getenv("MAIL_SMTP_USERNAME"),
+			Password: os.Getenv("MAIL_SMTP_PASSWORD"),
+		}
+	}
+	if dir := os.Getenv("MAIL_DIR"); dir != "" {
+		return FileSender{Dir: dir}
+	}
+	return nil
+}
+
+// fromAddress 发件人地址，可通过环境变量 MAIL_FROM 配置
+func fromAddress() string {
+	if from := os.Getenv("MAIL_FROM"); from != "" {
+		return from
+	}
+	return "vote-demo <noreply@localhost>"
+}
+
+// baseURL 邮件中链接的地址前缀，可通过环境变量 APP_BASE_URL 配置
+func baseURL() string {
+	if url := os.Getenv("APP_BASE_URL"); url != "" {
+		return url
+	}
+	return "http://localhost:8080"
+}
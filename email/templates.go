@@ -0,0 +1,159 @@
+package email
+
+import (
+	"strings"
+	"text/template"
+	"vote-demo/models"
+)
+
+// 邮件使用的语言
+const (
+	LanguageZh = "zh" // 默认
+	LanguageEn = "en"
+)
+
+// ValidLanguage 检查邮件语言是否有效
+func ValidLanguage(language string) bool {
+	return language == LanguageZh || language == LanguageEn
+}
+
+// languageOf 用户的邮件语言，未设置时使用中文
+func languageOf(user models.User) string {
+	if user.Language == LanguageEn {
+		return LanguageEn
+	}
+	return LanguageZh
+}
+
+// itemData 单条通知邮件的模板数据
+type itemData struct {
+	Username   string // 收件人的用户名
+	Actor      string // 触发通知的用户名
+	PollTitle  string
+	PollURL    string
+	ResultsURL string
+	Comment    string // 评论内容摘录
+	EndTime    string
+}
+
+// digestData 摘要邮件的模板数据，Items 为按单条通知的 line 模板生成的文本
+type digestData struct {
+	Username string
+	Items    []string
+}
+
+// templateSet 一类通知的邮件模板：单独发送时使用 subject 和 body，合并到摘要时使用 line
+type templateSet struct {
+	subject *template.Template
+	body    *template.Template
+	line    *template.Template
+}
+
+func newTemplateSet(subject, body, line string) templateSet {
+	return templateSet{
+		subject: template.Must(template.New("subject").Parse(subject)),
+		body:    template.Must(template.New("body").Parse(body)),
+		line:    template.Must(template.New("line").Parse(line)),
+	}
+}
+
+// 摘要邮件在模板中使用的类型名
+const digestKind = "digest"
+
+// templates 各语言、各类通知的邮件模板
+var templates = map[string]map[string]templateSet{
+	LanguageZh: {
+		models.NotificationReply: newTemplateSet(
+			`{{.Actor}} 回复了你在「{{.PollTitle}}」中的评论`,
+			`{{.Username}}，你好：
+
+{{.Actor}} 回复了你在投票「{{.PollTitle}}」中的评论：
+
+{{.Comment}}
+
+查看讨论：{{.PollURL}}
+`,
+			`{{.Actor}} 回复了你在「{{.PollTitle}}」中的评论：{{.Comment}}`),
+		models.NotificationClosingSoon: newTemplateSet(
+			`投票「{{.PollTitle}}」即将截止`,
+			`{{.Username}}，你好：
+
+你参与讨论的投票「{{.PollTitle}}」将于 {{.EndTime}} 截止，你还没有投票。
+
+立即投票：{{.PollURL}}
+`,
+			`投票「{{.PollTitle}}」将于 {{.EndTime}} 截止：{{.PollURL}}`),
+		models.NotificationResults: newTemplateSet(
+			`投票「{{.PollTitle}}」已结束，结果已公布`,
+			`{{.Username}}，你好：
+
+你参与的投票「{{.PollTitle}}」已经结束。
+
+查看结果：{{.ResultsURL}}
+`,
+			`投票「{{.PollTitle}}」已结束：{{.ResultsURL}}`),
+		digestKind: newTemplateSet(
+			`你有 {{len .Items}} 条新通知`,
+			`{{.Username}}，你好：
+
+以下是你最近的通知：
+{{range .Items}}
+- {{.}}{{end}}
+`,
+			``),
+	},
+	LanguageEn: {
+		models.NotificationReply: newTemplateSet(
+			`{{.Actor}} replied to your comment on "{{.PollTitle}}"`,
+			`Hi {{.Username}},
+
+{{.Actor}} replied to your comment on the poll "{{.PollTitle}}":
+
+{{.Comment}}
+
+View the discussion: {{.PollURL}}
+`,
+			`{{.Actor}} replied to your comment on "{{.PollTitle}}": {{.Comment}}`),
+		models.NotificationClosingSoon: newTemplateSet(
+			`Poll "{{.PollTitle}}" is closing soon`,
+			`Hi {{.Username}},
+
+The poll "{{.PollTitle}}" you took part in closes at {{.EndTime}}, and you haven't voted yet.
+
+Vote now: {{.PollURL}}
+`,
+			`Poll "{{.PollTitle}}" closes at {{.EndTime}}: {{.PollURL}}`),
+		models.NotificationResults: newTemplateSet(
+			`Results for "{{.PollTitle}}" are available`,
+			`Hi {{.Username}},
+
+The poll "{{.PollTitle}}" you took part in has ended.
+
+See the results: {{.ResultsURL}}
+`,
+			`Poll "{{.PollTitle}}" has ended: {{.ResultsURL}}`),
+		digestKind: newTemplateSet(
+			`You have {{len .Items}} new notifications`,
+			`Hi {{.Username}},
+
+Here is what happened recently:
+{{range .Items}}
+- {{.}}{{end}}
+`,
+			``),
+	},
+}
+
+// footers 邮件末尾的说明
+var footers = map[string]string{
+	LanguageZh: "\n——\n可以通过 /api/notifications/email 修改或关闭邮件通知。\n",
+	LanguageEn: "\n--\nYou can change or turn off email notifications via /api/notifications/email.\n",
+}
+
+func execute(t *template.Template, data interface{}) (string, error) {
+	var buf strings.Builder
+	if err := t.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
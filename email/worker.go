@@ -0,0 +1,230 @@
+package email
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"time"
+	"unicode/utf8"
+	"vote-demo/database"
+	"vote-demo/models"
+)
+
+const (
+	// MaxAttempts 每条通知邮件的最大发送次数，用尽后放弃发送
+	MaxAttempts = 5
+	// 检查待发送邮件的间隔
+	pollInterval = 30 * time.Second
+	// 发送失败后第一次重试的等待时间，之后每次翻倍
+	retryBaseDelay = time.Minute
+	// 重试等待时间的上限
+	retryMaxDelay = time.Hour
+	// 默认的摘要邮件发送间隔，可通过环境变量 MAIL_DIGEST_HOURS 配置
+	defaultDigestInterval = 24 * time.Hour
+	// 邮件中评论内容摘录的最大字符数
+	maxCommentExcerpt = 200
+)
+
+var (
+	sender Sender
+	wakeup = make(chan struct{}, 1)
+)
+
+// Enabled 是否配置了邮件发送方式，未配置时不生成待发送的邮件
+func Enabled() bool {
+	return sender != nil
+}
+
+// Notify 唤醒发送协程，立即发送新的通知邮件
+func Notify() {
+	select {
+	case wakeup <- struct{}{}:
+	default:
+	}
+}
+
+// StartWorker 启动邮件发送协程。待发送的邮件记录在通知中，服务重启后会继续发送
+func StartWorker(s Sender) {
+	sender = s
+	go func() {
+		ticker := time.NewTicker(pollInterval)
+		defer ticker.Stop()
+
+		for {
+			deliverPending(time.Now())
+
+			select {
+			case <-wakeup:
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// digestInterval 摘要邮件的发送间隔
+func digestInterval() time.Duration {
+	if hours, err := strconv.Atoi(os.Getenv("MAIL_DIGEST_HOURS")); err == nil && hours > 0 {
+		return time.Duration(hours) * time.Hour
+	}
+	return defaultDigestInterval
+}
+
+// deliverPending 按用户发送所有到了发送时间的通知邮件，选择摘要模式的用户到时间后合并为一封发送
+func deliverPending(now time.Time) {
+	var pending []models.Notification
+	database.DB.Where("email_pending = ? AND (email_next_attempt_at IS NULL OR email_next_attempt_at <= ?)", true, now).Order("created_at ASC").Find(&pending)
+
+	byUser := make(map[string][]models.Notification)
+	var userIDs []string
+	for _, notification := range pending {
+		if _, ok := byUser[notification.UserID]; !ok {
+			userIDs = append(userIDs, notification.UserID)
+		}
+		byUser[notification.UserID] = append(byUser[notification.UserID], notification)
+	}
+
+	for _, userID := range userIDs {
+		items := byUser[userID]
+		var user models.User
+		if err := database.DB.First(&user, "id = ?", userID).Error; err != nil || user.Email == "" {
+			// 用户已删除或清除了邮件地址
+			finish(items, nil)
+			continue
+		}
+
+		if !user.EmailDigest {
+			for _, item := range items {
+				deliver([]models.Notification{item}, user, now)
+			}
+			continue
+		}
+		if user.LastDigestAt != nil && now.Sub(*user.LastDigestAt) < digestInterval() {
+			continue
+		}
+		if deliver(items, user, now) {
+			database.DB.Model(&user).UpdateColumn("last_digest_at", now)
+		}
+	}
+}
+
+// deliver 发送一条通知邮件，多条时合并为摘要。返回是否发送成功
+func deliver(items []models.Notification, user models.User, now time.Time) bool {
+	msg, err := compose(items, user)
+	if err == nil {
+		err = sender.Send(msg)
+	}
+	if err != nil {
+		log.Printf("发送通知邮件给用户 %s 失败: %v", user.ID, err)
+		for _, item := range items {
+			attempts := item.EmailAttempts + 1
+			database.DB.Model(&item).UpdateColumns(map[string]interface{}{
+				"email_attempts":        attempts,
+				"email_pending":         attempts < MaxAttempts,
+				"email_next_attempt_at": now.Add(Backoff(attempts)),
+			})
+		}
+		return false
+	}
+	finish(items, &now)
+	return true
+}
+
+// Backoff 返回第 attempts 次失败后的重试等待时间：1 分钟、2 分钟、4 分钟……最长 1 小时
+func Backoff(attempts int) time.Duration {
+	delay := retryBaseDelay
+	for i := 1; i < attempts; i++ {
+		delay *= 2
+		if delay >= retryMaxDelay {
+			return retryMaxDelay
+		}
+	}
+	return delay
+}
+
+// finish 清除通知的待发送标记，emailedAt 为空表示没有发送
+func finish(items []models.Notification, emailedAt *time.Time) {
+	for _, item := range items {
+		database.DB.Model(&item).UpdateColumns(map[string]interface{}{
+			"email_pending": false,
+			"emailed_at":    emailedAt,
+		})
+	}
+}
+
+// compose 按用户的语言生成邮件，多条通知时生成摘要
+func compose(items []models.Notification, user models.User) (Message, error) {
+	language := languageOf(user)
+	msg := Message{From: fromAddress(), To: user.Email}
+
+	var subject, body string
+	var err error
+	if len(items) == 1 {
+		set := templates[language][items[0].Type]
+		data := itemDataFor(items[0], user)
+		if subject, err = execute(set.subject, data); err != nil {
+			return msg, err
+		}
+		if body, err = execute(set.body, data); err != nil {
+			return msg, err
+		}
+	} else {
+		data := digestData{Username: user.Username}
+		for _, item := range items {
+			line, err := execute(templates[language][item.Type].line, itemDataFor(item, user))
+			if err != nil {
+				return msg, err
+			}
+			data.Items = append(data.Items, line)
+		}
+		set := templates[language][digestKind]
+		if subject, err = execute(set.subject, data); err != nil {
+			return msg, err
+		}
+		if body, err = execute(set.body, data); err != nil {
+			return msg, err
+		}
+	}
+
+	msg.Subject = subject
+	msg.Body = body + footers[language]
+	return msg, nil
+}
+
+// itemDataFor 查询通知相关的投票、评论和用户，生成模板数据。相关记录已删除时对应字段为空
+func itemDataFor(notification models.Notification, user models.User) itemData {
+	data := itemData{
+		Username:   user.Username,
+		PollURL:    baseURL() + "/api/polls/" + notification.PollID,
+		ResultsURL: baseURL() + "/api/polls/" + notification.PollID + "/results",
+	}
+
+	var poll models.Poll
+	if notification.PollID != "" && database.DB.Select("id, title, end_time").First(&poll, "id = ?", notification.PollID).Error == nil {
+		data.PollTitle = poll.Title
+		if !poll.EndTime.IsZero() {
+			data.EndTime = poll.EndTime.Format("2006-01-02 15:04 MST")
+		}
+	}
+	if notification.ActorID != "" {
+		var actor models.User
+		if database.DB.Select("id, username").First(&actor, "id = ?", notification.ActorID).Error == nil {
+			data.Actor = actor.Username
+		}
+	}
+	if notification.CommentID != "" {
+		var comment models.Comment
+		if database.DB.Select("id, content").First(&comment, "id = ?", notification.CommentID).Error == nil {
+			data.Comment = excerpt(comment.Content)
+		}
+	}
+	return data
+}
+
+// excerpt 截取评论内容的开头
+func excerpt(content string) string {
+	if utf8.RuneCountInString(content) <= maxCommentExcerpt {
+		return content
+	}
+	runes := []rune(content)
+	return string(runes[:maxCommentExcerpt]) + "…"
+}
@@ -0,0 +1,149 @@
+package events
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// 订阅者处理失败后第一次重试的等待时间，之后每次翻倍
+	retryBaseDelay = 100 * time.Millisecond
+	// 重试等待时间的上限
+	retryMaxDelay = 30 * time.Second
+	// MaxAttempts 每个订阅者处理同一事件的最大尝试次数，用尽后放弃该订阅者，
+	// 事件标记为失败，继续投递同一投票后续的事件
+	MaxAttempts = 8
+)
+
+// Handler 事件订阅者，返回错误时会重试同一事件，最多尝试 MaxAttempts 次
+type Handler func(Event) error
+
+type subscriber struct {
+	name    string
+	handler Handler
+}
+
+// queuedEvent 等待投递的事件及其在发件箱中的ID
+type queuedEvent struct {
+	outboxID uint
+	event    Event
+}
+
+// pollQueue 同一投票待投递的事件，由一个协程按顺序投递
+type pollQueue struct {
+	events  []queuedEvent
+	running bool
+}
+
+var (
+	mu          sync.Mutex
+	subscribers []subscriber
+	queues      = make(map[string]*pollQueue)
+	idle        = sync.NewCond(&mu)
+)
+
+// Subscribe 注册订阅者，应在服务启动时、启动投递协程之前调用
+func Subscribe(name string, handler Handler) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	subscribers = append(subscribers, subscriber{name: name, handler: handler})
+}
+
+// dispatch 将发件箱中的事件放入所属投票的队列。
+// 同一投票的事件按放入顺序投递；每个订阅者至少收到一次，处理失败会按指数退避重试，最多尝试 MaxAttempts 次
+func dispatch(items ...queuedEvent) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	for _, item := range items {
+		key := item.event.Key()
+		queue, exists := queues[key]
+		if !exists {
+			queue = &pollQueue{}
+			queues[key] = queue
+		}
+		queue.events = append(queue.events, item)
+
+		if !queue.running {
+			queue.running = true
+			go drain(key)
+		}
+	}
+}
+
+// Wait 等待所有已放入队列的事件投递完成
+func Wait() {
+	mu.Lock()
+	defer mu.Unlock()
+
+	for len(queues) > 0 {
+		idle.Wait()
+	}
+}
+
+// drain 按顺序投递某个投票的事件，所有订阅者处理完成后将事件标记为已完成，
+// 有订阅者放弃处理时标记为失败。队列为空时退出
+func drain(key string) {
+	for {
+		mu.Lock()
+		queue := queues[key]
+		if len(queue.events) == 0 {
+			delete(queues, key)
+			idle.Broadcast()
+			mu.Unlock()
+			return
+		}
+		item := queue.events[0]
+		queue.events = queue.events[1:]
+		handlers := append([]subscriber(nil), subscribers...)
+		mu.Unlock()
+
+		var failures []string
+		for _, sub := range handlers {
+			if err := deliver(sub, item.event); err != nil {
+				failures = append(failures, fmt.Sprintf("%s: %v", sub.name, err))
+			}
+		}
+		if len(failures) > 0 {
+			markFailed(item.outboxID, strings.Join(failures, "; "))
+		} else {
+			markDone(item.outboxID)
+		}
+	}
+}
+
+// deliver 将事件投递给一个订阅者，失败时重试，尝试 MaxAttempts 次仍失败时返回最后一次的错误
+func deliver(sub subscriber, event Event) error {
+	delay := retryBaseDelay
+	for attempt := 1; ; attempt++ {
+		err := call(sub.handler, event)
+		if err == nil {
+			return nil
+		}
+
+		log.Printf("事件订阅者 %s 处理 %s 失败（第 %d 次）: %v", sub.name, event.Name(), attempt, err)
+		if attempt >= MaxAttempts {
+			log.Printf("事件订阅者 %s 放弃处理 %s", sub.name, event.Name())
+			return err
+		}
+		time.Sleep(delay)
+		delay *= 2
+		if delay > retryMaxDelay {
+			delay = retryMaxDelay
+		}
+	}
+}
+
+// call 调用订阅者，将 panic 转换为错误
+func call(handler Handler, event Event) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return handler(event)
+}
@@ -0,0 +1,151 @@
+package events
+
+import "vote-demo/models"
+
+// 事件名称
+const (
+	NamePollCreated      = "poll.created"
+	NamePollUpdated      = "poll.updated"
+	NamePollClosed       = "poll.closed"
+	NamePollDeleted      = "poll.deleted"
+	NamePollRestored     = "poll.restored"
+	NameVoteCast         = "vote.cast"
+	NameOptionAdded      = "option.added"
+	NameOptionUpdated    = "option.updated"
+	NameOptionDeleted    = "option.deleted"
+	NameOptionRestored   = "option.restored"
+	NameCommentAdded     = "comment.added"
+	NameCommentUpdated   = "comment.updated"
+	NameCommentDeleted   = "comment.deleted"
+	NameCommentRestored  = "comment.restored"
+	NameCommentReacted   = "comment.reacted"
+	NameCommentModerated = "comment.moderated"
+)
+
+// Event 领域事件。同一投票（Key 相同）的事件按发布顺序投递给订阅者
+type Event interface {
+	Name() string
+	Key() string
+}
+
+// PollCreated 投票已创建
+type PollCreated struct {
+	Poll models.Poll
+}
+
+// PollUpdated 投票信息或状态已更新
+type PollUpdated struct {
+	Before models.Poll
+	Poll   models.Poll
+}
+
+// PollClosed 投票已关闭（停用或结算）
+type PollClosed struct {
+	Poll models.Poll
+}
+
+// PollDeleted 投票已删除（移入回收站）
+type PollDeleted struct {
+	Poll models.Poll
+}
+
+// PollRestored 投票已从回收站恢复
+type PollRestored struct {
+	Poll models.Poll
+}
+
+// VoteCast 用户已投票，Votes 为该用户本次写入的投票记录
+type VoteCast struct {
+	PollID string
+	UserID string
+	Votes  []models.Vote
+}
+
+// OptionAdded 选项已添加
+type OptionAdded struct {
+	Option models.Option
+}
+
+// OptionUpdated 选项已更新
+type OptionUpdated struct {
+	Before models.Option
+	Option models.Option
+}
+
+// OptionDeleted 选项已删除（移入回收站）
+type OptionDeleted struct {
+	Option models.Option
+}
+
+// OptionRestored 选项已从回收站恢复
+type OptionRestored struct {
+	Option models.Option
+}
+
+// CommentAdded 评论已添加
+type CommentAdded struct {
+	Comment models.Comment
+}
+
+// CommentUpdated 评论已更新
+type CommentUpdated struct {
+	Before  models.Comment
+	Comment models.Comment
+}
+
+// CommentDeleted 评论已删除（移入回收站）
+type CommentDeleted struct {
+	Comment models.Comment
+}
+
+// CommentRestored 评论已从回收站恢复
+type CommentRestored struct {
+	Comment models.Comment
+}
+
+// CommentModerated 评论的审核状态已变化（审核通过、自动隐藏、移除或恢复）
+type CommentModerated struct {
+	Before  models.Comment
+	Comment models.Comment
+}
+
+// CommentReacted 评论的反应已变化，Reactions 为变化后各类反应的数量
+type CommentReacted struct {
+	PollID    string
+	CommentID string
+	Reactions map[string]int
+}
+
+func (e PollCreated) Name() string      { return NamePollCreated }
+func (e PollUpdated) Name() string      { return NamePollUpdated }
+func (e PollClosed) Name() string       { return NamePollClosed }
+func (e PollDeleted) Name() string      { return NamePollDeleted }
+func (e PollRestored) Name() string     { return NamePollRestored }
+func (e VoteCast) Name() string         { return NameVoteCast }
+func (e OptionAdded) Name() string      { return NameOptionAdded }
+func (e OptionUpdated) Name() string    { return NameOptionUpdated }
+func (e OptionDeleted) Name() string    { return NameOptionDeleted }
+func (e OptionRestored) Name() string   { return NameOptionRestored }
+func (e CommentAdded) Name() string     { return NameCommentAdded }
+func (e CommentUpdated) Name() string   { return NameCommentUpdated }
+func (e CommentDeleted) Name() string   { return NameCommentDeleted }
+func (e CommentRestored) Name() string  { return NameCommentRestored }
+func (e CommentReacted) Name() string   { return NameCommentReacted }
+func (e CommentModerated) Name() string { return NameCommentModerated }
+
+func (e PollCreated) Key() string      { return e.Poll.ID }
+func (e PollUpdated) Key() string      { return e.Poll.ID }
+func (e PollClosed) Key() string       { return e.Poll.ID }
+func (e PollDeleted) Key() string      { return e.Poll.ID }
+func (e PollRestored) Key() string     { return e.Poll.ID }
+func (e VoteCast) Key() string         { return e.PollID }
+func (e OptionAdded) Key() string      { return e.Option.PollID }
+func (e OptionUpdated) Key() string    { return e.Option.PollID }
+func (e OptionDeleted) Key() string    { return e.Option.PollID }
+func (e OptionRestored) Key() string   { return e.Option.PollID }
+func (e CommentAdded) Key() string     { return e.Comment.PollID }
+func (e CommentUpdated) Key() string   { return e.Comment.PollID }
+func (e CommentDeleted) Key() string   { return e.Comment.PollID }
+func (e CommentRestored) Key() string  { return e.Comment.PollID }
+func (e CommentReacted) Key() string   { return e.PollID }
+func (e CommentModerated) Key() string { return e.Comment.PollID }
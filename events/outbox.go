@@ -0,0 +1,192 @@
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+	"vote-demo/database"
+	"vote-demo/models"
+
+	"github.com/jinzhu/gorm"
+)
+
+// 没有新事件时检查发件箱的间隔
+const relayInterval = time.Second
+
+var (
+	wakeup = make(chan struct{}, 1)
+	// 已放入投递队列的最大发件箱ID，只由投递协程访问
+	lastDispatched uint
+)
+
+// Record 在事务中将事件写入发件箱，事件与业务数据一起提交或回滚。
+// 事务提交后应调用 Notify，让投递协程立即投递
+func Record(tx *gorm.DB, events ...Event) error {
+	for _, event := range events {
+		payload, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+
+		row := models.OutboxEvent{
+			Name:      event.Name(),
+			PollID:    event.Key(),
+			Payload:   string(payload),
+			Status:    models.OutboxStatusPending,
+			CreatedAt: time.Now(),
+		}
+		if err := tx.Create(&row).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Notify 唤醒投递协程。即使没有调用，投递协程也会定期检查发件箱
+func Notify() {
+	select {
+	case wakeup <- struct{}{}:
+	default:
+	}
+}
+
+// StartRelay 启动发件箱投递协程，应在注册所有订阅者之后调用。
+// 启动时会重新投递上次运行中未完成的事件
+func StartRelay() {
+	go func() {
+		ticker := time.NewTicker(relayInterval)
+		defer ticker.Stop()
+
+		for {
+			relayPending()
+
+			select {
+			case <-wakeup:
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// relayPending 将尚未放入投递队列的待处理事件按提交顺序放入队列
+func relayPending() {
+	var rows []models.OutboxEvent
+	database.DB.Where("status = ? AND id > ?", models.OutboxStatusPending, lastDispatched).
+		Order("id ASC").
+		Find(&rows)
+
+	items := make([]queuedEvent, 0, len(rows))
+	for _, row := range rows {
+		lastDispatched = row.ID
+
+		event, err := decode(row.Name, []byte(row.Payload))
+		if err != nil {
+			log.Printf("无法解析发件箱事件 %d（%s）: %v", row.ID, row.Name, err)
+			markFailed(row.ID, err.Error())
+			continue
+		}
+		items = append(items, queuedEvent{outboxID: row.ID, event: event})
+	}
+	dispatch(items...)
+}
+
+// markDone 将发件箱事件标记为已完成。标记失败时事件会在下次启动时重新投递
+func markDone(outboxID uint) {
+	now := time.Now()
+	err := database.DB.Model(&models.OutboxEvent{}).
+		Where("id = ?", outboxID).
+		Updates(map[string]interface{}{
+			"status":       models.OutboxStatusDone,
+			"processed_at": now,
+		}).Error
+	if err != nil {
+		log.Printf("标记发件箱事件 %d 完成失败: %v", outboxID, err)
+	}
+}
+
+// markFailed 将发件箱事件标记为失败，保留事件内容和错误以便排查，不再自动投递
+func markFailed(outboxID uint, reason string) {
+	now := time.Now()
+	err := database.DB.Model(&models.OutboxEvent{}).
+		Where("id = ?", outboxID).
+		Updates(map[string]interface{}{
+			"status":       models.OutboxStatusFailed,
+			"error":        reason,
+			"processed_at": now,
+		}).Error
+	if err != nil {
+		log.Printf("标记发件箱事件 %d 失败: %v", outboxID, err)
+	}
+}
+
+// decode 根据事件名称还原事件
+func decode(name string, payload []byte) (Event, error) {
+	switch name {
+	case NamePollCreated:
+		var e PollCreated
+		err := json.Unmarshal(payload, &e)
+		return e, err
+	case NamePollUpdated:
+		var e PollUpdated
+		err := json.Unmarshal(payload, &e)
+		return e, err
+	case NamePollClosed:
+		var e PollClosed
+		err := json.Unmarshal(payload, &e)
+		return e, err
+	case NamePollDeleted:
+		var e PollDeleted
+		err := json.Unmarshal(payload, &e)
+		return e, err
+	case NamePollRestored:
+		var e PollRestored
+		err := json.Unmarshal(payload, &e)
+		return e, err
+	case NameVoteCast:
+		var e VoteCast
+		err := json.Unmarshal(payload, &e)
+		return e, err
+	case NameOptionAdded:
+		var e OptionAdded
+		err := json.Unmarshal(payload, &e)
+		return e, err
+	case NameOptionUpdated:
+		var e OptionUpdated
+		err := json.Unmarshal(payload, &e)
+		return e, err
+	case NameOptionDeleted:
+		var e OptionDeleted
+		err := json.Unmarshal(payload, &e)
+		return e, err
+	case NameOptionRestored:
+		var e OptionRestored
+		err := json.Unmarshal(payload, &e)
+		return e, err
+	case NameCommentAdded:
+		var e CommentAdded
+		err := json.Unmarshal(payload, &e)
+		return e, err
+	case NameCommentUpdated:
+		var e CommentUpdated
+		err := json.Unmarshal(payload, &e)
+		return e, err
+	case NameCommentDeleted:
+		var e CommentDeleted
+		err := json.Unmarshal(payload, &e)
+		return e, err
+	case NameCommentRestored:
+		var e CommentRestored
+		err := json.Unmarshal(payload, &e)
+		return e, err
+	case NameCommentModerated:
+		var e CommentModerated
+		err := json.Unmarshal(payload, &e)
+		return e, err
+	case NameCommentReacted:
+		var e CommentReacted
+		err := json.Unmarshal(payload, &e)
+		return e, err
+	}
+	return nil, fmt.Errorf("未知的事件: %s", name)
+}
@@ -0,0 +1,217 @@
+package filter
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"vote-demo/database"
+	"vote-demo/models"
+)
+
+// 定期从数据库重新加载规则的间隔，其他进程或直接修改数据库的变更也能生效
+const reloadInterval = 30 * time.Second
+
+// 处理方式的优先级，多条规则命中时采用最严格的
+var actionPriority = map[string]int{
+	models.FilterActionMask:     1,
+	models.FilterActionModerate: 2,
+	models.FilterActionReject:   3,
+}
+
+// Result 内容过滤的结果
+type Result struct {
+	Action  string `json:"action,omitempty"` // 命中规则中最严格的处理方式，未命中时为空
+	Text    string `json:"text"`             // 屏蔽命中内容后的文本
+	RuleIDs []uint `json:"rule_ids,omitempty"`
+}
+
+type rule struct {
+	models.FilterRule
+	word   []rune         // 屏蔽词规则：规范化后的屏蔽词
+	regexp *regexp.Regexp // 正则规则
+}
+
+var (
+	mu    sync.RWMutex
+	rules []rule
+)
+
+// Compile 检查规则的内容是否有效
+func Compile(r models.FilterRule) error {
+	_, err := compile(r)
+	return err
+}
+
+func compile(r models.FilterRule) (rule, error) {
+	compiled := rule{FilterRule: r}
+	if r.IsRegex {
+		if _, err := regexp.Compile(r.Pattern); err != nil {
+			return compiled, fmt.Errorf("无效的正则表达式: %v", err)
+		}
+		// 与屏蔽词一样不区分大小写
+		compiled.regexp = regexp.MustCompile("(?i)" + r.Pattern)
+		return compiled, nil
+	}
+	compiled.word = normalize(strings.TrimSpace(r.Pattern))
+	if len(compiled.word) == 0 {
+		return compiled, fmt.Errorf("屏蔽词不能为空")
+	}
+	return compiled, nil
+}
+
+// Reload 从数据库加载启用的规则，替换当前使用的规则
+func Reload() error {
+	var rows []models.FilterRule
+	if err := database.DB.Where("enabled = ?", true).Order("id ASC").Find(&rows).Error; err != nil {
+		return err
+	}
+
+	loaded := make([]rule, 0, len(rows))
+	for _, row := range rows {
+		compiled, err := compile(row)
+		if err != nil {
+			log.Printf("跳过无效的过滤规则 %d: %v", row.ID, err)
+			continue
+		}
+		loaded = append(loaded, compiled)
+	}
+
+	mu.Lock()
+	rules = loaded
+	mu.Unlock()
+	return nil
+}
+
+// StartReloader 加载规则，并定期重新加载
+func StartReloader() {
+	if err := Reload(); err != nil {
+		log.Printf("加载过滤规则失败: %v", err)
+	}
+	go func() {
+		ticker := time.NewTicker(reloadInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if err := Reload(); err != nil {
+				log.Printf("加载过滤规则失败: %v", err)
+			}
+		}
+	}()
+}
+
+// Check 使用当前启用的规则检查文本
+func Check(text string) Result {
+	mu.RLock()
+	current := rules
+	mu.RUnlock()
+	return check(current, text)
+}
+
+// Test 使用一条规则检查文本，用于管理接口中试用规则
+func Test(r models.FilterRule, text string) (Result, error) {
+	compiled, err := compile(r)
+	if err != nil {
+		return Result{Text: text}, err
+	}
+	return check([]rule{compiled}, text), nil
+}
+
+// check 按字符（rune）匹配，不依赖空格分词，中文等不使用空格的文字也能正确匹配；
+// 屏蔽时按字符替换，不会截断多字节字符
+func check(rules []rule, text string) Result {
+	result := Result{Text: text}
+	if text == "" || len(rules) == 0 {
+		return result
+	}
+
+	original := []rune(text)
+	normalized := normalize(text)
+	masked := make([]bool, len(original))
+	maskedAny := false
+
+	for _, r := range rules {
+		spans := r.find(normalized)
+		if len(spans) == 0 {
+			continue
+		}
+		result.RuleIDs = append(result.RuleIDs, r.ID)
+		if actionPriority[r.Action] > actionPriority[result.Action] {
+			result.Action = r.Action
+		}
+		if r.Action == models.FilterActionMask {
+			for _, span := range spans {
+				for i := span[0]; i < span[1]; i++ {
+					masked[i] = true
+					maskedAny = true
+				}
+			}
+		}
+	}
+
+	if maskedAny {
+		for i := range original {
+			if masked[i] {
+				original[i] = '*'
+			}
+		}
+		result.Text = string(original)
+	}
+	return result
+}
+
+// find 返回规则在规范化文本中命中的字符区间 [start, end)
+func (r rule) find(text []rune) [][2]int {
+	var spans [][2]int
+	if r.regexp != nil {
+		value := string(text)
+		// 正则匹配返回字节位置，转换为字符位置
+		runeIndex := make(map[int]int, len(text)+1)
+		offset := 0
+		for i, ch := range text {
+			runeIndex[offset] = i
+			offset += len(string(ch))
+		}
+		runeIndex[offset] = len(text)
+		for _, loc := range r.regexp.FindAllStringIndex(value, -1) {
+			if loc[1] > loc[0] {
+				spans = append(spans, [2]int{runeIndex[loc[0]], runeIndex[loc[1]]})
+			}
+		}
+		return spans
+	}
+
+	for i := 0; i+len(r.word) <= len(text); i++ {
+		if runesEqual(text[i:i+len(r.word)], r.word) {
+			spans = append(spans, [2]int{i, i + len(r.word)})
+		}
+	}
+	return spans
+}
+
+func runesEqual(a, b []rune) bool {
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// normalize 逐字符规范化文本：全角字母、数字和符号转为半角，字母转为小写。
+// 每个字符只对应一个字符，规范化后的位置与原文一致
+func normalize(text string) []rune {
+	runes := []rune(text)
+	for i, ch := range runes {
+		switch {
+		case ch == '　':
+			ch = ' '
+		case ch >= '！' && ch <= '～':
+			ch -= 0xFEE0
+		}
+		runes[i] = unicode.ToLower(ch)
+	}
+	return runes
+}
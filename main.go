@@ -2,8 +2,17 @@ package main
 
 import (
 	"log"
+	"os"
+	"vote-demo/controllers"
 	"vote-demo/database"
+	"vote-demo/deadlines"
+	"vote-demo/email"
+	"vote-demo/events"
+	"vote-demo/filter"
+	"vote-demo/notifications"
 	"vote-demo/routes"
+	"vote-demo/trash"
+	"vote-demo/webhooks"
 )
 
 func main() {
@@ -11,10 +20,43 @@ func main() {
 	database.InitDB()
 	defer database.CloseDB()
 
+	// 指定初始管理员，公开的创建用户接口只能创建普通用户
+	if username := os.Getenv("ADMIN_USERNAME"); username != "" {
+		admin, err := database.EnsureAdmin(username)
+		if err != nil {
+			log.Fatalf("设置管理员失败: %v", err)
+		}
+		log.Printf("管理员 %s 的用户ID: %s", admin.Username, admin.ID)
+	}
+
+	// 配置了邮件发送方式时启动邮件通知发送，需要在生成通知之前启动
+	if sender := email.SenderFromEnv(); sender != nil {
+		email.StartWorker(sender)
+	}
+
+	// 注册领域事件订阅者，然后启动发件箱投递（会重新投递上次未完成的事件）
+	controllers.SubscribeEvents()
+	webhooks.SubscribeEvents()
+	notifications.SubscribeEvents()
+	events.StartRelay()
+
+	// 加载内容过滤规则，并定期重新加载
+	filter.StartReloader()
+
+	// 定期关闭到达截止时间的投票，并发送投票即将截止的通知
+	deadlines.StartScheduler()
+	notifications.StartScheduler()
+
+	// 启动 Webhook 投送
+	webhooks.StartWorker()
+
+	// 定期永久删除回收站中超过保留时间的内容
+	trash.StartPurger(trash.Retention())
+
 	// 设置路由
 	r := routes.SetupRouter()
 
 	// 启动服务器
 	log.Println("服务器启动在 http://localhost:8080")
 	r.Run(":8080")
-} 
\ No newline at end of file
+}
@@ -0,0 +1,338 @@
+// Package markdown 将评论中的 Markdown 渲染为安全的 HTML。
+//
+// 只支持评论常用的语法：段落和换行、标题、引用、列表、分隔线、代码块，
+// 以及粗体、斜体、删除线、行内代码、链接、自动链接和 @用户名 提及。
+// 输入中的 HTML 一律转义，输出只包含渲染器自己生成的标签，
+// 链接只允许 http、https、mailto 和站内路径，因此不需要再做额外的清理。
+package markdown
+
+import (
+	"html"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// 引用的最大嵌套层数，超过时按普通段落处理
+const maxQuoteDepth = 8
+
+var (
+	headingPattern     = regexp.MustCompile(`^(#{1,6})\s+(.*?)\s*#*\s*$`)
+	unorderedPattern   = regexp.MustCompile(`^\s{0,3}[-*+]\s+(.*)$`)
+	orderedPattern     = regexp.MustCompile(`^\s{0,3}(\d{1,9})[.)]\s+(.*)$`)
+	rulePattern        = regexp.MustCompile(`^\s{0,3}(-\s*-\s*-[-\s]*|\*\s*\*\s*\*[*\s]*|_\s*_\s*_[_\s]*)$`)
+	fencePattern       = regexp.MustCompile("^\\s{0,3}(```+|~~~+)\\s*([A-Za-z0-9_+-]*)")
+	codeLanguageFilter = regexp.MustCompile(`^[A-Za-z0-9_+-]{1,32}$`)
+)
+
+// Render 将 Markdown 渲染为 HTML。mentions 为可以提及的用户名到用户ID的映射，
+// 不在其中的 @用户名 按普通文本输出
+func Render(text string, mentions map[string]string) string {
+	r := &renderer{mentions: mentions}
+	return r.blocks(splitLines(text), 0)
+}
+
+// Mentions 返回文本中提及的用户名（按出现顺序去重），代码中的 @ 不算提及
+func Mentions(text string) []string {
+	r := &renderer{}
+	r.blocks(splitLines(text), 0)
+	return r.names
+}
+
+type renderer struct {
+	mentions map[string]string
+	seen     map[string]bool
+	names    []string
+}
+
+func splitLines(text string) []string {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	text = strings.ReplaceAll(text, "\r", "\n")
+	return strings.Split(text, "\n")
+}
+
+func isBlank(line string) bool {
+	return strings.TrimSpace(line) == ""
+}
+
+// blocks 渲染块级元素
+func (r *renderer) blocks(lines []string, depth int) string {
+	var out strings.Builder
+	for i := 0; i < len(lines); {
+		line := lines[i]
+
+		switch {
+		case isBlank(line):
+			i++
+
+		case fencePattern.MatchString(line):
+			match := fencePattern.FindStringSubmatch(line)
+			fence := match[1]
+			var code []string
+			i++
+			for i < len(lines) && !strings.HasPrefix(strings.TrimSpace(lines[i]), fence) {
+				code = append(code, lines[i])
+				i++
+			}
+			i++ // 跳过结束标记，未闭合时到文本末尾
+			out.WriteString("<pre><code")
+			if codeLanguageFilter.MatchString(match[2]) {
+				out.WriteString(` class="language-` + match[2] + `"`)
+			}
+			out.WriteString(">")
+			out.WriteString(html.EscapeString(strings.Join(code, "\n")))
+			out.WriteString("</code></pre>\n")
+
+		case headingPattern.MatchString(line):
+			match := headingPattern.FindStringSubmatch(line)
+			level := strconv.Itoa(len(match[1]))
+			out.WriteString("<h" + level + ">" + r.inline(match[2]) + "</h" + level + ">\n")
+			i++
+
+		case rulePattern.MatchString(line):
+			out.WriteString("<hr>\n")
+			i++
+
+		case strings.HasPrefix(strings.TrimSpace(line), ">") && depth < maxQuoteDepth:
+			var quoted []string
+			for i < len(lines) && strings.HasPrefix(strings.TrimSpace(lines[i]), ">") {
+				content := strings.TrimPrefix(strings.TrimSpace(lines[i]), ">")
+				quoted = append(quoted, strings.TrimPrefix(content, " "))
+				i++
+			}
+			out.WriteString("<blockquote>\n" + r.blocks(quoted, depth+1) + "</blockquote>\n")
+
+		case unorderedPattern.MatchString(line):
+			out.WriteString("<ul>\n")
+			for i < len(lines) && unorderedPattern.MatchString(lines[i]) && !rulePattern.MatchString(lines[i]) {
+				out.WriteString("<li>" + r.inline(unorderedPattern.FindStringSubmatch(lines[i])[1]) + "</li>\n")
+				i++
+			}
+			out.WriteString("</ul>\n")
+
+		case orderedPattern.MatchString(line):
+			start := orderedPattern.FindStringSubmatch(line)[1]
+			if n, err := strconv.Atoi(start); err == nil && n != 1 {
+				out.WriteString(`<ol start="` + strconv.Itoa(n) + `">` + "\n")
+			} else {
+				out.WriteString("<ol>\n")
+			}
+			for i < len(lines) && orderedPattern.MatchString(lines[i]) {
+				out.WriteString("<li>" + r.inline(orderedPattern.FindStringSubmatch(lines[i])[2]) + "</li>\n")
+				i++
+			}
+			out.WriteString("</ol>\n")
+
+		default:
+			// 段落：连续的非空行，段落内的换行保留为 <br>
+			var paragraph []string
+			for i < len(lines) && !isBlank(lines[i]) && (len(paragraph) == 0 || !startsBlock(lines[i])) {
+				paragraph = append(paragraph, r.inline(strings.TrimSpace(lines[i])))
+				i++
+			}
+			out.WriteString("<p>" + strings.Join(paragraph, "<br>\n") + "</p>\n")
+		}
+	}
+	return out.String()
+}
+
+// startsBlock 该行是否会开始一个新的块级元素，用于结束段落
+func startsBlock(line string) bool {
+	trimmed := strings.TrimSpace(line)
+	return fencePattern.MatchString(line) || headingPattern.MatchString(line) || rulePattern.MatchString(line) ||
+		strings.HasPrefix(trimmed, ">") || unorderedPattern.MatchString(line) || orderedPattern.MatchString(line)
+}
+
+// inline 渲染行内元素
+func (r *renderer) inline(text string) string {
+	return r.inlineRunes([]rune(text))
+}
+
+func (r *renderer) inlineRunes(text []rune) string {
+	var out strings.Builder
+	for i := 0; i < len(text); {
+		ch := text[i]
+		var prev rune
+		if i > 0 {
+			prev = text[i-1]
+		}
+
+		switch {
+		case ch == '\\' && i+1 < len(text) && (unicode.IsPunct(text[i+1]) || unicode.IsSymbol(text[i+1])):
+			out.WriteString(html.EscapeString(string(text[i+1])))
+			i += 2
+			continue
+
+		case ch == '`':
+			if end := indexRunes(text, i+1, []rune("`")); end > i+1 {
+				out.WriteString("<code>" + html.EscapeString(string(text[i+1:end])) + "</code>")
+				i = end + 1
+				continue
+			}
+
+		case ch == '*' && hasPrefix(text, i, "**"), ch == '_' && hasPrefix(text, i, "__") && !isWordRune(prev):
+			marker := string(text[i : i+2])
+			if end := indexRunes(text, i+2, []rune(marker)); end > i+2 {
+				out.WriteString("<strong>" + r.inlineRunes(text[i+2:end]) + "</strong>")
+				i = end + 2
+				continue
+			}
+
+		case ch == '~' && hasPrefix(text, i, "~~"):
+			if end := indexRunes(text, i+2, []rune("~~")); end > i+2 {
+				out.WriteString("<del>" + r.inlineRunes(text[i+2:end]) + "</del>")
+				i = end + 2
+				continue
+			}
+
+		case ch == '*' && i+1 < len(text) && !unicode.IsSpace(text[i+1]),
+			ch == '_' && !isWordRune(prev) && i+1 < len(text) && !unicode.IsSpace(text[i+1]):
+			if end := indexRunes(text, i+1, []rune{ch}); end > i+1 && (ch == '*' || end+1 >= len(text) || !isWordRune(text[end+1])) {
+				out.WriteString("<em>" + r.inlineRunes(text[i+1:end]) + "</em>")
+				i = end + 1
+				continue
+			}
+
+		case ch == '[':
+			if rendered, next, ok := r.link(text, i); ok {
+				out.WriteString(rendered)
+				i = next
+				continue
+			}
+
+		case ch == 'h' && !isWordRune(prev) && (hasPrefix(text, i, "http://") || hasPrefix(text, i, "https://")):
+			end := i
+			for end < len(text) && !unicode.IsSpace(text[end]) && text[end] != '<' && text[end] != '>' && text[end] != '"' {
+				end++
+			}
+			for end > i && strings.ContainsRune(".,;:!?)）。，；：！？、", text[end-1]) {
+				end--
+			}
+			if href, ok := safeURL(string(text[i:end])); ok {
+				out.WriteString(anchor(href, html.EscapeString(string(text[i:end]))))
+				i = end
+				continue
+			}
+
+		case ch == '@' && !isWordRune(prev) && prev != '@':
+			end := i + 1
+			for end < len(text) && isNameRune(text[end]) {
+				end++
+			}
+			for end > i+1 && text[end-1] == '.' {
+				end--
+			}
+			if end > i+1 {
+				name := string(text[i+1 : end])
+				r.mention(name)
+				if id, ok := r.mentions[name]; ok {
+					out.WriteString(`<a class="mention" href="/api/users/` + html.EscapeString(url.PathEscape(id)) + `" data-user-id="` + html.EscapeString(id) + `">@` + html.EscapeString(name) + `</a>`)
+				} else {
+					out.WriteString("@" + html.EscapeString(name))
+				}
+				i = end
+				continue
+			}
+		}
+
+		out.WriteString(html.EscapeString(string(ch)))
+		i++
+	}
+	return out.String()
+}
+
+// link 渲染 [文字](地址)，地址不安全时按普通文本输出
+func (r *renderer) link(text []rune, start int) (string, int, bool) {
+	closeText := indexRunes(text, start+1, []rune("]("))
+	if closeText < 0 {
+		return "", 0, false
+	}
+	closeURL := indexRunes(text, closeText+2, []rune(")"))
+	if closeURL < 0 {
+		return "", 0, false
+	}
+	href, ok := safeURL(strings.TrimSpace(string(text[closeText+2 : closeURL])))
+	if !ok {
+		return "", 0, false
+	}
+	return anchor(href, r.inlineRunes(text[start+1:closeText])), closeURL + 1, true
+}
+
+func anchor(href, label string) string {
+	return `<a href="` + html.EscapeString(href) + `" rel="nofollow noopener noreferrer" target="_blank">` + label + `</a>`
+}
+
+// safeURL 只允许 http、https、mailto 链接和站内路径
+func safeURL(raw string) (string, bool) {
+	if raw == "" || strings.ContainsAny(raw, " \t\n<>\"'`") {
+		return "", false
+	}
+	for _, ch := range raw {
+		if unicode.IsControl(ch) {
+			return "", false
+		}
+	}
+	parsed, err := url.Parse(raw)
+	if err != nil {
+		return "", false
+	}
+	switch strings.ToLower(parsed.Scheme) {
+	case "http", "https":
+		if parsed.Host == "" {
+			return "", false
+		}
+		return parsed.String(), true
+	case "mailto":
+		return parsed.String(), true
+	case "":
+		if strings.HasPrefix(raw, "/") && !strings.HasPrefix(raw, "//") {
+			return parsed.String(), true
+		}
+	}
+	return "", false
+}
+
+func (r *renderer) mention(name string) {
+	if r.seen == nil {
+		r.seen = make(map[string]bool)
+	}
+	if !r.seen[name] {
+		r.seen[name] = true
+		r.names = append(r.names, name)
+	}
+}
+
+// isWordRune 字母、数字和下划线，用于判断 _ 和 @ 是否在单词中间
+func isWordRune(ch rune) bool {
+	return ch == '_' || unicode.IsLetter(ch) || unicode.IsDigit(ch)
+}
+
+// isNameRune 用户名中可以出现的字符，包括中文等非拉丁字母
+func isNameRune(ch rune) bool {
+	return isWordRune(ch) || ch == '-' || ch == '.'
+}
+
+func hasPrefix(text []rune, start int, prefix string) bool {
+	p := []rune(prefix)
+	if start+len(p) > len(text) {
+		return false
+	}
+	for i, ch := range p {
+		if text[start+i] != ch {
+			return false
+		}
+	}
+	return true
+}
+
+// indexRunes 从 start 开始查找 sub 第一次出现的位置，找不到时返回 -1
+func indexRunes(text []rune, start int, sub []rune) int {
+	for i := start; i+len(sub) <= len(text); i++ {
+		if hasPrefix(text, i, string(sub)) {
+			return i
+		}
+	}
+	return -1
+}
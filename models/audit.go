@@ -0,0 +1,91 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jinzhu/gorm"
+)
+
+// 审计操作
+const (
+	AuditUserCreate       = "user.create"
+	AuditUserRoleUpdate   = "user.role"
+	AuditPollCreate       = "poll.create"
+	AuditPollUpdate       = "poll.update"
+	AuditPollDelete       = "poll.delete"
+	AuditPollResolve      = "poll.resolve"
+	AuditPollRestore      = "poll.restore"
+	AuditOptionCreate     = "option.create"
+	AuditOptionUpdate     = "option.update"
+	AuditOptionDelete     = "option.delete"
+	AuditOptionRestore    = "option.restore"
+	AuditVoteCast         = "vote.cast"
+	AuditCommentCreate    = "comment.create"
+	AuditCommentUpdate    = "comment.update"
+	AuditCommentDelete    = "comment.delete"
+	AuditCommentRestore   = "comment.restore"
+	AuditCommentReport    = "comment.report"
+	AuditCommentHide      = "comment.hide"      // 举报数达到阈值后自动隐藏
+	AuditCommentApprove   = "comment.approve"   // 审核通过
+	AuditCommentRemove    = "comment.remove"    // 审核员移除
+	AuditCommentReinstate = "comment.reinstate" // 审核员恢复被隐藏或移除的评论
+	AuditCommentPin       = "comment.pin"       // 投票创建者置顶评论
+	AuditCommentUnpin     = "comment.unpin"
+	AuditReactionCreate   = "reaction.create"
+	AuditReactionDelete   = "reaction.delete"
+	AuditWebhookCreate    = "webhook.create"
+	AuditWebhookDelete    = "webhook.delete"
+	AuditFilterRuleCreate = "filter_rule.create"
+	AuditFilterRuleUpdate = "filter_rule.update"
+	AuditFilterRuleDelete = "filter_rule.delete"
+
+	AuditNotificationPreferenceUpdate = "notification_preference.update" // 用户修改自己的通知设置
+	AuditEmailSettingsUpdate          = "user.email_settings"            // 用户修改自己的邮件通知设置
+	AuditPollWatch                    = "poll.watch"                     // 用户关注投票，创建投票和发表评论时的自动关注不单独记录
+	AuditPollUnwatch                  = "poll.unwatch"
+)
+
+// 审计对象类型
+const (
+	AuditTargetUser       = "user"
+	AuditTargetPoll       = "poll"
+	AuditTargetOption     = "option"
+	AuditTargetComment    = "comment"
+	AuditTargetReaction   = "reaction"
+	AuditTargetWebhook    = "webhook"
+	AuditTargetFilterRule = "filter_rule"
+)
+
+// ErrAuditImmutable 审计记录只允许追加，不能修改或删除
+var ErrAuditImmutable = errors.New("审计记录不能修改或删除")
+
+// AuditEntry 审计记录，与被记录的修改在同一事务中写入
+type AuditEntry struct {
+	ID         string    `json:"id" gorm:"primary_key"`
+	ActorID    string    `json:"actor_id" gorm:"index"` // 操作者的用户ID，匿名操作为空
+	Action     string    `json:"action" gorm:"not null;index"`
+	TargetType string    `json:"target_type" gorm:"not null"`
+	TargetID   string    `json:"target_id" gorm:"not null"`
+	PollID     string    `json:"poll_id" gorm:"index"`              // 操作所属的投票，与投票无关的操作为空
+	Before     string    `json:"before,omitempty" gorm:"type:text"` // 修改前的值（JSON）
+	After      string    `json:"after,omitempty" gorm:"type:text"`  // 修改后的值（JSON）
+	RequestID  string    `json:"request_id" gorm:"index"`
+	CreatedAt  time.Time `json:"created_at" gorm:"index"`
+}
+
+// BeforeCreate 在创建记录前生成UUID
+func (entry *AuditEntry) BeforeCreate(scope *gorm.Scope) error {
+	return scope.SetColumn("ID", uuid.New().String())
+}
+
+// BeforeUpdate 禁止修改审计记录
+func (entry *AuditEntry) BeforeUpdate() error {
+	return ErrAuditImmutable
+}
+
+// BeforeDelete 禁止删除审计记录
+func (entry *AuditEntry) BeforeDelete() error {
+	return ErrAuditImmutable
+}
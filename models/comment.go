@@ -1,26 +1,133 @@
 package models
 
 import (
+	"database/sql/driver"
+	"fmt"
 	"time"
 
+	"vote-demo/markdown"
+
 	"github.com/google/uuid"
 	"github.com/jinzhu/gorm"
 )
 
+// 评论状态，只有 visible 的评论会出现在评论列表中
+const (
+	CommentVisible = "visible" // 正常显示
+	CommentPending = "pending" // 开启审核的投票中等待审核的新评论
+	CommentHidden  = "hidden"  // 举报数达到阈值后自动隐藏，等待审核
+	CommentRemoved = "removed" // 被审核员移除
+)
+
+// DeletedCommentContent 有回复的评论被作者删除后，保留为占位显示的内容
+const DeletedCommentContent = "[deleted]"
+
+// NullableID 可以为空的外键ID，空字符串在数据库中保存为 NULL，读取 NULL 时为空字符串。
+// 外键列不能保存空字符串，否则会被当作指向不存在的记录
+type NullableID string
+
+// Value 实现 driver.Valuer
+func (id NullableID) Value() (driver.Value, error) {
+	if id == "" {
+		return nil, nil
+	}
+	return string(id), nil
+}
+
+// Scan 实现 sql.Scanner
+func (id *NullableID) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		*id = ""
+	case string:
+		*id = NullableID(v)
+	case []byte:
+		*id = NullableID(v)
+	default:
+		return fmt.Errorf("无法将 %T 转换为 NullableID", value)
+	}
+	return nil
+}
+
 // Comment 评论模型
 type Comment struct {
-	ID        string    `json:"id" gorm:"primary_key"`
-	PollID    string    `json:"poll_id" gorm:"not null"`
-	UserID    string    `json:"user_id" gorm:"not null"`
-	Content   string    `json:"content" gorm:"not null"`
-	ParentID  string    `json:"parent_id"` // 父评论ID，用于回复功能
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
-	User      User      `json:"user,omitempty" gorm:"foreignkey:UserID"`
-	Replies   []Comment `json:"replies,omitempty" gorm:"-"` // 不存储在数据库中，用于API响应
+	ID            string           `json:"id" gorm:"primary_key"`
+	PollID        string           `json:"poll_id" gorm:"not null" sql:"type:varchar(255) REFERENCES polls(id) ON DELETE CASCADE"`
+	UserID        string           `json:"user_id" gorm:"not null"`
+	Content       string           `json:"content" gorm:"not null"`
+	ContentHTML   string           `json:"content_html" gorm:"type:text"`                                                            // Content 按 Markdown 渲染后的安全 HTML，写入评论时生成
+	ParentID      NullableID       `json:"parent_id" gorm:"index" sql:"type:varchar(255) REFERENCES comments(id) ON DELETE CASCADE"` // 父评论ID，用于回复功能；根评论为空（数据库中为 NULL）
+	Status        string           `json:"status" gorm:"not null;default:'visible';index"`
+	EditCount     int              `json:"edit_count" gorm:"not null;default:0"`     // 作者修改的次数，修改前的内容保存在 CommentRevision 中
+	EditedAt      *time.Time       `json:"edited_at,omitempty"`                      // 最后一次修改的时间
+	IsDeleted     bool             `json:"is_deleted" gorm:"not null;default:false"` // 有回复的评论被作者删除后保留为占位，内容替换为 [deleted]
+	PinnedAt      *time.Time       `json:"pinned_at,omitempty"`                      // 投票创建者置顶评论的时间，未置顶为空
+	Score         float64          `json:"-" gorm:"not null;default:0"`              // 赞成和反对的 Wilson 得分，反应变化时更新，用于 top 排序
+	Edited        bool             `json:"edited" gorm:"-"`                          // 是否修改过
+	Pinned        bool             `json:"pinned" gorm:"-"`                          // 是否置顶
+	IsPollCreator bool             `json:"is_poll_creator" gorm:"-"`                 // 是否由投票创建者发表
+	CreatedAt     time.Time        `json:"created_at"`
+	UpdatedAt     time.Time        `json:"updated_at"`
+	DeletedAt     *time.Time       `json:"deleted_at,omitempty" sql:"index"` // 移入回收站的时间，查询时自动排除
+	User          User             `json:"user,omitempty" gorm:"foreignkey:UserID"`
+	Mentions      []CommentMention `json:"mentions,omitempty" gorm:"foreignkey:CommentID"`
+	Replies       []Comment        `json:"replies,omitempty" gorm:"-"`        // 不存储在数据库中，用于API响应
+	Reactions     map[string]int   `json:"reactions" gorm:"-"`                // 各类反应的数量
+	MyReactions   []string         `json:"my_reactions,omitempty" gorm:"-"`   // 当前用户添加的反应
+	ReplyCount    int              `json:"reply_count" gorm:"-"`              // 直接回复数，未展开的回复也计入
+	RepliesCursor string           `json:"replies_cursor,omitempty" gorm:"-"` // 还有未返回的回复时，用于继续加载回复的游标
 }
 
 // BeforeCreate 在创建记录前生成UUID
 func (comment *Comment) BeforeCreate(scope *gorm.Scope) error {
 	return scope.SetColumn("ID", uuid.New().String())
-} 
\ No newline at end of file
+}
+
+// AfterFind 设置修改和置顶标记。早期的评论没有保存渲染结果，读取时按 Markdown 渲染（其中的 @用户名 不会生成链接）
+func (comment *Comment) AfterFind() error {
+	comment.Edited = comment.EditCount > 0
+	comment.Pinned = comment.PinnedAt != nil
+	if comment.ContentHTML == "" && comment.Content != "" {
+		comment.ContentHTML = markdown.Render(comment.Content, nil)
+	}
+	return nil
+}
+
+// CommentMention 评论中 @ 提及的用户，修改评论时重新生成
+type CommentMention struct {
+	ID        string    `json:"-" gorm:"primary_key"`
+	CommentID string    `json:"-" gorm:"not null;unique_index:idx_comment_mention" sql:"type:varchar(255) REFERENCES comments(id) ON DELETE CASCADE"`
+	PollID    string    `json:"-" gorm:"not null;index" sql:"type:varchar(255) REFERENCES polls(id) ON DELETE CASCADE"`
+	UserID    string    `json:"user_id" gorm:"not null;unique_index:idx_comment_mention;index"`
+	Username  string    `json:"username"`
+	CreatedAt time.Time `json:"-"`
+}
+
+// BeforeCreate 在创建记录前生成UUID
+func (mention *CommentMention) BeforeCreate(scope *gorm.Scope) error {
+	return scope.SetColumn("ID", uuid.New().String())
+}
+
+// 举报状态
+const (
+	ReportOpen     = "open"     // 等待处理
+	ReportResolved = "resolved" // 审核员已经处理（通过或移除评论）
+)
+
+// CommentReport 用户对评论的举报，每个用户对同一评论只能举报一次
+type CommentReport struct {
+	ID         string     `json:"id" gorm:"primary_key"`
+	CommentID  string     `json:"comment_id" gorm:"not null;unique_index:idx_comment_reporter" sql:"type:varchar(255) REFERENCES comments(id) ON DELETE CASCADE"`
+	ReporterID string     `json:"reporter_id" gorm:"not null;unique_index:idx_comment_reporter"`
+	PollID     string     `json:"poll_id" gorm:"not null;index" sql:"type:varchar(255) REFERENCES polls(id) ON DELETE CASCADE"`
+	Reason     string     `json:"reason"`
+	Status     string     `json:"status" gorm:"not null;index"`
+	ResolvedBy string     `json:"resolved_by,omitempty"`
+	ResolvedAt *time.Time `json:"resolved_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// BeforeCreate 在创建记录前生成UUID
+func (report *CommentReport) BeforeCreate(scope *gorm.Scope) error {
+	return scope.SetColumn("ID", uuid.New().String())
+}
@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+// 内容过滤规则命中后的处理方式
+const (
+	FilterActionReject   = "reject"   // 拒绝提交
+	FilterActionMask     = "mask"     // 将命中的内容替换为 *
+	FilterActionModerate = "moderate" // 评论进入审核队列，等待审核通过后显示
+)
+
+// FilterRule 内容过滤规则，用于评论、投票标题和描述以及选项内容
+type FilterRule struct {
+	ID        uint      `json:"id" gorm:"primary_key"`
+	Pattern   string    `json:"pattern" gorm:"not null"` // 屏蔽词或正则表达式
+	IsRegex   bool      `json:"is_regex"`                // 为 true 时 Pattern 按正则表达式匹配
+	Action    string    `json:"action" gorm:"not null"`  // reject、mask 或 moderate
+	Enabled   bool      `json:"enabled" gorm:"default:true"`
+	Note      string    `json:"note"` // 备注
+	CreatedBy string    `json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
@@ -0,0 +1,24 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jinzhu/gorm"
+)
+
+// ForecastScore 预测投票结算后每位预测者的得分，构成用户的校准历史
+type ForecastScore struct {
+	ID          string    `json:"id" gorm:"primary_key"`
+	PollID      string    `json:"poll_id" gorm:"not null" sql:"type:varchar(255) REFERENCES polls(id) ON DELETE CASCADE"`
+	UserID      string    `json:"user_id" gorm:"not null"`
+	Probability float64   `json:"probability"` // 为实际结果给出的概率
+	Brier       float64   `json:"brier"`       // Brier 分数，越低越好，范围 0~2
+	LogScore    float64   `json:"log_score"`   // 对数分数 ln(p)，越高越好
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// BeforeCreate 在创建记录前生成UUID
+func (score *ForecastScore) BeforeCreate(scope *gorm.Scope) error {
+	return scope.SetColumn("ID", uuid.New().String())
+}
@@ -0,0 +1,74 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jinzhu/gorm"
+)
+
+// 通知类型
+const (
+	NotificationMention     = "mention"           // 在评论中被 @ 提及
+	NotificationReply       = "reply"             // 自己的评论收到回复
+	NotificationClosingSoon = "poll_closing_soon" // 参与讨论但还没有投票的投票即将截止
+	NotificationResults     = "poll_results"      // 参与的投票已结束，可以查看结果
+)
+
+// NotificationTypes 所有通知类型，用于通知设置
+var NotificationTypes = []string{NotificationMention, NotificationReply, NotificationClosingSoon, NotificationResults}
+
+// ValidNotificationType 检查通知类型是否有效
+func ValidNotificationType(kind string) bool {
+	for _, t := range NotificationTypes {
+		if kind == t {
+			return true
+		}
+	}
+	return false
+}
+
+// EmailNotificationTypes 可以通过邮件发送的通知类型
+var EmailNotificationTypes = []string{NotificationReply, NotificationClosingSoon, NotificationResults}
+
+// ValidEmailNotificationType 检查通知类型是否可以通过邮件发送
+func ValidEmailNotificationType(kind string) bool {
+	for _, t := range EmailNotificationTypes {
+		if kind == t {
+			return true
+		}
+	}
+	return false
+}
+
+// Notification 发给用户的通知。同一投票或评论对同一用户的同类通知只有一条
+type Notification struct {
+	ID                 string     `json:"id" gorm:"primary_key"`
+	UserID             string     `json:"user_id" gorm:"not null;index;unique_index:idx_notification_target"` // 接收通知的用户
+	Type               string     `json:"type" gorm:"not null;unique_index:idx_notification_target"`
+	ActorID            string     `json:"actor_id,omitempty"` // 触发通知的用户，系统通知为空
+	PollID             string     `json:"poll_id,omitempty" gorm:"index;unique_index:idx_notification_target"`
+	CommentID          string     `json:"comment_id,omitempty" gorm:"unique_index:idx_notification_target"`
+	ReadAt             *time.Time `json:"read_at,omitempty"`
+	EmailPending       bool       `json:"-" gorm:"not null;default:false;index"` // 等待发送邮件，发送成功或放弃重试后清除
+	EmailAttempts      int        `json:"-"`                                     // 发送邮件失败的次数
+	EmailNextAttemptAt *time.Time `json:"-"`                                     // 发送失败后下次重试的时间，为空表示立即发送
+	EmailedAt          *time.Time `json:"emailed_at,omitempty"`
+	CreatedAt          time.Time  `json:"created_at"`
+	Actor              *User      `json:"actor,omitempty" gorm:"foreignkey:ActorID"`
+	PollTitle          string     `json:"poll_title,omitempty" gorm:"-"` // 不存储在数据库中，用于API响应
+}
+
+// BeforeCreate 在创建记录前生成UUID
+func (notification *Notification) BeforeCreate(scope *gorm.Scope) error {
+	return scope.SetColumn("ID", uuid.New().String())
+}
+
+// NotificationPreference 用户对某类通知的设置，没有记录时默认接收
+type NotificationPreference struct {
+	UserID    string    `json:"-" gorm:"primary_key"`
+	Type      string    `json:"type" gorm:"primary_key"`
+	Enabled   bool      `json:"enabled"` // 是否接收站内通知
+	Email     *bool     `json:"email"`   // 是否同时发送邮件，为空时按默认接收
+	UpdatedAt time.Time `json:"updated_at"`
+}
@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+// 发件箱事件状态
+const (
+	OutboxStatusPending = "pending" // 等待投递给订阅者
+	OutboxStatusDone    = "done"    // 所有订阅者均已处理
+	OutboxStatusFailed  = "failed"  // 有订阅者多次处理失败后放弃，或事件无法解析；其他订阅者已处理
+)
+
+// OutboxEvent 发件箱中的领域事件，与业务数据在同一事务中写入，由投递协程投递给事件订阅者
+type OutboxEvent struct {
+	ID          uint       `json:"id" gorm:"primary_key"` // 自增ID，即事件的提交顺序
+	Name        string     `json:"name" gorm:"not null"`
+	PollID      string     `json:"poll_id" gorm:"index"`
+	Payload     string     `json:"payload" gorm:"type:text"`
+	Status      string     `json:"status" gorm:"not null;index"`
+	Error       string     `json:"error,omitempty" gorm:"type:text"` // 失败时记录放弃处理的订阅者和最后一次错误
+	CreatedAt   time.Time  `json:"created_at"`
+	ProcessedAt *time.Time `json:"processed_at,omitempty"`
+}
@@ -9,49 +9,113 @@ import (
 
 // 投票类型
 const (
-	PollTypeBinary = "binary"  // 二分选项（是/否）
-	PollTypeSingle = "single"  // 单选
-	PollTypeMulti  = "multi"   // 多选
+	PollTypeBinary    = "binary"    // 二分选项（是/否）
+	PollTypeSingle    = "single"    // 单选
+	PollTypeMulti     = "multi"     // 多选
+	PollTypeQuadratic = "quadratic" // 二次方投票
+	PollTypeDot       = "dot"       // 点投票（预算分配）
+	PollTypeSchedule  = "schedule"  // 时间安排（选项为时间段）
+	PollTypeForecast  = "forecast"  // 预测（为每个选项给出概率）
 )
 
+// 时间安排投票中对每个时间段的回答
+const (
+	AnswerYes      = "yes"        // 可以
+	AnswerIfNeedBe = "if_need_be" // 必要时可以
+	AnswerNo       = "no"         // 不可以
+)
+
+// DefaultCreditBudget 二次方投票默认的每人信用点预算
+const DefaultCreditBudget = 100
+
+// DefaultPointBudget 点投票默认的每人点数
+const DefaultPointBudget = 10
+
 // Poll 投票模型
 type Poll struct {
-	ID          string    `json:"id" gorm:"primary_key"`
-	Title       string    `json:"title" gorm:"not null"`
-	Description string    `json:"description"`
-	Type        string    `json:"type" gorm:"not null"` // binary, single, multi
-	CreatedAt   time.Time `json:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at"`
-	EndTime     time.Time `json:"end_time"`
-	IsActive    bool      `json:"is_active" gorm:"default:true"`
-	Options     []Option  `json:"options" gorm:"foreignkey:PollID"`
+	ID               string     `json:"id" gorm:"primary_key"`
+	Title            string     `json:"title" gorm:"not null"`
+	Description      string     `json:"description"`
+	CreatorID        string     `json:"creator_id"`           // 创建者ID
+	Type             string     `json:"type" gorm:"not null"` // binary, single, multi, quadratic, dot, schedule, forecast
+	CreatedAt        time.Time  `json:"created_at"`
+	UpdatedAt        time.Time  `json:"updated_at"`
+	EndTime          time.Time  `json:"end_time"`
+	IsActive         bool       `json:"is_active" gorm:"default:true"`
+	ClosedAt         *time.Time `json:"closed_at,omitempty"`              // 记录 PollClosed 事件的时间，重新开启后清空，保证每次关闭只记录一次
+	CreditBudget     int        `json:"credit_budget,omitempty"`          // 二次方投票中每位投票者的信用点预算
+	PointBudget      int        `json:"point_budget,omitempty"`           // 点投票中每位投票者可分配的总点数
+	MaxPerOption     int        `json:"max_per_option,omitempty"`         // 点投票中单个选项最多可分配的点数，0 表示不限制
+	IsQuiz           bool       `json:"is_quiz"`                          // 测验模式：选项可以标记正确答案，投票结束后公布
+	ResolvedOptionID string     `json:"resolved_option_id,omitempty"`     // 预测投票：结算时的实际结果
+	ResolvedAt       *time.Time `json:"resolved_at,omitempty"`            // 预测投票：结算时间
+	Version          int        `json:"version" gorm:"default:1"`         // 标题和描述的版本号，每次修改加一
+	LockOptions      bool       `json:"lock_options"`                     // 有人投票后禁止添加、修改和删除选项
+	PreModerate      bool       `json:"pre_moderate"`                     // 新评论需要审核通过后才显示
+	DeletedAt        *time.Time `json:"deleted_at,omitempty" sql:"index"` // 移入回收站的时间，查询时自动排除
+	Options          []Option   `json:"options" gorm:"foreignkey:PollID"`
 }
 
 // Option 选项模型
 type Option struct {
-	ID        string    `json:"id" gorm:"primary_key"`
-	PollID    string    `json:"poll_id" gorm:"not null"`
-	Text      string    `json:"text" gorm:"not null"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
-	Votes     []Vote    `json:"votes,omitempty" gorm:"foreignkey:OptionID"`
+	ID               string     `json:"id" gorm:"primary_key"`
+	PollID           string     `json:"poll_id" gorm:"not null;index" sql:"type:varchar(255) REFERENCES polls(id) ON DELETE CASCADE"`
+	Text             string     `json:"text" gorm:"not null"`
+	StartsAt         *time.Time `json:"starts_at,omitempty"`              // 时间安排投票：时间段开始时间
+	EndsAt           *time.Time `json:"ends_at,omitempty"`                // 时间安排投票：时间段结束时间
+	Timezone         string     `json:"timezone,omitempty"`               // 时间安排投票：时间段所在时区（IANA 名称）
+	IsCorrect        bool       `json:"-"`                                // 测验模式：是否为正确答案，投票结束前不对外返回
+	Correct          *bool      `json:"is_correct,omitempty" gorm:"-"`    // 测验模式：投票结束后公布的正确答案，用于API响应
+	Version          int        `json:"version" gorm:"default:1"`         // 选项内容的版本号，每次修改加一
+	EditedAfterVotes bool       `json:"edited_after_votes"`               // 有人投票后选项内容被修改过
+	DeletedAt        *time.Time `json:"deleted_at,omitempty" sql:"index"` // 移入回收站的时间，查询时自动排除
+	CreatedAt        time.Time  `json:"created_at"`
+	UpdatedAt        time.Time  `json:"updated_at"`
+	Votes            []Vote     `json:"votes,omitempty" gorm:"foreignkey:OptionID"`
 }
 
 // Vote 投票记录模型
 type Vote struct {
-	ID        string    `json:"id" gorm:"primary_key"`
-	PollID    string    `json:"poll_id" gorm:"not null"`
-	OptionID  string    `json:"option_id" gorm:"not null"`
-	UserID    string    `json:"user_id" gorm:"not null"`
-	CreatedAt time.Time `json:"created_at"`
+	ID          string     `json:"id" gorm:"primary_key"`
+	PollID      string     `json:"poll_id" gorm:"not null;index" sql:"type:varchar(255) REFERENCES polls(id) ON DELETE CASCADE"`
+	OptionID    string     `json:"option_id" gorm:"not null;index" sql:"type:varchar(255) REFERENCES options(id) ON DELETE CASCADE"`
+	UserID      string     `json:"user_id" gorm:"not null"`
+	Weight      int        `json:"weight" gorm:"default:1"` // 票数，二次方投票中花费 weight² 个信用点，点投票中为分配的点数
+	Answer      string     `json:"answer,omitempty"`        // 时间安排投票：yes、if_need_be 或 no
+	Probability float64    `json:"probability,omitempty"`   // 预测投票：为该选项给出的概率
+	CreatedAt   time.Time  `json:"created_at"`
+	DeletedAt   *time.Time `json:"deleted_at,omitempty" sql:"index"` // 随选项或投票移入回收站的时间
+}
+
+// 用户角色
+const (
+	RoleUser      = "user"      // 普通用户
+	RoleModerator = "moderator" // 评论审核员，可以处理所有投票的评论
+	RoleAdmin     = "admin"     // 管理员
+)
+
+// ValidRole 检查用户角色是否有效
+func ValidRole(role string) bool {
+	return role == RoleUser || role == RoleModerator || role == RoleAdmin
 }
 
 // User 用户模型
 type User struct {
-	ID        string    `json:"id" gorm:"primary_key"`
-	Username  string    `json:"username" gorm:"unique;not null"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID                  string     `json:"id" gorm:"primary_key"`
+	Username            string     `json:"username" gorm:"unique;not null"`
+	Role                string     `json:"role" gorm:"default:'user'"` // user、moderator 或 admin
+	CreatedAt           time.Time  `json:"created_at"`
+	UpdatedAt           time.Time  `json:"updated_at"`
+	Email               string     `json:"-"`                                       // 接收邮件通知的地址，为空时不发送邮件
+	Language            string     `json:"language,omitempty"`                      // 邮件使用的语言，zh（默认）或 en
+	EmailDigest         bool       `json:"-"`                                       // 邮件通知合并为定期发送的摘要
+	LastDigestAt        *time.Time `json:"-"`                                       // 上次发送摘要邮件的时间
+	UnreadNotifications *int       `json:"unread_notifications,omitempty" gorm:"-"` // 未读通知数，只在用户查看自己的资料时返回
+}
+
+// IsClosed 投票是否已结束（已停用或已过截止时间）
+func (poll *Poll) IsClosed() bool {
+	return !poll.IsActive || (!poll.EndTime.IsZero() && poll.EndTime.Before(time.Now()))
 }
 
 // BeforeCreate 在创建记录前生成UUID
@@ -72,4 +136,4 @@ func (vote *Vote) BeforeCreate(scope *gorm.Scope) error {
 // BeforeCreate 在创建记录前生成UUID
 func (user *User) BeforeCreate(scope *gorm.Scope) error {
 	return scope.SetColumn("ID", uuid.New().String())
-} 
\ No newline at end of file
+}
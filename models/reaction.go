@@ -0,0 +1,58 @@
+package models
+
+import (
+	"math"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jinzhu/gorm"
+)
+
+// 评论的赞成和反对，同一用户只能选择其中一个
+const (
+	ReactionUp   = "up"
+	ReactionDown = "down"
+)
+
+// ReactionEmojis 可以用于评论反应的表情
+var ReactionEmojis = []string{"👍", "❤️", "😂", "😮", "😢", "🎉"}
+
+// ValidReaction 检查反应类型是否有效
+func ValidReaction(kind string) bool {
+	if kind == ReactionUp || kind == ReactionDown {
+		return true
+	}
+	for _, emoji := range ReactionEmojis {
+		if kind == emoji {
+			return true
+		}
+	}
+	return false
+}
+
+// WilsonScore 赞成比例的 Wilson 置信区间下界（95% 置信度）。
+// 票数少的评论下界较低，避免一两个赞成就排在大量赞成的评论前面
+func WilsonScore(up, down int) float64 {
+	n := float64(up + down)
+	if n == 0 {
+		return 0
+	}
+	const z = 1.96
+	p := float64(up) / n
+	return (p + z*z/(2*n) - z*math.Sqrt((p*(1-p)+z*z/(4*n))/n)) / (1 + z*z/n)
+}
+
+// CommentReaction 用户对评论的反应，每个用户对同一评论的每种反应只能有一个
+type CommentReaction struct {
+	ID        string    `json:"id" gorm:"primary_key"`
+	CommentID string    `json:"comment_id" gorm:"not null;unique_index:idx_comment_reaction" sql:"type:varchar(255) REFERENCES comments(id) ON DELETE CASCADE"`
+	UserID    string    `json:"user_id" gorm:"not null;unique_index:idx_comment_reaction"`
+	Kind      string    `json:"kind" gorm:"not null;unique_index:idx_comment_reaction"`
+	PollID    string    `json:"poll_id" gorm:"not null;index" sql:"type:varchar(255) REFERENCES polls(id) ON DELETE CASCADE"` // 冗余存储，用于按投票统计
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// BeforeCreate 在创建记录前生成UUID
+func (reaction *CommentReaction) BeforeCreate(scope *gorm.Scope) error {
+	return scope.SetColumn("ID", uuid.New().String())
+}
@@ -0,0 +1,57 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jinzhu/gorm"
+)
+
+// PollRevision 投票标题和描述的历史版本
+type PollRevision struct {
+	ID          string    `json:"id" gorm:"primary_key"`
+	PollID      string    `json:"poll_id" gorm:"not null;index" sql:"type:varchar(255) REFERENCES polls(id) ON DELETE CASCADE"`
+	Version     int       `json:"version" gorm:"not null"`
+	Title       string    `json:"title"`
+	Description string    `json:"description"`
+	EditorID    string    `json:"editor_id"` // 修改者的用户ID，匿名修改为空
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// OptionRevision 选项内容的历史版本
+type OptionRevision struct {
+	ID        string    `json:"id" gorm:"primary_key"`
+	OptionID  string    `json:"option_id" gorm:"not null;index" sql:"type:varchar(255) REFERENCES options(id) ON DELETE CASCADE"`
+	PollID    string    `json:"poll_id" gorm:"not null;index" sql:"type:varchar(255) REFERENCES polls(id) ON DELETE CASCADE"`
+	Version   int       `json:"version" gorm:"not null"`
+	Text      string    `json:"text"`
+	VoteCount int       `json:"vote_count"` // 该版本生效时选项已获得的投票记录数
+	EditorID  string    `json:"editor_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// CommentRevision 评论被修改或删除前的内容，Version 从 1（最初发表的内容）开始
+type CommentRevision struct {
+	ID         string    `json:"id" gorm:"primary_key"`
+	CommentID  string    `json:"comment_id" gorm:"not null;index" sql:"type:varchar(255) REFERENCES comments(id) ON DELETE CASCADE"`
+	PollID     string    `json:"poll_id" gorm:"not null;index" sql:"type:varchar(255) REFERENCES polls(id) ON DELETE CASCADE"`
+	Version    int       `json:"version" gorm:"not null"`
+	Content    string    `json:"content"`
+	CreatedAt  time.Time `json:"created_at"`  // 该版本发表或修改的时间
+	ReplacedAt time.Time `json:"replaced_at"` // 该版本被修改或删除的时间
+}
+
+// BeforeCreate 在创建记录前生成UUID
+func (revision *PollRevision) BeforeCreate(scope *gorm.Scope) error {
+	return scope.SetColumn("ID", uuid.New().String())
+}
+
+// BeforeCreate 在创建记录前生成UUID
+func (revision *OptionRevision) BeforeCreate(scope *gorm.Scope) error {
+	return scope.SetColumn("ID", uuid.New().String())
+}
+
+// BeforeCreate 在创建记录前生成UUID
+func (revision *CommentRevision) BeforeCreate(scope *gorm.Scope) error {
+	return scope.SetColumn("ID", uuid.New().String())
+}
@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+// PollWatch 用户关注的投票。创建投票或发表评论时自动关注，没有投票的用户也可以关注
+type PollWatch struct {
+	UserID        string    `json:"-" gorm:"primary_key"`
+	PollID        string    `json:"poll_id" gorm:"primary_key" sql:"type:varchar(255) REFERENCES polls(id) ON DELETE CASCADE"`
+	LastVisitedAt time.Time `json:"last_visited_at"` // 用户上次查看投票的时间，用于统计新评论和新投票
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// WatchedPoll 关注列表中的一项
+type WatchedPoll struct {
+	Poll          Poll      `json:"poll"`
+	WatchedAt     time.Time `json:"watched_at"`
+	LastVisitedAt time.Time `json:"last_visited_at"`
+	NewComments   int       `json:"new_comments"` // 上次查看后其他用户发表的评论数
+	NewVotes      int       `json:"new_votes"`    // 上次查看后投票的其他用户数
+}
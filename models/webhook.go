@@ -0,0 +1,62 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jinzhu/gorm"
+)
+
+// Webhook 事件类型
+const (
+	WebhookEventPollCreated  = "poll.created"
+	WebhookEventVoteCast     = "vote.cast"
+	WebhookEventPollClosed   = "poll.closed"
+	WebhookEventCommentAdded = "comment.added"
+)
+
+// Webhook 投送状态
+const (
+	DeliveryStatusPending   = "pending"   // 等待投送或等待重试
+	DeliveryStatusSucceeded = "succeeded" // 接收方返回 2xx
+	DeliveryStatusFailed    = "failed"    // 重试次数用尽
+)
+
+// Webhook 外发 Webhook 配置
+type Webhook struct {
+	ID        string    `json:"id" gorm:"primary_key"`
+	PollID    string    `json:"poll_id" gorm:"index"` // 为空表示全局 Webhook，接收所有投票的事件（仅管理员可创建）；删除投票时由应用代码级联删除
+	CreatorID string    `json:"creator_id" gorm:"not null"`
+	URL       string    `json:"url" gorm:"not null"`
+	Secret    string    `json:"-" gorm:"not null"`      // HMAC 签名密钥，只在创建时返回一次
+	Events    string    `json:"events" gorm:"not null"` // 订阅的事件，逗号分隔
+	IsActive  bool      `json:"is_active" gorm:"default:true"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// WebhookDelivery Webhook 投送记录
+type WebhookDelivery struct {
+	ID            string     `json:"id" gorm:"primary_key"`
+	WebhookID     string     `json:"webhook_id" gorm:"not null;index" sql:"type:varchar(255) REFERENCES webhooks(id) ON DELETE CASCADE"`
+	Event         string     `json:"event" gorm:"not null"`
+	Payload       string     `json:"payload" gorm:"type:text"`
+	Status        string     `json:"status" gorm:"not null;index"`
+	Attempts      int        `json:"attempts"`
+	ResponseCode  int        `json:"response_code,omitempty"`
+	Error         string     `json:"error,omitempty"`
+	NextAttemptAt *time.Time `json:"next_attempt_at,omitempty"`
+	DeliveredAt   *time.Time `json:"delivered_at,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+}
+
+// BeforeCreate 在创建记录前生成UUID
+func (webhook *Webhook) BeforeCreate(scope *gorm.Scope) error {
+	return scope.SetColumn("ID", uuid.New().String())
+}
+
+// BeforeCreate 在创建记录前生成UUID
+func (delivery *WebhookDelivery) BeforeCreate(scope *gorm.Scope) error {
+	return scope.SetColumn("ID", uuid.New().String())
+}
@@ -0,0 +1,249 @@
+// Package notifications 根据领域事件和投票截止时间为用户生成站内通知
+package notifications
+
+import (
+	"log"
+	"time"
+	"vote-demo/database"
+	"vote-demo/email"
+	"vote-demo/events"
+	"vote-demo/models"
+)
+
+const (
+	// ClosingSoonWindow 投票截止前多久发送即将截止的通知
+	ClosingSoonWindow = 24 * time.Hour
+	// 检查即将截止的投票的间隔
+	checkInterval = time.Minute
+)
+
+// SubscribeEvents 注册通知的事件订阅者，应在服务启动时调用
+func SubscribeEvents() {
+	events.Subscribe("notifications", handleEvent)
+}
+
+// handleEvent 为被提及的用户、被回复的评论作者和投票参与者生成通知。等待审核的评论在审核通过后才通知
+func handleEvent(event events.Event) error {
+	switch e := event.(type) {
+	case events.CommentAdded:
+		return notifyComment(e.Comment)
+	case events.CommentUpdated:
+		// 修改评论时只通知新提及的用户，已经通知过的用户不会重复通知
+		if e.Comment.Status == models.CommentVisible {
+			return notifyMentions(e.Comment)
+		}
+	case events.CommentModerated:
+		if e.Before.Status == models.CommentPending && e.Comment.Status == models.CommentVisible {
+			return notifyComment(e.Comment)
+		}
+	case events.PollClosed:
+		return notifyResults(e.Poll)
+	}
+	return nil
+}
+
+// StartScheduler 启动检查协程，定期为即将截止的投票发送通知。
+// 到达截止时间的投票由 deadlines 记录 PollClosed 事件，结果通知在处理事件时发送
+func StartScheduler() {
+	go func() {
+		ticker := time.NewTicker(checkInterval)
+		defer ticker.Stop()
+
+		for {
+			if err := checkDeadlines(time.Now()); err != nil {
+				log.Printf("检查投票截止时间失败: %v", err)
+			}
+			<-ticker.C
+		}
+	}()
+}
+
+// checkDeadlines 为 ClosingSoonWindow 内将要截止的投票发送即将截止的通知
+func checkDeadlines(now time.Time) error {
+	var closing []models.Poll
+	if err := database.DB.Where("is_active = ? AND end_time > ? AND end_time <= ?", true, now, now.Add(ClosingSoonWindow)).Find(&closing).Error; err != nil {
+		return err
+	}
+	for _, poll := range closing {
+		if err := notifyClosingSoon(poll); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// notifyComment 评论发表（或审核通过）后，通知被提及的用户和被回复的评论作者
+func notifyComment(comment models.Comment) error {
+	if err := notifyMentions(comment); err != nil {
+		return err
+	}
+	return notifyReply(comment)
+}
+
+// notifyMentions 为评论当前提及的用户（评论作者本人除外）创建通知
+func notifyMentions(comment models.Comment) error {
+	var mentions []models.CommentMention
+	if err := database.DB.Where("comment_id = ?", comment.ID).Find(&mentions).Error; err != nil {
+		return err
+	}
+	for _, mention := range mentions {
+		if mention.UserID == comment.UserID {
+			continue
+		}
+		if err := create(models.Notification{
+			UserID:    mention.UserID,
+			Type:      models.NotificationMention,
+			ActorID:   comment.UserID,
+			PollID:    comment.PollID,
+			CommentID: comment.ID,
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// notifyReply 通知被回复的评论作者，回复自己的评论不通知
+func notifyReply(comment models.Comment) error {
+	if comment.ParentID == "" {
+		return nil
+	}
+	var parent models.Comment
+	if err := database.DB.First(&parent, "id = ?", comment.ParentID).Error; err != nil {
+		// 父评论已被删除
+		return nil
+	}
+	if parent.IsDeleted || parent.UserID == comment.UserID {
+		return nil
+	}
+	return create(models.Notification{
+		UserID:    parent.UserID,
+		Type:      models.NotificationReply,
+		ActorID:   comment.UserID,
+		PollID:    comment.PollID,
+		CommentID: comment.ID,
+	})
+}
+
+// notifyClosingSoon 提醒投票创建者、参与讨论或关注投票但还没有投票的用户投票即将截止
+func notifyClosingSoon(poll models.Poll) error {
+	voted := make(map[string]bool)
+	for _, userID := range voters(poll.ID) {
+		voted[userID] = true
+	}
+	recipients := append([]string{poll.CreatorID}, commenters(poll.ID)...)
+	for _, userID := range unique(append(recipients, watchers(poll.ID)...)) {
+		if voted[userID] {
+			continue
+		}
+		if err := create(models.Notification{UserID: userID, Type: models.NotificationClosingSoon, PollID: poll.ID}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// notifyResults 通知投票创建者、投票者、参与讨论和关注投票的用户投票已结束，可以查看结果
+func notifyResults(poll models.Poll) error {
+	recipients := append([]string{poll.CreatorID}, voters(poll.ID)...)
+	recipients = append(recipients, commenters(poll.ID)...)
+	for _, userID := range unique(append(recipients, watchers(poll.ID)...)) {
+		if err := create(models.Notification{UserID: userID, Type: models.NotificationResults, PollID: poll.ID}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// voters 投票中有投票记录的用户
+func voters(pollID string) []string {
+	var ids []string
+	database.DB.Model(&models.Vote{}).Where("poll_id = ?", pollID).Pluck("DISTINCT user_id", &ids)
+	return ids
+}
+
+// commenters 在投票下发表过显示中评论的用户
+func commenters(pollID string) []string {
+	var ids []string
+	database.DB.Model(&models.Comment{}).Where("poll_id = ? AND status = ? AND is_deleted = ?", pollID, models.CommentVisible, false).Pluck("DISTINCT user_id", &ids)
+	return ids
+}
+
+// watchers 关注投票的用户
+func watchers(pollID string) []string {
+	var ids []string
+	database.DB.Model(&models.PollWatch{}).Where("poll_id = ?", pollID).Pluck("user_id", &ids)
+	return ids
+}
+
+// unique 去掉重复和空的用户ID，保持顺序
+func unique(ids []string) []string {
+	seen := make(map[string]bool, len(ids))
+	result := make([]string, 0, len(ids))
+	for _, id := range ids {
+		if id != "" && !seen[id] {
+			seen[id] = true
+			result = append(result, id)
+		}
+	}
+	return result
+}
+
+// Enabled 用户是否接收该类通知，没有设置时默认接收
+func Enabled(userID, kind string) bool {
+	var preference models.NotificationPreference
+	if err := database.DB.First(&preference, "user_id = ? AND type = ?", userID, kind).Error; err != nil {
+		return true
+	}
+	return preference.Enabled
+}
+
+// EmailEnabled 用户是否通过邮件接收该类通知，没有设置时默认接收。只有部分类型支持邮件通知
+func EmailEnabled(userID, kind string) bool {
+	if !models.ValidEmailNotificationType(kind) {
+		return false
+	}
+	var preference models.NotificationPreference
+	if err := database.DB.First(&preference, "user_id = ? AND type = ?", userID, kind).Error; err != nil {
+		return true
+	}
+	return preference.Email == nil || *preference.Email
+}
+
+// wantsEmail 是否需要为新通知发送邮件：配置了发送方式，用户设置了邮件地址且没有关闭该类邮件通知
+func wantsEmail(notification models.Notification) bool {
+	if !email.Enabled() || !EmailEnabled(notification.UserID, notification.Type) {
+		return false
+	}
+	var user models.User
+	if err := database.DB.Select("id, email").First(&user, "id = ?", notification.UserID).Error; err != nil {
+		return false
+	}
+	return user.Email != ""
+}
+
+// create 创建通知。用户关闭了该类通知时跳过；事件可能重复投递，检查任务也会重复运行，已经存在的通知直接跳过
+func create(notification models.Notification) error {
+	if !Enabled(notification.UserID, notification.Type) {
+		return nil
+	}
+
+	var count int
+	if err := database.DB.Model(&models.Notification{}).
+		Where("user_id = ? AND type = ? AND poll_id = ? AND comment_id = ?", notification.UserID, notification.Type, notification.PollID, notification.CommentID).
+		Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+	notification.CreatedAt = time.Now()
+	notification.EmailPending = wantsEmail(notification)
+	if err := database.DB.Create(&notification).Error; err != nil {
+		return err
+	}
+	if notification.EmailPending {
+		email.Notify()
+	}
+	return nil
+}
@@ -14,7 +14,8 @@ func SetupRouter() *gin.Engine {
 	r.Use(func(c *gin.Context) {
 		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
 		c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, User-ID")
+		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, User-ID, X-Request-ID")
+		c.Writer.Header().Set("Access-Control-Expose-Headers", "X-Request-ID")
 		c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, DELETE")
 
 		if c.Request.Method == "OPTIONS" {
@@ -25,6 +26,9 @@ func SetupRouter() *gin.Engine {
 		c.Next()
 	})
 
+	// 为每个请求分配请求ID
+	r.Use(controllers.RequestID())
+
 	// 用户相关路由
 	userRoutes := r.Group("/api/users")
 	{
@@ -33,6 +37,19 @@ func SetupRouter() *gin.Engine {
 		userRoutes.GET("/:id", controllers.GetUser)
 		userRoutes.GET("/username/:username", controllers.GetUserByUsername)
 		userRoutes.GET("/:id/stats", controllers.GetUserStats)
+		userRoutes.PUT("/:id/role", controllers.UpdateUserRole)
+	}
+
+	// 通知相关路由，均针对 User-ID 对应的当前用户
+	notificationRoutes := r.Group("/api/notifications")
+	{
+		notificationRoutes.GET("", controllers.ListNotifications)
+		notificationRoutes.POST("/read-all", controllers.MarkAllNotificationsRead)
+		notificationRoutes.POST("/:id/read", controllers.MarkNotificationRead)
+		notificationRoutes.GET("/preferences", controllers.GetNotificationPreferences)
+		notificationRoutes.PUT("/preferences", controllers.UpdateNotificationPreferences)
+		notificationRoutes.GET("/email", controllers.GetEmailSettings)
+		notificationRoutes.PUT("/email", controllers.UpdateEmailSettings)
 	}
 
 	// 投票相关路由
@@ -44,7 +61,14 @@ func SetupRouter() *gin.Engine {
 		pollRoutes.PUT("/:id", controllers.UpdatePoll)
 		pollRoutes.DELETE("/:id", controllers.DeletePoll)
 		pollRoutes.GET("/:id/results", controllers.GetPollResults)
+		pollRoutes.GET("/:id/results/stream", controllers.StreamPollResults)
+		pollRoutes.GET("/:id/live", controllers.JoinLiveRoom)
 		pollRoutes.GET("/:id/stats", controllers.GetPollStats)
+		pollRoutes.GET("/:id/ics", controllers.ExportScheduleICS)
+		pollRoutes.POST("/:id/resolve", controllers.ResolvePoll)
+		pollRoutes.GET("/:id/history", controllers.GetPollHistory)
+		pollRoutes.POST("/:id/watch", controllers.WatchPoll)
+		pollRoutes.DELETE("/:id/watch", controllers.UnwatchPoll)
 
 		// 选项相关路由
 		pollRoutes.POST("/:id/options", controllers.AddOption)
@@ -54,19 +78,73 @@ func SetupRouter() *gin.Engine {
 		// 投票操作路由
 		pollRoutes.POST("/:id/vote", controllers.CastVote)
 		pollRoutes.GET("/:id/user-votes", controllers.GetUserVotes)
+		pollRoutes.GET("/:id/credits", controllers.GetUserCredits)
+		pollRoutes.GET("/:id/score", controllers.GetQuizScore)
 
 		// 评论相关路由
 		pollRoutes.POST("/:id/comments", controllers.AddComment)
 		pollRoutes.GET("/:id/comments", controllers.GetPollComments)
+		pollRoutes.GET("/:id/comments/:comment_id/replies", controllers.GetCommentReplies)
+		pollRoutes.GET("/:id/comments/:comment_id/reactions", controllers.GetCommentReactions)
+		pollRoutes.POST("/:id/comments/:comment_id/reactions", controllers.AddReaction)
+		pollRoutes.DELETE("/:id/comments/:comment_id/reactions/:kind", controllers.RemoveReaction)
+		pollRoutes.POST("/:id/comments/:comment_id/report", controllers.ReportComment)
+		pollRoutes.GET("/:id/comments/:comment_id/history", controllers.GetCommentHistory)
+		pollRoutes.POST("/:id/comments/:comment_id/pin", controllers.PinComment)
+		pollRoutes.DELETE("/:id/comments/:comment_id/pin", controllers.UnpinComment)
 		pollRoutes.PUT("/:id/comments/:comment_id", controllers.UpdateComment)
 		pollRoutes.DELETE("/:id/comments/:comment_id", controllers.DeleteComment)
 	}
 
+	// Webhook 相关路由
+	webhookRoutes := r.Group("/api/webhooks")
+	{
+		webhookRoutes.POST("", controllers.CreateWebhook)
+		webhookRoutes.GET("", controllers.ListWebhooks)
+		webhookRoutes.DELETE("/:id", controllers.DeleteWebhook)
+		webhookRoutes.GET("/:id/deliveries", controllers.ListWebhookDeliveries)
+	}
+
+	// 回收站路由
+	trashRoutes := r.Group("/api/trash")
+	{
+		trashRoutes.GET("", controllers.ListTrash)
+		trashRoutes.POST("/polls/:id/restore", controllers.RestorePoll)
+		trashRoutes.POST("/options/:id/restore", controllers.RestoreOption)
+		trashRoutes.POST("/comments/:id/restore", controllers.RestoreComment)
+	}
+
+	// 评论审核路由（审核员、管理员或投票创建者）
+	moderationRoutes := r.Group("/api/moderation")
+	{
+		moderationRoutes.GET("/comments", controllers.ListModerationQueue)
+		moderationRoutes.POST("/comments/:comment_id/approve", controllers.ApproveComment)
+		moderationRoutes.POST("/comments/:comment_id/remove", controllers.RemoveComment)
+		moderationRoutes.POST("/comments/:comment_id/restore", controllers.ReinstateComment)
+	}
+
+	// 内容过滤规则路由（仅管理员）
+	filterRoutes := r.Group("/api/filter-rules")
+	{
+		filterRoutes.GET("", controllers.ListFilterRules)
+		filterRoutes.POST("", controllers.CreateFilterRule)
+		filterRoutes.PUT("/:id", controllers.UpdateFilterRule)
+		filterRoutes.DELETE("/:id", controllers.DeleteFilterRule)
+		filterRoutes.POST("/test", controllers.TestFilter)
+	}
+
+	// 当前用户关注的投票
+	r.GET("/api/watches", controllers.ListWatchedPolls)
+
+	// 审计记录路由（仅管理员）
+	r.GET("/api/audit", controllers.ListAuditEntries)
+
 	// 统计和分析路由
 	statsRoutes := r.Group("/api/stats")
 	{
 		statsRoutes.GET("/trending", controllers.GetTrendingPolls)
+		statsRoutes.GET("/quiz-leaderboard", controllers.GetQuizLeaderboard)
 	}
 
 	return r
-} 
\ No newline at end of file
+}
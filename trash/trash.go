@@ -0,0 +1,110 @@
+package trash
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"time"
+	"vote-demo/database"
+	"vote-demo/models"
+
+	"github.com/jinzhu/gorm"
+)
+
+const (
+	// DefaultRetentionDays 回收站中的内容默认保留的天数
+	DefaultRetentionDays = 30
+	// 检查过期内容的间隔
+	purgeInterval = time.Hour
+)
+
+// Stamp 返回移入回收站的时间。
+// 同一次删除中级联移入回收站的记录使用相同的时间，恢复时据此找回一起删除的记录；
+// 统一使用 UTC，保证数据库中的时间字符串可以直接比较
+func Stamp() time.Time {
+	return time.Now().UTC()
+}
+
+// Retention 回收站保留时间，可通过环境变量 TRASH_RETENTION_DAYS 配置
+func Retention() time.Duration {
+	days := DefaultRetentionDays
+	if value, err := strconv.Atoi(os.Getenv("TRASH_RETENTION_DAYS")); err == nil && value > 0 {
+		days = value
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// StartPurger 启动清理协程，定期永久删除在回收站中超过保留时间的内容
+func StartPurger(retention time.Duration) {
+	go func() {
+		ticker := time.NewTicker(purgeInterval)
+		defer ticker.Stop()
+
+		for {
+			if err := Purge(Stamp().Add(-retention)); err != nil {
+				log.Printf("清理回收站失败: %v", err)
+			}
+			<-ticker.C
+		}
+	}()
+}
+
+// Purge 在一个事务中永久删除 cutoff 之前移入回收站的投票、选项、评论和投票记录，
+// 以及依附于它们的修改历史、预测评分和投票专属的 Webhook
+func Purge(cutoff time.Time) error {
+	tx := database.DB.Unscoped().Begin()
+	if err := purge(tx, cutoff); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit().Error
+}
+
+func purge(tx *gorm.DB, cutoff time.Time) error {
+	expired := tx.Model(&models.Poll{}).Select("id").Where("deleted_at < ?", cutoff).QueryExpr()
+	webhooks := tx.Model(&models.Webhook{}).Select("id").Where("poll_id IN (?)", expired).QueryExpr()
+	if err := tx.Where("webhook_id IN (?)", webhooks).Delete(&models.WebhookDelivery{}).Error; err != nil {
+		return err
+	}
+	for _, model := range []interface{}{
+		&models.Vote{}, &models.OptionRevision{}, &models.Option{}, &models.Comment{},
+		&models.PollRevision{}, &models.ForecastScore{}, &models.Webhook{}, &models.Notification{},
+		&models.PollWatch{},
+	} {
+		if err := tx.Where("poll_id IN (?)", expired).Delete(model).Error; err != nil {
+			return err
+		}
+	}
+	if err := tx.Where("deleted_at < ?", cutoff).Delete(&models.Poll{}).Error; err != nil {
+		return err
+	}
+
+	expired = tx.Model(&models.Option{}).Select("id").Where("deleted_at < ?", cutoff).QueryExpr()
+	if err := tx.Where("option_id IN (?)", expired).Delete(&models.Vote{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("option_id IN (?)", expired).Delete(&models.OptionRevision{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("deleted_at < ?", cutoff).Delete(&models.Option{}).Error; err != nil {
+		return err
+	}
+
+	// 回复与父评论一起移入回收站，通常会一起过期；仍在回收站外的回复由外键随父评论级联删除
+	if err := tx.Where("deleted_at < ?", cutoff).Delete(&models.Comment{}).Error; err != nil {
+		return err
+	}
+	// 评论反应、举报、提及和修改历史随评论一起永久删除
+	for _, model := range []interface{}{&models.CommentReaction{}, &models.CommentReport{}, &models.CommentMention{}, &models.CommentRevision{}} {
+		if err := tx.Where("comment_id NOT IN (?)", tx.Model(&models.Comment{}).Select("id").QueryExpr()).
+			Delete(model).Error; err != nil {
+			return err
+		}
+	}
+	// 评论相关的通知随评论一起永久删除
+	if err := tx.Where("comment_id <> '' AND comment_id NOT IN (?)", tx.Model(&models.Comment{}).Select("id").QueryExpr()).
+		Delete(&models.Notification{}).Error; err != nil {
+		return err
+	}
+	return tx.Where("deleted_at < ?", cutoff).Delete(&models.Vote{}).Error
+}
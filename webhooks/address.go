@@ -0,0 +1,111 @@
+package webhooks
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"syscall"
+	"time"
+)
+
+// ErrBlockedAddress Webhook 地址指向本机、内网或链路本地地址
+var ErrBlockedAddress = errors.New("不允许向本机或内网地址投送 Webhook")
+
+// allowPrivateNetworks 是否允许投送到内网地址，只用于本地开发，可通过环境变量 WEBHOOK_ALLOW_PRIVATE_NETWORKS=1 开启
+var allowPrivateNetworks = os.Getenv("WEBHOOK_ALLOW_PRIVATE_NETWORKS") == "1"
+
+// 运营商级 NAT 和 0.0.0.0/8，net.IP 没有对应的判断方法
+var blockedNetworks = []*net.IPNet{
+	mustParseCIDR("100.64.0.0/10"),
+	mustParseCIDR("0.0.0.0/8"),
+}
+
+func mustParseCIDR(cidr string) *net.IPNet {
+	_, network, err := net.ParseCIDR(cidr)
+	if err != nil {
+		panic(err)
+	}
+	return network
+}
+
+// blockedIP 是否是本机、内网、链路本地（包括云服务的元数据地址 169.254.169.254）或组播地址
+func blockedIP(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() {
+		return true
+	}
+	for _, network := range blockedNetworks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateURL 检查 Webhook 地址：必须是 http 或 https，主机名解析出的地址不能是本机或内网地址。
+// 创建时的检查只是尽早报错，DNS 解析结果可能变化，投送时在建立连接前还会再次检查
+func ValidateURL(raw string) error {
+	target, err := url.Parse(raw)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Hostname() == "" {
+		return errors.New("无效的 Webhook 地址")
+	}
+	if allowPrivateNetworks {
+		return nil
+	}
+
+	host := target.Hostname()
+	if ip := net.ParseIP(host); ip != nil {
+		if blockedIP(ip) {
+			return ErrBlockedAddress
+		}
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return errors.New("无法解析 Webhook 地址的主机名")
+	}
+	for _, addr := range addrs {
+		if blockedIP(addr.IP) {
+			return ErrBlockedAddress
+		}
+	}
+	return nil
+}
+
+// dialControl 在建立连接前检查实际连接的 IP，DNS 重绑定和重定向到内网地址也会被拒绝
+func dialControl(network, address string, conn syscall.RawConn) error {
+	if allowPrivateNetworks {
+		return nil
+	}
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || blockedIP(ip) {
+		return ErrBlockedAddress
+	}
+	return nil
+}
+
+// newClient 投送使用的 HTTP 客户端，不经过环境变量中的代理，以便检查实际连接的地址
+func newClient() *http.Client {
+	dialer := &net.Dialer{Timeout: deliveryTimeout, Control: dialControl}
+	return &http.Client{
+		Timeout: deliveryTimeout,
+		Transport: &http.Transport{
+			Proxy:                 nil,
+			DialContext:           dialer.DialContext,
+			TLSHandshakeTimeout:   deliveryTimeout,
+			ResponseHeaderTimeout: deliveryTimeout,
+			MaxIdleConns:          10,
+			IdleConnTimeout:       90 * time.Second,
+		},
+	}
+}
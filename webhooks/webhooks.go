@@ -0,0 +1,254 @@
+package webhooks
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+	"vote-demo/database"
+	"vote-demo/events"
+	"vote-demo/models"
+)
+
+const (
+	// MaxAttempts 每次投送的最大尝试次数，用尽后标记为失败
+	MaxAttempts = 6
+	// 第一次重试的等待时间，之后每次翻倍
+	retryBaseDelay = 10 * time.Second
+	// 重试等待时间的上限
+	retryMaxDelay = time.Hour
+	// 投送请求的超时时间
+	deliveryTimeout = 10 * time.Second
+	// 没有新事件时检查待重试投送的间隔
+	pollInterval = 5 * time.Second
+)
+
+var (
+	client = newClient()
+	wakeup = make(chan struct{}, 1)
+)
+
+// Payload 投送给接收方的请求体
+type Payload struct {
+	Event     string      `json:"event"`
+	PollID    string      `json:"poll_id"`
+	CreatedAt time.Time   `json:"created_at"`
+	Data      interface{} `json:"data"`
+}
+
+// Sign 使用 Webhook 密钥计算请求体的 HMAC-SHA256 签名
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Subscribed Webhook 是否订阅了事件
+func Subscribed(webhook models.Webhook, event string) bool {
+	for _, subscribed := range strings.Split(webhook.Events, ",") {
+		if strings.TrimSpace(subscribed) == event {
+			return true
+		}
+	}
+	return false
+}
+
+// SubscribeEvents 注册 Webhook 的事件订阅者，应在服务启动时调用
+func SubscribeEvents() {
+	events.Subscribe("webhooks", handleEvent)
+}
+
+// handleEvent 将领域事件转换为 Webhook 投送，未开放给 Webhook 的事件直接忽略
+func handleEvent(event events.Event) error {
+	switch e := event.(type) {
+	case events.PollCreated:
+		return Enqueue(e.Poll.ID, models.WebhookEventPollCreated, e.Poll)
+	case events.VoteCast:
+		return Enqueue(e.PollID, models.WebhookEventVoteCast, map[string]interface{}{
+			"user_id": e.UserID,
+			"votes":   e.Votes,
+		})
+	case events.PollClosed:
+		return Enqueue(e.Poll.ID, models.WebhookEventPollClosed, e.Poll)
+	case events.CommentAdded:
+		return Enqueue(e.Comment.PollID, models.WebhookEventCommentAdded, e.Comment)
+	case events.CommentModerated:
+		// 开启审核的投票中，评论审核通过后才算发表
+		if e.Before.Status == models.CommentPending && e.Comment.Status == models.CommentVisible {
+			return Enqueue(e.Comment.PollID, models.WebhookEventCommentAdded, e.Comment)
+		}
+	}
+	return nil
+}
+
+// Enqueue 为订阅了该事件的 Webhook（该投票的 Webhook 和全局 Webhook）创建待投送记录，并唤醒投送协程
+func Enqueue(pollID, event string, data interface{}) error {
+	var hooks []models.Webhook
+	if err := database.DB.Where("is_active = ? AND (poll_id = ? OR poll_id = '')", true, pollID).Find(&hooks).Error; err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(Payload{
+		Event:     event,
+		PollID:    pollID,
+		CreatedAt: time.Now(),
+		Data:      data,
+	})
+	if err != nil {
+		// 序列化失败重试也无法恢复，只记录日志
+		log.Printf("Webhook 事件序列化失败: %v", err)
+		return nil
+	}
+
+	queued := false
+	for _, hook := range hooks {
+		if !Subscribed(hook, event) {
+			continue
+		}
+
+		now := time.Now()
+		delivery := models.WebhookDelivery{
+			WebhookID:     hook.ID,
+			Event:         event,
+			Payload:       string(body),
+			Status:        models.DeliveryStatusPending,
+			NextAttemptAt: &now,
+			CreatedAt:     now,
+			UpdatedAt:     now,
+		}
+		if err := database.DB.Create(&delivery).Error; err != nil {
+			return fmt.Errorf("创建 Webhook 投送记录失败: %v", err)
+		}
+		queued = true
+	}
+
+	if queued {
+		select {
+		case wakeup <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+// StartWorker 启动投送协程。投送记录保存在数据库中，服务重启后未完成的投送会继续重试
+func StartWorker() {
+	go func() {
+		ticker := time.NewTicker(pollInterval)
+		defer ticker.Stop()
+
+		for {
+			deliverDue()
+
+			select {
+			case <-wakeup:
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// deliverDue 投送所有到期的记录
+func deliverDue() {
+	var deliveries []models.WebhookDelivery
+	database.DB.Where("status = ? AND next_attempt_at <= ?", models.DeliveryStatusPending, time.Now()).
+		Order("created_at ASC").
+		Find(&deliveries)
+
+	for _, delivery := range deliveries {
+		var hook models.Webhook
+		if err := database.DB.First(&hook, "id = ?", delivery.WebhookID).Error; err != nil || !hook.IsActive {
+			markFailed(&delivery, 0, "Webhook 已删除或已停用")
+			continue
+		}
+		attempt(hook, &delivery)
+	}
+}
+
+// attempt 投送一次，失败时按指数退避安排下一次重试
+func attempt(hook models.Webhook, delivery *models.WebhookDelivery) {
+	delivery.Attempts++
+
+	code, err := send(hook, delivery)
+	if err == nil {
+		now := time.Now()
+		database.DB.Model(delivery).Updates(map[string]interface{}{
+			"status":          models.DeliveryStatusSucceeded,
+			"attempts":        delivery.Attempts,
+			"response_code":   code,
+			"error":           "",
+			"next_attempt_at": nil,
+			"delivered_at":    now,
+			"updated_at":      now,
+		})
+		return
+	}
+
+	if delivery.Attempts >= MaxAttempts {
+		markFailed(delivery, code, err.Error())
+		return
+	}
+
+	next := time.Now().Add(Backoff(delivery.Attempts))
+	database.DB.Model(delivery).Updates(map[string]interface{}{
+		"attempts":        delivery.Attempts,
+		"response_code":   code,
+		"error":           err.Error(),
+		"next_attempt_at": next,
+		"updated_at":      time.Now(),
+	})
+}
+
+// Backoff 返回第 attempts 次失败后的重试等待时间：10s、20s、40s……最长 1 小时
+func Backoff(attempts int) time.Duration {
+	delay := retryBaseDelay
+	for i := 1; i < attempts; i++ {
+		delay *= 2
+		if delay >= retryMaxDelay {
+			return retryMaxDelay
+		}
+	}
+	return delay
+}
+
+func markFailed(delivery *models.WebhookDelivery, code int, reason string) {
+	database.DB.Model(delivery).Updates(map[string]interface{}{
+		"status":          models.DeliveryStatusFailed,
+		"attempts":        delivery.Attempts,
+		"response_code":   code,
+		"error":           reason,
+		"next_attempt_at": nil,
+		"updated_at":      time.Now(),
+	})
+}
+
+// send 发送带签名的请求，非 2xx 响应视为失败。只记录响应状态码，不保存响应体
+func send(hook models.Webhook, delivery *models.WebhookDelivery) (int, error) {
+	body := []byte(delivery.Payload)
+	req, err := http.NewRequest(http.MethodPost, hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "vote-demo-webhook/1.0")
+	req.Header.Set("X-Webhook-Event", delivery.Event)
+	req.Header.Set("X-Webhook-Delivery", delivery.ID)
+	req.Header.Set("X-Webhook-Signature", Sign(hook.Secret, body))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("接收方返回 %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
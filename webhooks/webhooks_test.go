@@ -0,0 +1,234 @@
+package webhooks
+
+import (
+	"crypto/hmac"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"vote-demo/database"
+	"vote-demo/models"
+)
+
+// setupDB 使用临时目录中的数据库
+func setupDB(t *testing.T) {
+	t.Helper()
+	database.Path = filepath.Join(t.TempDir(), "test.db")
+	database.InitDB()
+	database.DB.LogMode(false)
+	t.Cleanup(database.CloseDB)
+}
+
+// allowLoopback 允许投送到 httptest.Server 的本机地址
+func allowLoopback(t *testing.T) {
+	t.Helper()
+	previous := allowPrivateNetworks
+	allowPrivateNetworks = true
+	t.Cleanup(func() { allowPrivateNetworks = previous })
+}
+
+func TestSign(t *testing.T) {
+	tests := []struct {
+		secret string
+		body   string
+		want   string
+	}{
+		{"secret", "hello", "sha256=88aab3ede8d3adf94d26ab90d3bafd4a2083070c3bcce9c014ee04a443847c0b"},
+		{"", "", "sha256=b613679a0814d9ec772f95d778c35fc5ff1697c493715653c6c712144292c5ad"},
+	}
+	for _, tt := range tests {
+		if got := Sign(tt.secret, []byte(tt.body)); got != tt.want {
+			t.Errorf("Sign(%q, %q) = %s, want %s", tt.secret, tt.body, got, tt.want)
+		}
+	}
+}
+
+func TestSignVerify(t *testing.T) {
+	body := []byte(`{"event":"vote.cast"}`)
+	signature := Sign("secret", body)
+
+	tests := []struct {
+		name   string
+		secret string
+		body   []byte
+		valid  bool
+	}{
+		{"same secret and body", "secret", body, true},
+		{"wrong secret", "other", body, false},
+		{"modified body", "secret", []byte(`{"event":"poll.closed"}`), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			valid := hmac.Equal([]byte(signature), []byte(Sign(tt.secret, tt.body)))
+			if valid != tt.valid {
+				t.Errorf("valid = %v, want %v", valid, tt.valid)
+			}
+		})
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{0, 10 * time.Second},
+		{1, 10 * time.Second},
+		{2, 20 * time.Second},
+		{3, 40 * time.Second},
+		{9, 2560 * time.Second},
+		{10, time.Hour},
+		{100, time.Hour},
+	}
+	for _, tt := range tests {
+		if got := Backoff(tt.attempts); got != tt.want {
+			t.Errorf("Backoff(%d) = %v, want %v", tt.attempts, got, tt.want)
+		}
+	}
+}
+
+func TestValidateURL(t *testing.T) {
+	tests := []struct {
+		url  string
+		want error
+	}{
+		{"http://127.0.0.1/hook", ErrBlockedAddress},
+		{"http://169.254.169.254/latest/meta-data", ErrBlockedAddress},
+		{"http://[::1]:8080/", ErrBlockedAddress},
+		{"http://10.0.0.1/", ErrBlockedAddress},
+		{"http://192.168.1.1/", ErrBlockedAddress},
+		{"http://100.64.0.1/", ErrBlockedAddress},
+		{"http://0.0.0.0/", ErrBlockedAddress},
+		{"https://8.8.8.8/hook", nil},
+	}
+	for _, tt := range tests {
+		if err := ValidateURL(tt.url); err != tt.want {
+			t.Errorf("ValidateURL(%q) = %v, want %v", tt.url, err, tt.want)
+		}
+	}
+
+	for _, raw := range []string{"ftp://8.8.8.8/", "not a url", "http:///path"} {
+		if err := ValidateURL(raw); err == nil || err == ErrBlockedAddress {
+			t.Errorf("ValidateURL(%q) = %v, want invalid address error", raw, err)
+		}
+	}
+}
+
+// receiver 记录收到的请求，前 failures 次返回 500
+type receiver struct {
+	mu        sync.Mutex
+	failures  int
+	requests  int
+	verified  int
+	lastEvent string
+}
+
+func (r *receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	body, _ := io.ReadAll(req.Body)
+	r.requests++
+	r.lastEvent = req.Header.Get("X-Webhook-Event")
+	if hmac.Equal([]byte(req.Header.Get("X-Webhook-Signature")), []byte(Sign("secret", body))) {
+		r.verified++
+	}
+	if r.requests <= r.failures {
+		http.Error(w, "unavailable", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// deliverUntilDone 反复投送，每次将下一次重试时间提前到现在，直到投送成功或失败
+func deliverUntilDone(t *testing.T, deliveryID string) models.WebhookDelivery {
+	t.Helper()
+	var delivery models.WebhookDelivery
+	for i := 0; i < MaxAttempts+1; i++ {
+		deliverDue()
+		database.DB.First(&delivery, "id = ?", deliveryID)
+		if delivery.Status != models.DeliveryStatusPending {
+			return delivery
+		}
+		if delivery.NextAttemptAt == nil || !delivery.NextAttemptAt.After(time.Now()) {
+			t.Fatalf("attempt %d: next_attempt_at = %v, want a time in the future", delivery.Attempts, delivery.NextAttemptAt)
+		}
+		database.DB.Model(&delivery).UpdateColumn("next_attempt_at", time.Now().Add(-time.Second))
+	}
+	t.Fatalf("delivery still pending after %d attempts", delivery.Attempts)
+	return delivery
+}
+
+func TestDeliveryRetry(t *testing.T) {
+	setupDB(t)
+	allowLoopback(t)
+
+	tests := []struct {
+		name         string
+		failures     int
+		wantStatus   string
+		wantAttempts int
+		wantCode     int
+	}{
+		{"first attempt succeeds", 0, models.DeliveryStatusSucceeded, 1, http.StatusNoContent},
+		{"succeeds after retries", 2, models.DeliveryStatusSucceeded, 3, http.StatusNoContent},
+		{"gives up after max attempts", MaxAttempts, models.DeliveryStatusFailed, MaxAttempts, http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recv := &receiver{failures: tt.failures}
+			server := httptest.NewServer(recv)
+			defer server.Close()
+
+			pollID := strings.ReplaceAll(tt.name, " ", "-")
+			hook := models.Webhook{PollID: pollID, CreatorID: "creator", URL: server.URL, Secret: "secret", Events: models.WebhookEventVoteCast, IsActive: true}
+			if err := database.DB.Create(&hook).Error; err != nil {
+				t.Fatal(err)
+			}
+			if err := Enqueue(pollID, models.WebhookEventVoteCast, map[string]string{"user_id": "u1"}); err != nil {
+				t.Fatal(err)
+			}
+			var queued models.WebhookDelivery
+			if err := database.DB.First(&queued, "webhook_id = ?", hook.ID).Error; err != nil {
+				t.Fatal(err)
+			}
+
+			delivery := deliverUntilDone(t, queued.ID)
+			if delivery.Status != tt.wantStatus || delivery.Attempts != tt.wantAttempts || delivery.ResponseCode != tt.wantCode {
+				t.Errorf("status, attempts, code = %s, %d, %d; want %s, %d, %d",
+					delivery.Status, delivery.Attempts, delivery.ResponseCode, tt.wantStatus, tt.wantAttempts, tt.wantCode)
+			}
+			if recv.requests != tt.wantAttempts || recv.verified != recv.requests {
+				t.Errorf("receiver got %d requests with %d valid signatures, want %d", recv.requests, recv.verified, tt.wantAttempts)
+			}
+			if recv.lastEvent != models.WebhookEventVoteCast {
+				t.Errorf("X-Webhook-Event = %q, want %q", recv.lastEvent, models.WebhookEventVoteCast)
+			}
+			if tt.wantStatus == models.DeliveryStatusFailed && !strings.Contains(delivery.Error, "500") {
+				t.Errorf("error = %q, want the response status", delivery.Error)
+			}
+		})
+	}
+}
+
+func TestDeliveryBlockedAddress(t *testing.T) {
+	setupDB(t)
+
+	recv := &receiver{}
+	server := httptest.NewServer(recv)
+	defer server.Close()
+
+	hook := models.Webhook{PollID: "poll", CreatorID: "creator", URL: server.URL, Secret: "secret", Events: models.WebhookEventVoteCast, IsActive: true}
+	delivery := models.WebhookDelivery{Event: models.WebhookEventVoteCast, Payload: "{}"}
+	if _, err := send(hook, &delivery); !errors.Is(err, ErrBlockedAddress) {
+		t.Errorf("send to %s: err = %v, want %v", server.URL, err, ErrBlockedAddress)
+	}
+	if recv.requests != 0 {
+		t.Errorf("receiver got %d requests, want 0", recv.requests)
+	}
+}